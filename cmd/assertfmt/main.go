@@ -0,0 +1,91 @@
+// Assertfmt formats assert files in the canonical style of parser.Format.
+//
+// Usage:
+//
+//	assertfmt [-l] [-w] [file ...]
+//
+// Without files it formats standard input to standard output. By default the
+// formatted files are written to standard output; -l lists the files whose
+// formatting differs and -w writes the formatted files back. It exits with
+// status 2 when a file cannot be read or parsed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"parser/parser"
+)
+
+var (
+	list  = flag.Bool("l", false, "list files whose formatting differs")
+	write = flag.Bool("w", false, "write the formatted files back")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: assertfmt [-l] [-w] [file ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "assertfmt: cannot use -w with standard input")
+			os.Exit(2)
+		}
+		if err := formatFile("<standard input>", os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	status := 0
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err == nil {
+			err = formatFile(name, f)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+		}
+	}
+	os.Exit(status)
+}
+
+// formatFile formats the file read from in and lists, writes back or prints
+// it as the flags say.
+func formatFile(name string, in io.Reader) error {
+	source, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	formatted, err := parser.Format(string(source))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	changed := formatted != string(source)
+	if *list && changed {
+		fmt.Println(name)
+	}
+	if *write {
+		if !changed {
+			return nil
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(name, []byte(formatted), info.Mode().Perm())
+	}
+	if !*list {
+		fmt.Print(formatted)
+	}
+	return nil
+}
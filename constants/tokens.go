@@ -18,15 +18,63 @@ const (
 	TOKEN_NOT
 	TOKEN_LEFT_PAREN
 	TOKEN_RIGHT_PAREN
+	TOKEN_LESS
+	TOKEN_LESS_EQUAL
+	TOKEN_GREATER
+	TOKEN_GREATER_EQUAL
+	TOKEN_STRING
+	TOKEN_LEFT_BRACKET
+	TOKEN_RIGHT_BRACKET
+	TOKEN_COMMA
+	TOKEN_IN
+	TOKEN_ILLEGAL
+	TOKEN_RANGE
+	TOKEN_COLON
+	TOKEN_FORALL
+	TOKEN_EXISTS
+	TOKEN_DOT
+	TOKEN_COALESCE
+	TOKEN_IF
+	TOKEN_THEN
+	TOKEN_ELSE
+	TOKEN_APPROX
+	TOKEN_QUANTITY
+	TOKEN_TIME
+	TOKEN_LEFT_BRACE
+	TOKEN_RIGHT_BRACE
+	TOKEN_TAG
+	TOKEN_SEMICOLON
+	TOKEN_PIPE
 )
 
+// keywords maps reserved words to their token types. Statement keywords such
+// as assert are matched by lexeme in the parser and are not listed here.
+var keywords = map[string]TokenType{
+	"in":     TOKEN_IN,
+	"forall": TOKEN_FORALL,
+	"exists": TOKEN_EXISTS,
+	"if":     TOKEN_IF,
+	"then":   TOKEN_THEN,
+	"else":   TOKEN_ELSE,
+}
+
+// LookupIdent returns the keyword token type for ident, or TOKEN_VARIABLE.
+func LookupIdent(ident string) TokenType {
+	if tokenType, ok := keywords[ident]; ok {
+		return tokenType
+	}
+	return TOKEN_VARIABLE
+}
+
 type Token struct {
 	Type    TokenType
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	Column  int
+	File    string
 }
 
 func (t Token) ToString() string {
-	return fmt.Sprintf("Type: %d, Lexeme: %s, Line: %d", t.Type, t.Lexeme, t.Line)
+	return fmt.Sprintf("Type: %d, Lexeme: %s, Line: %d, Column: %d", t.Type, t.Lexeme, t.Line, t.Column)
 }
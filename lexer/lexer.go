@@ -3,13 +3,18 @@ package lexer
 import (
 	"fmt"
 	"parser/constants"
+	"regexp"
+	"strconv"
 	"unicode"
 )
 
 type Lexerer interface {
 	NewToken() constants.Token
+	Input() string
 	readNumber() string
 	readVariable() string
+	readString() (string, bool)
+	readTimestamp() (string, bool)
 	peakChar() byte
 	skipWhitespace()
 }
@@ -20,6 +25,7 @@ type Lexer struct {
 	readPosition int
 	ch           byte
 	line         int
+	lineStart    int
 }
 
 func NewLexer(input string) Lexerer {
@@ -39,6 +45,9 @@ func (l *Lexer) readChar() {
 	l.readPosition++
 }
 
+// Input returns the text being tokenized.
+func (l *Lexer) Input() string { return l.input }
+
 func (l *Lexer) ToSring() string {
 	return fmt.Sprintf("input: %s, position: %d, readPosition: %d, ch: %c, line: %d", l.input, l.position, l.readPosition, l.ch, l.line)
 }
@@ -48,6 +57,7 @@ func (l *Lexer) NewToken() constants.Token {
 	skipReadChar := false
 
 	l.skipWhitespace()
+	column := l.position - l.lineStart + 1
 
 	switch l.ch {
 	case '=':
@@ -62,10 +72,26 @@ func (l *Lexer) NewToken() constants.Token {
 		if l.peakChar() == '=' {
 			ch := l.ch
 			l.readChar()
-			tok = constants.Token{Type: constants.TOKEN_NOT_EQUAL, Lexeme: string(ch) + string(l.ch)}
+			tok = constants.Token{Type: constants.TOKEN_LESS_EQUAL, Lexeme: string(ch) + string(l.ch)}
+		} else {
+			tok = constants.Token{Type: constants.TOKEN_LESS, Lexeme: string(l.ch)}
+		}
+	case '>':
+		if l.peakChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = constants.Token{Type: constants.TOKEN_GREATER_EQUAL, Lexeme: string(ch) + string(l.ch)}
+		} else {
+			tok = constants.Token{Type: constants.TOKEN_GREATER, Lexeme: string(l.ch)}
 		}
 	case '!':
-		tok = constants.Token{Type: constants.TOKEN_NOT, Lexeme: string(l.ch)}
+		if l.peakChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = constants.Token{Type: constants.TOKEN_NOT_EQUAL, Lexeme: string(ch) + string(l.ch)}
+		} else {
+			tok = constants.Token{Type: constants.TOKEN_NOT, Lexeme: string(l.ch)}
+		}
 	case '+':
 		tok = constants.Token{Type: constants.TOKEN_PLUS, Lexeme: string(l.ch)}
 	case '-':
@@ -78,21 +104,83 @@ func (l *Lexer) NewToken() constants.Token {
 		tok = constants.Token{Type: constants.TOKEN_LEFT_PAREN, Lexeme: string(l.ch)}
 	case ')':
 		tok = constants.Token{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: string(l.ch)}
+	case '[':
+		tok = constants.Token{Type: constants.TOKEN_LEFT_BRACKET, Lexeme: string(l.ch)}
+	case ']':
+		tok = constants.Token{Type: constants.TOKEN_RIGHT_BRACKET, Lexeme: string(l.ch)}
+	case '{':
+		tok = constants.Token{Type: constants.TOKEN_LEFT_BRACE, Lexeme: string(l.ch)}
+	case '}':
+		tok = constants.Token{Type: constants.TOKEN_RIGHT_BRACE, Lexeme: string(l.ch)}
+	case ',':
+		tok = constants.Token{Type: constants.TOKEN_COMMA, Lexeme: string(l.ch)}
+	case ';':
+		tok = constants.Token{Type: constants.TOKEN_SEMICOLON, Lexeme: string(l.ch)}
+	case '|':
+		tok = constants.Token{Type: constants.TOKEN_PIPE, Lexeme: string(l.ch)}
+	case '~':
+		if l.peakChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = constants.Token{Type: constants.TOKEN_APPROX, Lexeme: string(ch) + string(l.ch)}
+		} else {
+			tok = constants.Token{Type: constants.TOKEN_ILLEGAL, Lexeme: string(l.ch)}
+		}
+	case '?':
+		if l.peakChar() == '?' {
+			ch := l.ch
+			l.readChar()
+			tok = constants.Token{Type: constants.TOKEN_COALESCE, Lexeme: string(ch) + string(l.ch)}
+		} else {
+			tok = constants.Token{Type: constants.TOKEN_ILLEGAL, Lexeme: string(l.ch)}
+		}
+	case ':':
+		tok = constants.Token{Type: constants.TOKEN_COLON, Lexeme: string(l.ch)}
+	case '.':
+		if l.peakChar() == '.' {
+			ch := l.ch
+			l.readChar()
+			tok = constants.Token{Type: constants.TOKEN_RANGE, Lexeme: string(ch) + string(l.ch)}
+		} else {
+			tok = constants.Token{Type: constants.TOKEN_DOT, Lexeme: string(l.ch)}
+		}
+	case '@':
+		if unicode.IsLetter(rune(l.peakChar())) || l.peakChar() == '_' {
+			l.readChar()
+			tok = constants.Token{Type: constants.TOKEN_TAG, Lexeme: l.readVariable()}
+			skipReadChar = true
+		} else {
+			tok = constants.Token{Type: constants.TOKEN_ILLEGAL, Lexeme: string(l.ch)}
+		}
+	case '"':
+		if value, ok := l.readString(); ok {
+			tok = constants.Token{Type: constants.TOKEN_STRING, Lexeme: value}
+		} else {
+			tok = constants.Token{Type: constants.TOKEN_ILLEGAL, Lexeme: value}
+		}
 	case 0:
 		tok.Lexeme = ""
 		tok.Type = constants.TOKEN_EOF
 		tok.Line = l.line
 	default:
-		if unicode.IsDigit(rune(l.ch)) {
+		if timestamp, ok := l.readTimestamp(); ok {
+			tok = constants.Token{Type: constants.TOKEN_TIME, Lexeme: timestamp}
+			skipReadChar = true
+		} else if unicode.IsDigit(rune(l.ch)) {
 			tok = constants.Token{
 				Type:   constants.TOKEN_NUMBER,
 				Lexeme: l.readNumber(),
 			}
+			if unicode.IsLetter(rune(l.ch)) {
+				tok.Type = constants.TOKEN_QUANTITY
+				tok.Lexeme += l.readVariable()
+			}
 			skipReadChar = true
-		} else if unicode.IsLetter(rune(l.ch)) {
+		} else if unicode.IsLetter(rune(l.ch)) || l.ch == '_' {
+			ident := l.readVariable()
 			tok = constants.Token{
-				Type:   constants.TOKEN_VARIABLE,
-				Lexeme: l.readVariable(),
+				Type:   constants.LookupIdent(ident),
+				Lexeme: ident,
 			}
 			skipReadChar = true
 		} else {
@@ -104,6 +192,7 @@ func (l *Lexer) NewToken() constants.Token {
 	}
 
 	tok.Line = l.line
+	tok.Column = column
 	if !skipReadChar {
 		l.readChar()
 	}
@@ -113,7 +202,7 @@ func (l *Lexer) NewToken() constants.Token {
 func (l *Lexer) readNumber() string {
 	position := l.position
 	seenDot := false
-	for l.isDigit(l.ch) || (l.ch == '.' && !seenDot) {
+	for l.isDigit(l.ch) || (l.ch == '.' && !seenDot && l.isDigit(l.peakChar())) {
 		if l.ch == '.' {
 			seenDot = true
 		}
@@ -125,13 +214,58 @@ func (l *Lexer) readNumber() string {
 func (l *Lexer) readVariable() string {
 	currentPosition := l.position
 
-	for unicode.IsLetter(rune(l.ch)) {
+	for unicode.IsLetter(rune(l.ch)) || l.isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
 
 	return l.input[currentPosition:l.position]
 }
 
+// readString reads a double quoted string literal and returns its unquoted
+// value. The current character is left on the closing quote. If the literal
+// is unterminated or has a bad escape, the raw text is returned with false.
+func (l *Lexer) readString() (string, bool) {
+	position := l.position
+	for {
+		l.readChar()
+		if l.ch == '\\' && l.peakChar() != 0 {
+			l.readChar()
+			continue
+		}
+		if l.ch == '"' || l.ch == 0 || l.ch == '\n' {
+			break
+		}
+	}
+
+	if l.ch != '"' {
+		return l.input[position:l.position], false
+	}
+
+	value, err := strconv.Unquote(l.input[position : l.position+1])
+	if err != nil {
+		return l.input[position : l.position+1], false
+	}
+	return value, true
+}
+
+// timestampPattern matches ISO-8601 dates and date-times with a time zone,
+// like 2024-01-01 or 2024-01-01T12:30:00Z.
+var timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:\d{2}))?`)
+
+// readTimestamp reads a timestamp if the input at the current position starts
+// with one, and leaves the input untouched otherwise.
+func (l *Lexer) readTimestamp() (string, bool) {
+	timestamp := timestampPattern.FindString(l.input[l.position:])
+	if timestamp == "" {
+		return "", false
+	}
+
+	for range timestamp {
+		l.readChar()
+	}
+	return timestamp, true
+}
+
 func (l *Lexer) peakChar() byte {
 	if l.readPosition >= len(l.input) {
 		return 0
@@ -144,6 +278,7 @@ func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		if l.ch == '\n' {
 			l.line++
+			l.lineStart = l.position + 1
 		}
 		l.readChar()
 	}
@@ -13,64 +13,194 @@ func TestLexer(t *testing.T) {
 		{
 			input: "+-*/()",
 			expected: []constants.Token{
-				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1},
-				{Type: constants.TOKEN_MINUS, Lexeme: "-", Line: 1},
-				{Type: constants.TOKEN_MULTIPLY, Lexeme: "*", Line: 1},
-				{Type: constants.TOKEN_DIVIDE, Lexeme: "/", Line: 1},
-				{Type: constants.TOKEN_LEFT_PAREN, Lexeme: "(", Line: 1},
-				{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: ")", Line: 1},
-				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1},
+				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1, Column: 1},
+				{Type: constants.TOKEN_MINUS, Lexeme: "-", Line: 1, Column: 2},
+				{Type: constants.TOKEN_MULTIPLY, Lexeme: "*", Line: 1, Column: 3},
+				{Type: constants.TOKEN_DIVIDE, Lexeme: "/", Line: 1, Column: 4},
+				{Type: constants.TOKEN_LEFT_PAREN, Lexeme: "(", Line: 1, Column: 5},
+				{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: ")", Line: 1, Column: 6},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 7},
 			},
 		},
 		{
 			input: "1 + 25",
 			expected: []constants.Token{
-				{Type: constants.TOKEN_NUMBER, Lexeme: "1", Line: 1},
-				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1},
-				{Type: constants.TOKEN_NUMBER, Lexeme: "25", Line: 1},
-				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "1", Line: 1, Column: 1},
+				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1, Column: 3},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "25", Line: 1, Column: 5},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 7},
 			},
 		},
 		{
 			input: "0 / 22",
 			expected: []constants.Token{
-				{Type: constants.TOKEN_NUMBER, Lexeme: "0", Line: 1},
-				{Type: constants.TOKEN_DIVIDE, Lexeme: "/", Line: 1},
-				{Type: constants.TOKEN_NUMBER, Lexeme: "22", Line: 1},
-				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "0", Line: 1, Column: 1},
+				{Type: constants.TOKEN_DIVIDE, Lexeme: "/", Line: 1, Column: 3},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "22", Line: 1, Column: 5},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 7},
 			},
 		},
 		{
 			input: "(1 + 2 * 3) + (x - y / 2)",
 			expected: []constants.Token{
-				{Type: constants.TOKEN_LEFT_PAREN, Lexeme: "(", Line: 1},
-				{Type: constants.TOKEN_NUMBER, Lexeme: "1", Line: 1},
-				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1},
-				{Type: constants.TOKEN_NUMBER, Lexeme: "2", Line: 1},
-				{Type: constants.TOKEN_MULTIPLY, Lexeme: "*", Line: 1},
-				{Type: constants.TOKEN_NUMBER, Lexeme: "3", Line: 1},
-				{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: ")", Line: 1},
-				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1},
-				{Type: constants.TOKEN_LEFT_PAREN, Lexeme: "(", Line: 1},
-				{Type: constants.TOKEN_VARIABLE, Lexeme: "x", Line: 1},
-				{Type: constants.TOKEN_MINUS, Lexeme: "-", Line: 1},
-				{Type: constants.TOKEN_VARIABLE, Lexeme: "y", Line: 1},
-				{Type: constants.TOKEN_DIVIDE, Lexeme: "/", Line: 1},
-				{Type: constants.TOKEN_NUMBER, Lexeme: "2", Line: 1},
-				{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: ")", Line: 1},
-				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1},
+				{Type: constants.TOKEN_LEFT_PAREN, Lexeme: "(", Line: 1, Column: 1},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "1", Line: 1, Column: 2},
+				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1, Column: 4},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "2", Line: 1, Column: 6},
+				{Type: constants.TOKEN_MULTIPLY, Lexeme: "*", Line: 1, Column: 8},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "3", Line: 1, Column: 10},
+				{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: ")", Line: 1, Column: 11},
+				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1, Column: 13},
+				{Type: constants.TOKEN_LEFT_PAREN, Lexeme: "(", Line: 1, Column: 15},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "x", Line: 1, Column: 16},
+				{Type: constants.TOKEN_MINUS, Lexeme: "-", Line: 1, Column: 18},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "y", Line: 1, Column: 20},
+				{Type: constants.TOKEN_DIVIDE, Lexeme: "/", Line: 1, Column: 22},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "2", Line: 1, Column: 24},
+				{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: ")", Line: 1, Column: 25},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 26},
 			},
 		},
 		{
 			input: "assert (x * 6.00)",
 			expected: []constants.Token{
-				{Type: constants.TOKEN_VARIABLE, Lexeme: "assert", Line: 1},
-				{Type: constants.TOKEN_LEFT_PAREN, Lexeme: "(", Line: 1},
-				{Type: constants.TOKEN_VARIABLE, Lexeme: "x", Line: 1},
-				{Type: constants.TOKEN_MULTIPLY, Lexeme: "*", Line: 1},
-				{Type: constants.TOKEN_NUMBER, Lexeme: "6.00", Line: 1},
-				{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: ")", Line: 1},
-				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "assert", Line: 1, Column: 1},
+				{Type: constants.TOKEN_LEFT_PAREN, Lexeme: "(", Line: 1, Column: 8},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "x", Line: 1, Column: 9},
+				{Type: constants.TOKEN_MULTIPLY, Lexeme: "*", Line: 1, Column: 11},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "6.00", Line: 1, Column: 13},
+				{Type: constants.TOKEN_RIGHT_PAREN, Lexeme: ")", Line: 1, Column: 17},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 18},
+			},
+		},
+		{
+			input: `assert region in ["eu", "us"] != xs[0] <= 1 >= 2 < 3 > 4`,
+			expected: []constants.Token{
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "assert", Line: 1, Column: 1},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "region", Line: 1, Column: 8},
+				{Type: constants.TOKEN_IN, Lexeme: "in", Line: 1, Column: 15},
+				{Type: constants.TOKEN_LEFT_BRACKET, Lexeme: "[", Line: 1, Column: 18},
+				{Type: constants.TOKEN_STRING, Lexeme: "eu", Line: 1, Column: 19},
+				{Type: constants.TOKEN_COMMA, Lexeme: ",", Line: 1, Column: 23},
+				{Type: constants.TOKEN_STRING, Lexeme: "us", Line: 1, Column: 25},
+				{Type: constants.TOKEN_RIGHT_BRACKET, Lexeme: "]", Line: 1, Column: 29},
+				{Type: constants.TOKEN_NOT_EQUAL, Lexeme: "!=", Line: 1, Column: 31},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "xs", Line: 1, Column: 34},
+				{Type: constants.TOKEN_LEFT_BRACKET, Lexeme: "[", Line: 1, Column: 36},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "0", Line: 1, Column: 37},
+				{Type: constants.TOKEN_RIGHT_BRACKET, Lexeme: "]", Line: 1, Column: 38},
+				{Type: constants.TOKEN_LESS_EQUAL, Lexeme: "<=", Line: 1, Column: 40},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "1", Line: 1, Column: 43},
+				{Type: constants.TOKEN_GREATER_EQUAL, Lexeme: ">=", Line: 1, Column: 45},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "2", Line: 1, Column: 48},
+				{Type: constants.TOKEN_LESS, Lexeme: "<", Line: 1, Column: 50},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "3", Line: 1, Column: 52},
+				{Type: constants.TOKEN_GREATER, Lexeme: ">", Line: 1, Column: 54},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "4", Line: 1, Column: 56},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 57},
+			},
+		},
+		{
+			input: `pool_used2 "a \"b\"" "open`,
+			expected: []constants.Token{
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "pool_used2", Line: 1, Column: 1},
+				{Type: constants.TOKEN_STRING, Lexeme: `a "b"`, Line: 1, Column: 12},
+				{Type: constants.TOKEN_ILLEGAL, Lexeme: `"open`, Line: 1, Column: 22},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 28},
+			},
+		},
+		{
+			input: "forall i in 0..2.5: x",
+			expected: []constants.Token{
+				{Type: constants.TOKEN_FORALL, Lexeme: "forall", Line: 1, Column: 1},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "i", Line: 1, Column: 8},
+				{Type: constants.TOKEN_IN, Lexeme: "in", Line: 1, Column: 10},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "0", Line: 1, Column: 13},
+				{Type: constants.TOKEN_RANGE, Lexeme: "..", Line: 1, Column: 14},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "2.5", Line: 1, Column: 16},
+				{Type: constants.TOKEN_COLON, Lexeme: ":", Line: 1, Column: 19},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "x", Line: 1, Column: 21},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 22},
+			},
+		},
+		{
+			input: "200ms + 1.5GiB",
+			expected: []constants.Token{
+				{Type: constants.TOKEN_QUANTITY, Lexeme: "200ms", Line: 1, Column: 1},
+				{Type: constants.TOKEN_PLUS, Lexeme: "+", Line: 1, Column: 7},
+				{Type: constants.TOKEN_QUANTITY, Lexeme: "1.5GiB", Line: 1, Column: 9},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 15},
+			},
+		},
+		{
+			input: "2024-01-01T12:30:00Z - 2024-01-01 > 30d",
+			expected: []constants.Token{
+				{Type: constants.TOKEN_TIME, Lexeme: "2024-01-01T12:30:00Z", Line: 1, Column: 1},
+				{Type: constants.TOKEN_MINUS, Lexeme: "-", Line: 1, Column: 22},
+				{Type: constants.TOKEN_TIME, Lexeme: "2024-01-01", Line: 1, Column: 24},
+				{Type: constants.TOKEN_GREATER, Lexeme: ">", Line: 1, Column: 35},
+				{Type: constants.TOKEN_QUANTITY, Lexeme: "30d", Line: 1, Column: 37},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 40},
+			},
+		},
+		{
+			input: `var mode: string in {"a", "b"}`,
+			expected: []constants.Token{
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "var", Line: 1, Column: 1},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "mode", Line: 1, Column: 5},
+				{Type: constants.TOKEN_COLON, Lexeme: ":", Line: 1, Column: 9},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "string", Line: 1, Column: 11},
+				{Type: constants.TOKEN_IN, Lexeme: "in", Line: 1, Column: 18},
+				{Type: constants.TOKEN_LEFT_BRACE, Lexeme: "{", Line: 1, Column: 21},
+				{Type: constants.TOKEN_STRING, Lexeme: "a", Line: 1, Column: 22},
+				{Type: constants.TOKEN_COMMA, Lexeme: ",", Line: 1, Column: 25},
+				{Type: constants.TOKEN_STRING, Lexeme: "b", Line: 1, Column: 27},
+				{Type: constants.TOKEN_RIGHT_BRACE, Lexeme: "}", Line: 1, Column: 30},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 31},
+			},
+		},
+		{
+			input: `@smoke assert "db": x @`,
+			expected: []constants.Token{
+				{Type: constants.TOKEN_TAG, Lexeme: "smoke", Line: 1, Column: 1},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "assert", Line: 1, Column: 8},
+				{Type: constants.TOKEN_STRING, Lexeme: "db", Line: 1, Column: 15},
+				{Type: constants.TOKEN_COLON, Lexeme: ":", Line: 1, Column: 19},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "x", Line: 1, Column: 21},
+				{Type: constants.TOKEN_ILLEGAL, Lexeme: "@", Line: 1, Column: 23},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 24},
+			},
+		},
+		{
+			input: "scenario \"a\" { x = 1; y = 2 } | a |",
+			expected: []constants.Token{
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "scenario", Line: 1, Column: 1},
+				{Type: constants.TOKEN_STRING, Lexeme: "a", Line: 1, Column: 10},
+				{Type: constants.TOKEN_LEFT_BRACE, Lexeme: "{", Line: 1, Column: 14},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "x", Line: 1, Column: 16},
+				{Type: constants.TOKEN_EQUAL, Lexeme: "=", Line: 1, Column: 18},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "1", Line: 1, Column: 20},
+				{Type: constants.TOKEN_SEMICOLON, Lexeme: ";", Line: 1, Column: 21},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "y", Line: 1, Column: 23},
+				{Type: constants.TOKEN_EQUAL, Lexeme: "=", Line: 1, Column: 25},
+				{Type: constants.TOKEN_NUMBER, Lexeme: "2", Line: 1, Column: 27},
+				{Type: constants.TOKEN_RIGHT_BRACE, Lexeme: "}", Line: 1, Column: 29},
+				{Type: constants.TOKEN_PIPE, Lexeme: "|", Line: 1, Column: 31},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "a", Line: 1, Column: 33},
+				{Type: constants.TOKEN_PIPE, Lexeme: "|", Line: 1, Column: 35},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 1, Column: 36},
+			},
+		},
+		{
+			input: "include \"a\"\n  import \"b\" as c",
+			expected: []constants.Token{
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "include", Line: 1, Column: 1},
+				{Type: constants.TOKEN_STRING, Lexeme: "a", Line: 1, Column: 9},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "import", Line: 2, Column: 3},
+				{Type: constants.TOKEN_STRING, Lexeme: "b", Line: 2, Column: 10},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "as", Line: 2, Column: 14},
+				{Type: constants.TOKEN_VARIABLE, Lexeme: "c", Line: 2, Column: 17},
+				{Type: constants.TOKEN_EOF, Lexeme: "", Line: 2, Column: 18},
 			},
 		},
 	}
@@ -22,6 +22,7 @@ func main() {
 
 	l := lexer.NewLexer(assertValues)
 	p := parser.NewParser(l)
+	p.SetASTOutput(os.Stdout)
 	program := p.ParseProgram()
 
 	simplifiedResult, errors, isSuccess := program.PartialEvaluate()
@@ -41,16 +42,16 @@ func main() {
 
 	fmt.Println("\nAdding value map for the asserts")
 	
-	program.SetValueMap(valueMap)
 	fmt.Println()
 
 	l = lexer.NewLexer(combinedPartialResults)
 	p = parser.NewParser(l)
 	program = p.ParseProgram()
+	program.SetValueMap(valueMap)
 
-	_, errors, isSuccess = program.Evaluate()
-	if !isSuccess {
-		for _, err := range errors {
+	report := program.Evaluate()
+	if !report.Success() {
+		for _, err := range report.Errors() {
 			fmt.Println(err)
 		}
 		fmt.Println("Asserts Failed [X]")
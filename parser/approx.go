@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Tolerance is used by ~= and approx() to compare floats. Two numbers are
+// approximately equal when they differ by at most Absolute, or by at most
+// Relative times the larger of their magnitudes.
+type Tolerance struct {
+	Absolute float64 `json:"absolute"`
+	Relative float64 `json:"relative"`
+}
+
+var DefaultTolerance = Tolerance{Absolute: 1e-9, Relative: 1e-9}
+
+func approxEqual(a, b float64, t Tolerance) bool {
+	diff := math.Abs(a - b)
+	if diff <= t.Absolute {
+		return true
+	}
+	return diff <= t.Relative*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// approxOf implements approx(a, b), approx(a, b, absolute) and
+// approx(a, b, absolute, relative). Tolerances that are not given come from
+// the program.
+func approxOf(env *Env, args []Value) (Value, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, fmt.Errorf("expected 2 to 4 arguments, got %d", len(args))
+	}
+
+	if left, ok := args[0].(QuantityValue); ok {
+		right, ok := args[1].(QuantityValue)
+		if !ok || left.dimension() != right.dimension() {
+			return nil, fmt.Errorf("cannot compare %s with %s", args[0].String(), args[1].String())
+		}
+		args = append([]Value{NumberValue(left.Amount), NumberValue(right.in(left.Unit))}, args[2:]...)
+	}
+
+	numbers := make([]float64, len(args))
+	for i, arg := range args {
+		number, err := toNumber(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %s", i+1, err)
+		}
+		numbers[i] = number
+	}
+
+	t := env.tolerance()
+	if len(numbers) > 2 {
+		t = Tolerance{Absolute: numbers[2], Relative: 0}
+	}
+	if len(numbers) > 3 {
+		t.Relative = numbers[3]
+	}
+	if t.Absolute < 0 || t.Relative < 0 {
+		return nil, fmt.Errorf("tolerance must not be negative")
+	}
+
+	return truth(approxEqual(numbers[0], numbers[1], t)), nil
+}
+
+// formatApprox renders a residual ~= that does not fold. If the statement uses
+// a tolerance other than the default, it is written out as an approx() call so
+// that the residual keeps its meaning when parsed on its own.
+func formatApprox(env *Env, left, right string) string {
+	tolerance := env.tolerance()
+	if tolerance == DefaultTolerance {
+		return fmt.Sprintf("(%s ~= %s)", left, right)
+	}
+	return fmt.Sprintf("approx(%s, %s, %s, %s)", left, right,
+		strconv.FormatFloat(tolerance.Absolute, 'f', -1, 64), strconv.FormatFloat(tolerance.Relative, 'f', -1, 64))
+}
@@ -3,39 +3,142 @@ package parser
 import (
 	"fmt"
 	"parser/constants"
+	"strings"
 )
 
+// AssertStatement is for statements like assert x > 1 and named, tagged
+// asserts like @smoke assert "db-pool-size": pool >= 10. The require and warn
+// statements are asserts with another severity. After names the asserts that
+// must pass before this one is evaluated, as in
+// assert after "db-up": pool_used < pool_max. Suite is the name of the suite
+// the assert is in, if any.
 type AssertStatement struct {
 	Token      constants.Token
+	Severity   Severity
+	Name       string
+	After      []string
+	Tags       []string
+	Suite      string
 	Expression Expression
+	Where      *WhereTable
+	Span       Span
+
+	// index is the position of the assert among all asserts of the program,
+	// source the text it was parsed from. tolerance is set by a tolerance
+	// pragma of the included file the assert is in.
+	index     int
+	source    string
+	tolerance *Tolerance
 }
 
 func (as *AssertStatement) TokenLiteral() string { return as.Token.Lexeme }
 
-func (as *AssertStatement) Evaluate() (float64, error) {
-	value, err := as.Expression.Evaluate()
+// Children returns the expression of the assert followed by the cells of its
+// where table, row by row.
+func (as *AssertStatement) Children() []Node {
+	children := []Node{as.Expression}
+	if as.Where != nil {
+		for _, row := range as.Where.Rows {
+			children = append(children, toNodes(row)...)
+		}
+	}
+	return children
+}
+
+func (as *AssertStatement) setChildren(children []Node) {
+	as.Expression = children[0].(Expression)
+	if as.Where != nil {
+		cells := toExpressions(children[1:])
+		for _, row := range as.Where.Rows {
+			copy(row, cells)
+			cells = cells[len(row):]
+		}
+	}
+}
+
+func (as *AssertStatement) Evaluate(env *Env) (float64, error) {
+	env = env.withTolerance(as.tolerance).recordingFailures()
+	value, err := as.Expression.Evaluate(env)
 	if err != nil {
 		return -1, err
 	}
 
-	fmt.Println("Assert value:", value)
-
 	if value != 0 {
-		return value, fmt.Errorf("assertion failed: %s", as.Expression.String())
+		failure := &AssertionError{Expression: as.Expression.String(), Explanation: env.failure(as.Expression)}
+		return value, failure
 	}
 
 	return value, nil
 }
 
-func (as *AssertStatement) PartialEvaluate() (string, error) {
-	value, err := as.Expression.PartialEvaluate()
+// AssertionError is returned when an assert was evaluated and does not hold,
+// as opposed to an assert that could not be evaluated.
+type AssertionError struct {
+	Expression  string
+	Explanation string
+}
+
+func (e *AssertionError) Error() string {
+	if e.Explanation != "" {
+		return fmt.Sprintf("assertion failed: %s: %s", e.Expression, e.Explanation)
+	}
+	return fmt.Sprintf("assertion failed: %s", e.Expression)
+}
+
+func (as *AssertStatement) PartialEvaluate(env *Env) (string, error) {
+	value, err := as.Expression.PartialEvaluate(env.withTolerance(as.tolerance))
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("assert %s", value), nil
+	return as.withTable(fmt.Sprintf("%s %s", as.header(), value)), nil
 }
 
 func (as *AssertStatement) String() string {
-	return fmt.Sprintf("assert %s", as.Expression.String())
+	return as.withTable(fmt.Sprintf("%s %s", as.header(), as.Expression.String()))
+}
+
+func (as *AssertStatement) withTable(s string) string {
+	if as.Where == nil {
+		return s
+	}
+	return s + " " + as.Where.String()
+}
+
+func (as *AssertStatement) header() string {
+	header := formatTags(as.Tags) + as.Severity.String()
+	if as.Name != "" {
+		header += fmt.Sprintf(" %q", as.Name)
+	}
+	if len(as.After) > 0 {
+		after := make([]string, len(as.After))
+		for i, name := range as.After {
+			after[i] = fmt.Sprintf("%q", name)
+		}
+		header += " after " + strings.Join(after, ", ")
+	}
+	if as.Name != "" || len(as.After) > 0 {
+		header += ":"
+	}
+	return header
+}
+
+// label names the assert in messages, by its name if it has one.
+func (as *AssertStatement) label() string {
+	if as.Name != "" {
+		return fmt.Sprintf("%s %q", as.Severity, as.Name)
+	}
+	return fmt.Sprintf("statement %d", as.number())
+}
+
+// number is the one-based position of the assert, used in messages and
+// results.
+func (as *AssertStatement) number() int { return as.index + 1 }
+
+func formatTags(tags []string) string {
+	var out strings.Builder
+	for _, tag := range tags {
+		out.WriteString("@" + tag + " ")
+	}
+	return out.String()
 }
@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"parser/constants"
+)
+
+// AssumeStatement states a fact about the variables, e.g. assume x > 0. It
+// does not produce a result: partial evaluation uses it to simplify asserts,
+// and evaluation reports values that break it separately from failed asserts.
+// Assumptions are collected into the Program while parsing.
+type AssumeStatement struct {
+	Token      constants.Token
+	Expression Expression
+
+	// tolerance is set by a tolerance pragma of the included file the
+	// assumption is in.
+	tolerance *Tolerance
+}
+
+func (as *AssumeStatement) TokenLiteral() string { return as.Token.Lexeme }
+
+func (as *AssumeStatement) Children() []Node { return []Node{as.Expression} }
+
+func (as *AssumeStatement) setChildren(children []Node) { as.Expression = children[0].(Expression) }
+
+func (as *AssumeStatement) Evaluate(env *Env) (float64, error) { return 0, nil }
+
+func (as *AssumeStatement) PartialEvaluate(env *Env) (string, error) {
+	value, err := as.Expression.PartialEvaluate(env.withTolerance(as.tolerance))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("assume %s", value), nil
+}
+
+func (as *AssumeStatement) String() string {
+	return fmt.Sprintf("assume %s", as.Expression.String())
+}
+
+// check reports an error when the values break the assumption. An assumption
+// about a missing variable is not broken.
+func (as *AssumeStatement) check(env *Env) error {
+	env = env.withTolerance(as.tolerance).recordingFailures()
+	value, err := as.Expression.EvaluateValue(env)
+	if isMissing(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	holds, err := isTrue(value)
+	if err != nil {
+		return err
+	}
+	if !holds {
+		if reason := env.failure(as.Expression); reason != "" {
+			return fmt.Errorf("assumption broken: %s: %s", as.Expression.String(), reason)
+		}
+		return fmt.Errorf("assumption broken: %s", as.Expression.String())
+	}
+	return nil
+}
+
+// bounds is the interval a partially evaluated expression is assumed to lie
+// in. nonzero is set by assume x != 0.
+type bounds struct {
+	low, high         float64
+	lowOpen, highOpen bool
+	nonzero           bool
+}
+
+func (b *bounds) restrict(operator string, c float64) {
+	switch operator {
+	case ">":
+		if c > b.low || (c == b.low && !b.lowOpen) {
+			b.low, b.lowOpen = c, true
+		}
+	case ">=":
+		if c > b.low {
+			b.low, b.lowOpen = c, false
+		}
+	case "<":
+		if c < b.high || (c == b.high && !b.highOpen) {
+			b.high, b.highOpen = c, true
+		}
+	case "<=":
+		if c < b.high {
+			b.high, b.highOpen = c, false
+		}
+	case "==":
+		b.restrict(">=", c)
+		b.restrict("<=", c)
+	case "!=":
+		if c == 0 {
+			b.nonzero = true
+		}
+	}
+}
+
+func (b bounds) excludesZero() bool {
+	return b.nonzero || b.low > 0 || (b.low == 0 && b.lowOpen) || b.high < 0 || (b.high == 0 && b.highOpen)
+}
+
+// decide reports whether x operator c holds for every x in the bounds, and
+// whether that is known at all.
+func (b bounds) decide(operator string, c float64) (holds bool, decided bool) {
+	above := b.low > c || (b.low == c && b.lowOpen)
+	atLeast := b.low >= c
+	below := b.high < c || (b.high == c && b.highOpen)
+	atMost := b.high <= c
+
+	switch operator {
+	case ">":
+		return above, above || atMost
+	case ">=":
+		return atLeast, atLeast || below
+	case "<":
+		return below, below || atLeast
+	case "<=":
+		return atMost, atMost || above
+	case "==":
+		return atLeast && atMost, (atLeast && atMost) || above || below
+	case "!=":
+		return above || below, (atLeast && atMost) || above || below
+	default:
+		return false, false
+	}
+}
+
+// facts are what the assumptions of a program say about the partially
+// evaluated expressions of its asserts.
+type facts struct {
+	holds  map[string]bool
+	bounds map[string]*bounds
+}
+
+// newFacts collects the comparisons of the assumptions. A comparison of an
+// expression with a number also bounds that expression.
+func newFacts(assumptions []*AssumeStatement) (facts, error) {
+	f := facts{holds: map[string]bool{}, bounds: map[string]*bounds{}}
+
+	for _, assumption := range assumptions {
+		switch expr := assumption.Expression.(type) {
+		case *InfixExpression:
+			if err := f.add(expr.Operator, expr.Left, expr.Right); err != nil {
+				return facts{}, err
+			}
+		case *ChainedComparison:
+			for i, operator := range expr.Operators {
+				if err := f.add(operator, expr.Operands[i], expr.Operands[i+1]); err != nil {
+					return facts{}, err
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+func (f facts) add(operator string, leftExpr, rightExpr Expression) error {
+	left, err := leftExpr.PartialEvaluate(nil)
+	if err != nil {
+		return err
+	}
+	right, err := rightExpr.PartialEvaluate(nil)
+	if err != nil {
+		return err
+	}
+
+	f.holds[fmt.Sprintf("(%s %s %s)", left, operator, right)] = true
+
+	if c, ok := constantNumber(right); ok {
+		f.boundsOf(left).restrict(operator, c)
+	} else if c, ok := constantNumber(left); ok {
+		f.boundsOf(right).restrict(flipComparison(operator), c)
+	}
+	return nil
+}
+
+func (f facts) boundsOf(partial string) *bounds {
+	b, ok := f.bounds[partial]
+	if !ok {
+		b = &bounds{low: math.Inf(-1), high: math.Inf(1)}
+		f.bounds[partial] = b
+	}
+	return b
+}
+
+// decide reports whether left operator right is known to hold, or known not
+// to hold, under the assumptions.
+func (f facts) decide(operator, left, right string) (holds bool, decided bool) {
+	if f.holds[fmt.Sprintf("(%s %s %s)", left, operator, right)] {
+		return true, true
+	}
+
+	if c, ok := constantNumber(right); ok {
+		if b, ok := f.bounds[left]; ok {
+			return b.decide(operator, c)
+		}
+	}
+	if c, ok := constantNumber(left); ok {
+		if b, ok := f.bounds[right]; ok {
+			return b.decide(flipComparison(operator), c)
+		}
+	}
+	return false, false
+}
+
+// simplify folds left operator right using the assumptions, e.g. x / x is 1
+// when x is assumed to be positive.
+func (f facts) simplify(operator, left, right string) (string, bool) {
+	switch operator {
+	case "/":
+		if b, ok := f.bounds[left]; ok && left == right && b.excludesZero() {
+			return NumberValue(1).String(), true
+		}
+	case "<", "<=", ">", ">=", "==", "!=":
+		if holds, ok := f.decide(operator, left, right); ok {
+			return truth(holds).String(), true
+		}
+	}
+	return "", false
+}
+
+func constantNumber(partial string) (float64, bool) {
+	value, ok := constantValue(partial)
+	if !ok {
+		return 0, false
+	}
+	number, ok := value.(NumberValue)
+	return float64(number), ok
+}
+
+func flipComparison(operator string) string {
+	switch operator {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	default:
+		return operator
+	}
+}
@@ -0,0 +1,654 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"parser/constants"
+	"parser/lexer"
+)
+
+// SchemaVersion is the version of the JSON form of programs. It changes when
+// a change of the form would break existing readers.
+const SchemaVersion = 1
+
+// programJSON is the JSON form of a program:
+//
+//	{
+//	  "version": 1,
+//	  "statements": [
+//	    {"type": "assert", "severity": "assert", "source": "assert x > 1", "span": ..., "expression": ...}
+//	  ]
+//	}
+//
+// Every node has the span of the source it was parsed from and the position
+// of its token, the operator of an operation. Assumptions, scenarios and
+// variable declarations follow the statements in lists of their own.
+type programJSON struct {
+	Version      int              `json:"version"`
+	Tolerance    *Tolerance       `json:"tolerance,omitempty"`
+	Statements   []*statementJSON `json:"statements"`
+	Assumptions  []*statementJSON `json:"assumptions,omitempty"`
+	Scenarios    []*statementJSON `json:"scenarios,omitempty"`
+	Declarations []*statementJSON `json:"declarations,omitempty"`
+}
+
+// statementJSON is the JSON form of a statement. Type is "assert", "assume",
+// "when" or "suite"; a when block has its guard as expression, and blocks
+// have the statements they hold. Scenarios and variable declarations are
+// "scenario" and "var" with their source only.
+type statementJSON struct {
+	Type       string           `json:"type"`
+	Severity   string           `json:"severity,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	Tags       []string         `json:"tags,omitempty"`
+	After      []string         `json:"after,omitempty"`
+	Suite      string           `json:"suite,omitempty"`
+	Source     string           `json:"source,omitempty"`
+	Tolerance  *Tolerance       `json:"tolerance,omitempty"`
+	Span       Span             `json:"span"`
+	Position   Position         `json:"position"`
+	Expression *expressionJSON  `json:"expression,omitempty"`
+	Where      *whereJSON       `json:"where,omitempty"`
+	Statements []*statementJSON `json:"statements,omitempty"`
+}
+
+// whereJSON is the where table of an assert, its rows holding one expression
+// per column.
+type whereJSON struct {
+	Columns  []string            `json:"columns"`
+	Rows     [][]*expressionJSON `json:"rows"`
+	Position Position            `json:"position"`
+}
+
+// expressionJSON is the JSON form of an expression. Type is "infix",
+// "prefix", "chain", "variable", "number", "string" or "list"; the other
+// fields are set as the type needs them. The other expressions, calls,
+// quantifiers, conditionals, index and member expressions, ranges,
+// quantities and times, have their type and their source only, see
+// sourceTypes.
+type expressionJSON struct {
+	Type      string            `json:"type"`
+	Operator  string            `json:"operator,omitempty"`
+	Operators []string          `json:"operators,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Value     *float64          `json:"value,omitempty"`
+	Literal   string            `json:"literal,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Left      *expressionJSON   `json:"left,omitempty"`
+	Right     *expressionJSON   `json:"right,omitempty"`
+	Operands  []*expressionJSON `json:"operands,omitempty"`
+	Elements  []*expressionJSON `json:"elements,omitempty"`
+	Span      Span              `json:"span"`
+	Position  Position          `json:"position"`
+}
+
+// MarshalJSON encodes the statements, assumptions, scenarios and variable
+// declarations of the program and the tolerances set by its pragmas, for the
+// program and for the statements of included files. Lets and defs are not
+// encoded: the calls of a def are inlined.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	program := programJSON{Version: SchemaVersion, Tolerance: p.Tolerance, Statements: []*statementJSON{}}
+	for _, stmt := range p.Statements {
+		encoded, err := encodeStatement(stmt)
+		if err != nil {
+			return nil, err
+		}
+		program.Statements = append(program.Statements, encoded)
+	}
+	for _, assumption := range p.Assumptions {
+		encoded, err := encodeStatement(assumption)
+		if err != nil {
+			return nil, err
+		}
+		program.Assumptions = append(program.Assumptions, encoded)
+	}
+	for _, scenario := range p.Scenarios {
+		program.Scenarios = append(program.Scenarios, &statementJSON{Type: "scenario", Source: scenario.String(), Position: positionOf(scenario.Token)})
+	}
+	for _, name := range declaredNames(p.Declarations) {
+		declaration := p.Declarations[name]
+		program.Declarations = append(program.Declarations, &statementJSON{Type: "var", Source: declaration.String(), Position: positionOf(declaration.Token)})
+	}
+	return json.Marshal(program)
+}
+
+// UnmarshalJSON decodes a program encoded by MarshalJSON. It replaces the
+// statements and settings of p.
+func (p *Program) UnmarshalJSON(data []byte) error {
+	var program programJSON
+	if err := json.Unmarshal(data, &program); err != nil {
+		return err
+	}
+	if program.Version != SchemaVersion {
+		return fmt.Errorf("unsupported schema version %d, expected %d", program.Version, SchemaVersion)
+	}
+
+	*p = Program{Tolerance: program.Tolerance}
+	for i, encoded := range program.Statements {
+		stmt, err := decodeStatement(encoded)
+		if err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		p.Statements = append(p.Statements, stmt)
+	}
+	for i, encoded := range program.Assumptions {
+		stmt, err := decodeStatement(encoded)
+		if err != nil {
+			return fmt.Errorf("assumption %d: %w", i+1, err)
+		}
+		assumption, ok := stmt.(*AssumeStatement)
+		if !ok {
+			return fmt.Errorf("assumption %d: expected an assumption, got %s", i+1, encoded.Type)
+		}
+		p.Assumptions = append(p.Assumptions, assumption)
+	}
+	for i, encoded := range program.Scenarios {
+		if err := decodeSource(p, encoded, "scenario"); err != nil {
+			return fmt.Errorf("scenario %d: %w", i+1, err)
+		}
+	}
+	for i, encoded := range program.Declarations {
+		if err := decodeSource(p, encoded, "var"); err != nil {
+			return fmt.Errorf("declaration %d: %w", i+1, err)
+		}
+	}
+
+	index := 0
+	forEachAssert(p.Statements, nil, func(as *AssertStatement, _ []string) {
+		as.index = index
+		index++
+	})
+	return nil
+}
+
+// MarshalExpression encodes an expression in the JSON form of expressions of
+// programs.
+func MarshalExpression(e Expression) ([]byte, error) {
+	encoded, err := encodeExpression(e)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalExpression decodes an expression encoded by MarshalExpression.
+func UnmarshalExpression(data []byte) (Expression, error) {
+	var encoded expressionJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	return decodeExpression(&encoded)
+}
+
+func encodeStatement(stmt Statement) (*statementJSON, error) {
+	switch s := stmt.(type) {
+	case *AssertStatement:
+		expression, err := encodeExpression(s.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.label(), err)
+		}
+		encoded := &statementJSON{
+			Type:       "assert",
+			Severity:   s.Severity.String(),
+			Name:       s.Name,
+			Tags:       s.Tags,
+			After:      s.After,
+			Suite:      s.Suite,
+			Source:     s.source,
+			Tolerance:  s.tolerance,
+			Span:       s.Span,
+			Position:   positionOf(s.Token),
+			Expression: expression,
+		}
+		if s.Where != nil {
+			encoded.Where = &whereJSON{Columns: s.Where.Columns, Rows: [][]*expressionJSON{}, Position: positionOf(s.Where.Token)}
+			for _, row := range s.Where.Rows {
+				cells, err := encodeExpressions(row)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", s.label(), err)
+				}
+				encoded.Where.Rows = append(encoded.Where.Rows, cells)
+			}
+		}
+		return encoded, nil
+
+	case *AssumeStatement:
+		expression, err := encodeExpression(s.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.String(), err)
+		}
+		return &statementJSON{Type: "assume", Tolerance: s.tolerance, Position: positionOf(s.Token), Expression: expression}, nil
+
+	case *WhenBlock:
+		guard, err := encodeExpression(s.Guard)
+		if err != nil {
+			return nil, fmt.Errorf("when %s: %w", s.Guard.String(), err)
+		}
+		statements, err := encodeStatements(s.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return &statementJSON{Type: "when", Tags: s.Tags, Tolerance: s.tolerance, Position: positionOf(s.Token), Expression: guard, Statements: statements}, nil
+
+	case *SuiteBlock:
+		statements, err := encodeStatements(s.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return &statementJSON{Type: "suite", Name: s.Name, Tags: s.Tags, Position: positionOf(s.Token), Statements: statements}, nil
+
+	default:
+		return nil, fmt.Errorf("cannot encode %s statements as JSON", stmt.TokenLiteral())
+	}
+}
+
+func encodeStatements(statements []Statement) ([]*statementJSON, error) {
+	encoded := []*statementJSON{}
+	for _, stmt := range statements {
+		s, err := encodeStatement(stmt)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, s)
+	}
+	return encoded, nil
+}
+
+func decodeStatement(encoded *statementJSON) (Statement, error) {
+	if encoded == nil {
+		return nil, fmt.Errorf("missing statement")
+	}
+
+	switch encoded.Type {
+	case "assert":
+		severity, ok := map[string]Severity{"assert": SeverityAssert, "require": SeverityRequire, "warn": SeverityWarn}[encoded.Severity]
+		if !ok {
+			return nil, fmt.Errorf("unknown severity %q", encoded.Severity)
+		}
+		expression, err := decodeExpression(encoded.Expression)
+		if err != nil {
+			return nil, err
+		}
+		as := &AssertStatement{
+			Token:      tokenAt(encoded.Severity, encoded.Position),
+			Severity:   severity,
+			Name:       encoded.Name,
+			Tags:       encoded.Tags,
+			After:      encoded.After,
+			Suite:      encoded.Suite,
+			Expression: expression,
+			Span:       encoded.Span,
+			source:     encoded.Source,
+			tolerance:  encoded.Tolerance,
+		}
+		if encoded.Where != nil {
+			as.Where = &WhereTable{Token: tokenAt("where", encoded.Where.Position), Columns: encoded.Where.Columns}
+			for _, row := range encoded.Where.Rows {
+				cells, err := decodeExpressions(row)
+				if err != nil {
+					return nil, err
+				}
+				as.Where.Rows = append(as.Where.Rows, cells)
+			}
+			if err := as.Where.check(); err != nil {
+				return nil, err
+			}
+		}
+		return as, nil
+
+	case "assume":
+		expression, err := decodeExpression(encoded.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return &AssumeStatement{Token: tokenAt("assume", encoded.Position), Expression: expression, tolerance: encoded.Tolerance}, nil
+
+	case "when":
+		guard, err := decodeExpression(encoded.Expression)
+		if err != nil {
+			return nil, err
+		}
+		statements, err := decodeStatements(encoded.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return &WhenBlock{Token: tokenAt("when", encoded.Position), Guard: guard, Tags: encoded.Tags, Statements: statements, tolerance: encoded.Tolerance}, nil
+
+	case "suite":
+		statements, err := decodeStatements(encoded.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return &SuiteBlock{Token: tokenAt("suite", encoded.Position), Name: encoded.Name, Tags: encoded.Tags, Statements: statements}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown statement type %q", encoded.Type)
+	}
+}
+
+func decodeStatements(encoded []*statementJSON) ([]Statement, error) {
+	var statements []Statement
+	for _, s := range encoded {
+		stmt, err := decodeStatement(s)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := stmt.(*AssumeStatement); ok {
+			return nil, fmt.Errorf("assume is not allowed in a block")
+		}
+		statements = append(statements, stmt)
+	}
+	return statements, nil
+}
+
+// decodeSource parses a scenario or variable declaration encoded by its
+// source and declares it in the program.
+func decodeSource(program *Program, encoded *statementJSON, kind string) error {
+	if encoded == nil {
+		return fmt.Errorf("missing %s", kind)
+	}
+	if encoded.Type != kind {
+		return fmt.Errorf("expected %s, got %q", kind, encoded.Type)
+	}
+
+	p := &Parser{l: lexer.NewLexer(encoded.Source), errors: []string{}, modules: newModules(nil)}
+	p.nextToken()
+	p.nextToken()
+	stmt := p.parseStatement()
+	if len(p.errors) > 0 {
+		return fmt.Errorf("%s", p.errors[0])
+	}
+
+	position := encoded.Position
+	switch s := stmt.(type) {
+	case *ScenarioBlock:
+		if kind == "scenario" {
+			s.Token.Line, s.Token.Column, s.Token.File = position.Line, position.Column, position.File
+			return s.declare(program)
+		}
+	case *VarDeclaration:
+		if kind == "var" {
+			s.Token.Line, s.Token.Column, s.Token.File = position.Line, position.Column, position.File
+			return s.declare(program)
+		}
+	}
+	return fmt.Errorf("%q is not a %s", encoded.Source, kind)
+}
+
+func encodeExpression(e Expression) (*expressionJSON, error) {
+	encoded := &expressionJSON{Span: spanOf(e)}
+
+	switch expr := e.(type) {
+	case *InfixExpression:
+		left, err := encodeExpression(expr.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := encodeExpression(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Type, encoded.Operator, encoded.Left, encoded.Right = "infix", expr.Operator, left, right
+		encoded.Position = positionOf(expr.Token)
+
+	case *PrefixExpression:
+		right, err := encodeExpression(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Type, encoded.Operator, encoded.Right = "prefix", expr.Operator, right
+		encoded.Position = positionOf(expr.Token)
+
+	case *ChainedComparison:
+		operands, err := encodeExpressions(expr.Operands)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Type, encoded.Operators, encoded.Operands = "chain", expr.Operators, operands
+		encoded.Position = positionOf(expr.Token)
+
+	case *Variable:
+		encoded.Type, encoded.Name = "variable", expr.Value
+		encoded.Position = positionOf(expr.Token)
+
+	case *NumberLiteral:
+		value := expr.Value
+		encoded.Type, encoded.Value, encoded.Literal = "number", &value, expr.Token.Lexeme
+		encoded.Position = positionOf(expr.Token)
+
+	case *StringLiteral:
+		encoded.Type, encoded.Literal = "string", expr.Value
+		encoded.Position = positionOf(expr.Token)
+
+	case *ListLiteral:
+		elements, err := encodeExpressions(expr.Elements)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Type, encoded.Elements = "list", elements
+		encoded.Position = positionOf(expr.Token)
+
+	default:
+		kind, tok := sourceExpression(e)
+		if tok == nil {
+			return nil, fmt.Errorf("cannot encode %s as JSON", e.String())
+		}
+		if callsDefinition(e) {
+			return encodeInlined(e)
+		}
+		encoded.Type, encoded.Source = kind, e.String()
+		encoded.Position = positionOf(*tok)
+	}
+	return encoded, nil
+}
+
+// encodeInlined encodes an expression that calls a def with the calls
+// inlined, the way partial evaluation inlines them, as the defs are not part
+// of the JSON form.
+func encodeInlined(e Expression) (*expressionJSON, error) {
+	inlined, err := e.PartialEvaluate(&Env{})
+	if err == nil {
+		var expression Expression
+		expression, err = parseExpressionSource(inlined)
+		if err == nil {
+			return encodeExpression(expression)
+		}
+	}
+	return nil, fmt.Errorf("cannot encode %s as JSON: %w", e.String(), err)
+}
+
+func callsDefinition(e Expression) bool {
+	calls := false
+	Walk(e, func(node Node) bool {
+		if call, ok := node.(*CallExpression); ok && call.definition != nil {
+			calls = true
+		}
+		return !calls
+	})
+	return calls
+}
+
+func encodeExpressions(exprs []Expression) ([]*expressionJSON, error) {
+	encoded := []*expressionJSON{}
+	for _, e := range exprs {
+		expression, err := encodeExpression(e)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, expression)
+	}
+	return encoded, nil
+}
+
+func decodeExpression(encoded *expressionJSON) (Expression, error) {
+	if encoded == nil {
+		return nil, fmt.Errorf("missing expression")
+	}
+
+	switch encoded.Type {
+	case "infix":
+		if !infixOperators[encoded.Operator] {
+			return nil, fmt.Errorf("unknown infix operator %q", encoded.Operator)
+		}
+		left, err := decodeExpression(encoded.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := decodeExpression(encoded.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &InfixExpression{Token: tokenAt(encoded.Operator, encoded.Position), Operator: encoded.Operator, Left: left, Right: right}, nil
+
+	case "prefix":
+		if encoded.Operator != "-" && encoded.Operator != "!" {
+			return nil, fmt.Errorf("unknown prefix operator %q", encoded.Operator)
+		}
+		right, err := decodeExpression(encoded.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &PrefixExpression{Token: tokenAt(encoded.Operator, encoded.Position), Operator: encoded.Operator, Right: right}, nil
+
+	case "chain":
+		if len(encoded.Operands) < 2 || len(encoded.Operators) != len(encoded.Operands)-1 {
+			return nil, fmt.Errorf("chain of %d operands with %d operators", len(encoded.Operands), len(encoded.Operators))
+		}
+		for _, operator := range encoded.Operators {
+			if !infixOperators[operator] || !isComparisonOperator(operator) {
+				return nil, fmt.Errorf("unknown comparison operator %q", operator)
+			}
+		}
+		operands, err := decodeExpressions(encoded.Operands)
+		if err != nil {
+			return nil, err
+		}
+		return &ChainedComparison{Token: tokenAt(encoded.Operators[0], encoded.Position), Operands: operands, Operators: encoded.Operators}, nil
+
+	case "variable":
+		if encoded.Name == "" {
+			return nil, fmt.Errorf("variable without a name")
+		}
+		return &Variable{Token: tokenAt(encoded.Name, encoded.Position), Value: encoded.Name}, nil
+
+	case "number":
+		if encoded.Value == nil {
+			return nil, fmt.Errorf("number without a value")
+		}
+		literal := encoded.Literal
+		if literal == "" {
+			literal = fmt.Sprint(*encoded.Value)
+		}
+		return &NumberLiteral{Token: tokenAt(literal, encoded.Position), Value: *encoded.Value}, nil
+
+	case "string":
+		tok := tokenAt(encoded.Literal, encoded.Position)
+		tok.Type = constants.TOKEN_STRING
+		return &StringLiteral{Token: tok, Value: encoded.Literal}, nil
+
+	case "list":
+		elements, err := decodeExpressions(encoded.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return &ListLiteral{Token: tokenAt("[", encoded.Position), Elements: elements}, nil
+
+	default:
+		if !sourceTypes[encoded.Type] {
+			return nil, fmt.Errorf("unknown expression type %q", encoded.Type)
+		}
+		if encoded.Source == "" {
+			return nil, fmt.Errorf("%s without a source", encoded.Type)
+		}
+		expression, err := parseExpressionSource(encoded.Source)
+		if err != nil {
+			return nil, err
+		}
+		kind, tok := sourceExpression(expression)
+		if kind != encoded.Type {
+			return nil, fmt.Errorf("%q is not a %s", encoded.Source, encoded.Type)
+		}
+		tok.Line, tok.Column, tok.File = encoded.Position.Line, encoded.Position.Column, encoded.Position.File
+		return expression, nil
+	}
+}
+
+func decodeExpressions(encoded []*expressionJSON) ([]Expression, error) {
+	expressions := []Expression{}
+	for _, e := range encoded {
+		expression, err := decodeExpression(e)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expression)
+	}
+	return expressions, nil
+}
+
+// sourceTypes are the types of the expressions that are encoded by their
+// source, and decoded by parsing it again.
+var sourceTypes = map[string]bool{
+	"call": true, "quantifier": true, "conditional": true, "index": true,
+	"member": true, "range": true, "quantity": true, "time": true,
+}
+
+// sourceExpression returns the type and the token of an expression that is
+// encoded by its source, and a nil token for the others.
+func sourceExpression(e Expression) (string, *constants.Token) {
+	switch expr := e.(type) {
+	case *CallExpression:
+		return "call", &expr.Token
+	case *QuantifierExpression:
+		return "quantifier", &expr.Token
+	case *ConditionalExpression:
+		return "conditional", &expr.Token
+	case *IndexExpression:
+		return "index", &expr.Token
+	case *MemberExpression:
+		return "member", &expr.Token
+	case *RangeExpression:
+		return "range", &expr.Token
+	case *QuantityLiteral:
+		return "quantity", &expr.Token
+	case *TimeLiteral:
+		return "time", &expr.Token
+	default:
+		return "", nil
+	}
+}
+
+// parseExpressionSource parses an expression encoded by its source. Calls of
+// a def cannot be decoded, as the program they were parsed with is not at
+// hand.
+func parseExpressionSource(source string) (Expression, error) {
+	p := &Parser{l: lexer.NewLexer(source), errors: []string{}, modules: newModules(nil)}
+	p.nextToken()
+	p.nextToken()
+
+	expr := p.parseExpression(LOWEST)
+	if len(p.errors) > 0 {
+		return nil, fmt.Errorf("%s: %s", source, p.errors[0])
+	}
+	if expr == nil || !p.peekTokenIs(constants.TOKEN_EOF) {
+		return nil, fmt.Errorf("%q is not an expression", source)
+	}
+	return expr, nil
+}
+
+var infixOperators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "??": true, "in": true,
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "~=": true,
+}
+
+func positionOf(tok constants.Token) Position {
+	return Position{File: tok.File, Line: tok.Line, Column: tok.Column}
+}
+
+// tokenAt returns the token of a lexeme, with the type the lexer gives it, at
+// a position.
+func tokenAt(lexeme string, position Position) constants.Token {
+	tok := lexer.NewLexer(lexeme).NewToken()
+	tok.Lexeme = lexeme
+	tok.Line, tok.Column, tok.File = position.Line, position.Column, position.File
+	return tok
+}
@@ -0,0 +1,203 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type builtinFunction func(env *Env, args []Value) (Value, error)
+
+// builtins are the functions that can be called from an assert.
+var builtins = map[string]builtinFunction{
+	"sum":        aggregate(sumOf),
+	"avg":        aggregate(avgOf),
+	"min":        aggregate(minOf),
+	"max":        aggregate(maxOf),
+	"count":      countOf,
+	"len":        countOf,
+	"percentile": percentileOf,
+	"defined":    definedOf,
+	"approx":     approxOf,
+	"now":        nowOf,
+	"time":       timeOf,
+}
+
+// impureBuiltins are never folded during partial evaluation, as their result
+// depends on when the program is evaluated.
+var impureBuiltins = map[string]bool{
+	"now": true,
+}
+
+func callBuiltin(env *Env, name string, args []Value) (Value, error) {
+	fn, ok := builtins[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+
+	value, err := fn(env, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return value, nil
+}
+
+// aggregate adapts a function over a list of numbers into a builtin that
+// takes a single list argument. A list of quantities is aggregated in the
+// unit of its first element.
+func aggregate(fn func([]float64) (float64, error)) builtinFunction {
+	return func(env *Env, args []Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+		}
+
+		numbers, unitName, err := toNumbers(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := fn(numbers)
+		if err != nil {
+			return nil, err
+		}
+		return withUnit(result, unitName), nil
+	}
+}
+
+// toNumbers returns the elements of a list of numbers, or of a list of
+// quantities converted into the unit of the first one, which is also returned.
+func toNumbers(v Value) ([]float64, string, error) {
+	list, err := toList(v)
+	if err != nil {
+		return nil, "", err
+	}
+
+	unitName := ""
+	if len(list) > 0 {
+		if quantity, ok := list[0].(QuantityValue); ok {
+			unitName = quantity.Unit
+		}
+	}
+
+	numbers := make([]float64, len(list))
+	for i, element := range list {
+		if unitName == "" {
+			number, err := toNumber(element)
+			if err != nil {
+				return nil, "", fmt.Errorf("element %d: %s", i, err)
+			}
+			numbers[i] = number
+			continue
+		}
+
+		quantity, ok := element.(QuantityValue)
+		if !ok || quantity.dimension() != units[unitName].Dimension {
+			return nil, "", fmt.Errorf("element %d: expected %s, got %s", i, units[unitName].Dimension, element.String())
+		}
+		numbers[i] = quantity.in(unitName)
+	}
+	return numbers, unitName, nil
+}
+
+func withUnit(number float64, unitName string) Value {
+	if unitName == "" {
+		return NumberValue(number)
+	}
+	return QuantityValue{Amount: number, Unit: unitName}
+}
+
+func sumOf(numbers []float64) (float64, error) {
+	total := 0.0
+	for _, number := range numbers {
+		total += number
+	}
+	return total, nil
+}
+
+func avgOf(numbers []float64) (float64, error) {
+	if len(numbers) == 0 {
+		return 0, fmt.Errorf("empty list")
+	}
+	total, _ := sumOf(numbers)
+	return total / float64(len(numbers)), nil
+}
+
+func minOf(numbers []float64) (float64, error) {
+	if len(numbers) == 0 {
+		return 0, fmt.Errorf("empty list")
+	}
+	result := math.Inf(1)
+	for _, number := range numbers {
+		result = math.Min(result, number)
+	}
+	return result, nil
+}
+
+func maxOf(numbers []float64) (float64, error) {
+	if len(numbers) == 0 {
+		return 0, fmt.Errorf("empty list")
+	}
+	result := math.Inf(-1)
+	for _, number := range numbers {
+		result = math.Max(result, number)
+	}
+	return result, nil
+}
+
+func countOf(env *Env, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	switch value := args[0].(type) {
+	case ListValue:
+		return NumberValue(len(value)), nil
+	case StringValue:
+		return NumberValue(len(value)), nil
+	default:
+		return nil, fmt.Errorf("expected list, got %s", value.Type())
+	}
+}
+
+// definedOf is only reached for constant arguments, which are always defined.
+// Arguments read from the value map are handled by CallExpression.
+func definedOf(env *Env, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+	return truth(true), nil
+}
+
+// percentileOf returns the p-th percentile (0 to 100) of a list, linearly
+// interpolating between the closest ranks.
+func percentileOf(env *Env, args []Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	numbers, unitName, err := toNumbers(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("empty list")
+	}
+
+	p, err := toNumber(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if p < 0 || p > 100 {
+		return nil, fmt.Errorf("percentile must be between 0 and 100, got %v", p)
+	}
+
+	sorted := append([]float64(nil), numbers...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	fraction := rank - float64(lower)
+
+	return withUnit(sorted[lower]+(sorted[upper]-sorted[lower])*fraction, unitName), nil
+}
@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// CallExpression is for built-in function calls like sum(xs) or max(errors),
+// and calls of a def like limits.within(x, 0, 10).
+type CallExpression struct {
+	Token     constants.Token
+	Function  string
+	Arguments []Expression
+
+	definition *Definition
+}
+
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Lexeme }
+
+func (ce *CallExpression) Children() []Node { return toNodes(ce.Arguments) }
+
+func (ce *CallExpression) setChildren(children []Node) { ce.Arguments = toExpressions(children) }
+
+func (ce *CallExpression) Evaluate(env *Env) (float64, error) { return evaluateNumber(ce, env) }
+
+func (ce *CallExpression) EvaluateValue(env *Env) (Value, error) {
+	if ce.Function == "defined" {
+		return ce.evaluateDefined(env)
+	}
+
+	args := make([]Value, len(ce.Arguments))
+	for i, argument := range ce.Arguments {
+		value, err := env.evaluate(argument)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	return ce.call(env, args)
+}
+
+func (ce *CallExpression) call(env *Env, args []Value) (Value, error) {
+	if ce.definition != nil {
+		return ce.definition.call(env, args)
+	}
+	return callBuiltin(env, ce.Function, args)
+}
+
+// evaluateDefined checks whether its argument can be read from the value map.
+// Unlike other calls, a missing variable or field is not an error here.
+func (ce *CallExpression) evaluateDefined(env *Env) (Value, error) {
+	if len(ce.Arguments) != 1 {
+		return nil, fmt.Errorf("defined: expected 1 argument, got %d", len(ce.Arguments))
+	}
+
+	_, err := ce.Arguments[0].EvaluateValue(env.unobserved())
+	if isMissing(err) {
+		return truth(false), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return truth(true), nil
+}
+
+func (ce *CallExpression) PartialEvaluate(env *Env) (string, error) {
+	args := make([]string, len(ce.Arguments))
+	values := make([]Value, len(ce.Arguments))
+	folds := true
+	for i, argument := range ce.Arguments {
+		value, err := argument.PartialEvaluate(env)
+		if err != nil {
+			return "", err
+		}
+		args[i] = value
+
+		if constant, ok := constantValue(value); ok {
+			values[i] = constant
+		} else {
+			folds = false
+		}
+	}
+
+	if ce.definition != nil && !folds {
+		return ce.definition.inline(env, args)
+	}
+	if !folds || impureBuiltins[ce.Function] {
+		return fmt.Sprintf("%s(%s)", ce.Function, strings.Join(args, ", ")), nil
+	}
+
+	evaluatedValue, err := ce.call(env, values)
+	if ce.definition != nil && isMissing(err) {
+		return ce.definition.inline(env, args)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return evaluatedValue.String(), nil
+}
+
+func (ce *CallExpression) String() string {
+	args := make([]string, len(ce.Arguments))
+	for i, argument := range ce.Arguments {
+		args[i] = argument.String()
+	}
+	return fmt.Sprintf("%s(%s)", ce.Function, strings.Join(args, ", "))
+}
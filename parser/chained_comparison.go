@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// ChainedComparison is for comparisons like lo <= x < hi, which hold when
+// every link holds. Each operand is evaluated at most once and evaluation
+// stops at the first link that does not hold.
+type ChainedComparison struct {
+	Token     constants.Token
+	Operands  []Expression
+	Operators []string
+}
+
+func (cc *ChainedComparison) TokenLiteral() string { return cc.Token.Lexeme }
+
+func (cc *ChainedComparison) Children() []Node { return toNodes(cc.Operands) }
+
+func (cc *ChainedComparison) setChildren(children []Node) { cc.Operands = toExpressions(children) }
+
+func (cc *ChainedComparison) Evaluate(env *Env) (float64, error) { return evaluateNumber(cc, env) }
+
+func (cc *ChainedComparison) EvaluateValue(env *Env) (Value, error) {
+	left, err := env.evaluate(cc.Operands[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for i, operator := range cc.Operators {
+		right, err := env.evaluate(cc.Operands[i+1])
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := evaluateInfix(env, operator, left, right)
+		if err != nil {
+			return nil, err
+		}
+
+		holds, err := isTrue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if !holds {
+			env.recordFailure(cc, fmt.Sprintf("link %d (%s %s %s) failed with %s %s %s",
+				i+1, cc.Operands[i].String(), operator, cc.Operands[i+1].String(), left.String(), operator, right.String()))
+			return truth(false), nil
+		}
+
+		left = right
+	}
+
+	return truth(true), nil
+}
+
+// PartialEvaluate folds links whose operands are both constant. A link that
+// does not hold makes the whole chain false, links that hold are dropped from
+// either end of the chain.
+func (cc *ChainedComparison) PartialEvaluate(env *Env) (string, error) {
+	operands := make([]string, len(cc.Operands))
+	for i, operand := range cc.Operands {
+		value, err := operand.PartialEvaluate(env)
+		if err != nil {
+			return "", err
+		}
+		operands[i] = value
+	}
+
+	folded := make([]bool, len(cc.Operators))
+	for i, operator := range cc.Operators {
+		if holds, ok := env.facts().decide(operator, operands[i], operands[i+1]); ok {
+			if !holds {
+				return truth(false).String(), nil
+			}
+			folded[i] = true
+			continue
+		}
+
+		left, ok := constantValue(operands[i])
+		if !ok {
+			continue
+		}
+
+		right, ok := constantValue(operands[i+1])
+		if !ok {
+			continue
+		}
+
+		value, err := evaluateInfix(env, operator, left, right)
+		if err != nil {
+			return "", err
+		}
+
+		holds, err := isTrue(value)
+		if err != nil {
+			return "", err
+		}
+
+		if !holds {
+			return truth(false).String(), nil
+		}
+		folded[i] = true
+	}
+
+	start, end := 0, len(cc.Operators)
+	for start < end && folded[start] {
+		start++
+	}
+	for end > start && folded[end-1] {
+		end--
+	}
+
+	if start == end {
+		return truth(true).String(), nil
+	}
+
+	return formatChain(operands[start:end+1], cc.Operators[start:end]), nil
+}
+
+func (cc *ChainedComparison) String() string {
+	operands := make([]string, len(cc.Operands))
+	for i, operand := range cc.Operands {
+		operands[i] = operand.String()
+	}
+	return formatChain(operands, cc.Operators)
+}
+
+func formatChain(operands []string, operators []string) string {
+	var out strings.Builder
+	out.WriteString("(")
+	out.WriteString(operands[0])
+	for i, operator := range operators {
+		fmt.Fprintf(&out, " %s %s", operator, operands[i+1])
+	}
+	out.WriteString(")")
+	return out.String()
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+)
+
+// ConditionalExpression is for expressions like if premium then 100 else 300.
+// Only the branch that is taken is evaluated. The condition follows the assert
+// convention: a comparison that holds or the number 0 takes the then branch,
+// any other number the else branch. A boolean from the value map, such as a
+// JSON true, takes the then branch when it is true.
+type ConditionalExpression struct {
+	Token       constants.Token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Lexeme }
+
+func (ce *ConditionalExpression) Children() []Node {
+	return []Node{ce.Condition, ce.Consequence, ce.Alternative}
+}
+
+func (ce *ConditionalExpression) setChildren(children []Node) {
+	ce.Condition = children[0].(Expression)
+	ce.Consequence = children[1].(Expression)
+	ce.Alternative = children[2].(Expression)
+}
+
+func (ce *ConditionalExpression) Evaluate(env *Env) (float64, error) { return evaluateNumber(ce, env) }
+
+func (ce *ConditionalExpression) EvaluateValue(env *Env) (Value, error) {
+	condition, err := env.evaluate(ce.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	holds, err := isTrue(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	if holds {
+		return env.evaluate(ce.Consequence)
+	}
+	return env.evaluate(ce.Alternative)
+}
+
+func (ce *ConditionalExpression) PartialEvaluate(env *Env) (string, error) {
+	condition, err := ce.Condition.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	if conditionValue, ok := constantValue(condition); ok {
+		holds, err := isTrue(conditionValue)
+		if err != nil {
+			return "", err
+		}
+
+		if holds {
+			return ce.Consequence.PartialEvaluate(env)
+		}
+		return ce.Alternative.PartialEvaluate(env)
+	}
+
+	consequence, err := ce.Consequence.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	alternative, err := ce.Alternative.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("(if %s then %s else %s)", condition, consequence, alternative), nil
+}
+
+func (ce *ConditionalExpression) String() string {
+	return fmt.Sprintf("(if %s then %s else %s)", ce.Condition.String(), ce.Consequence.String(), ce.Alternative.String())
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// Definition names an expression, let limit = 100, or a function of its
+// parameters, def within(x, lo, hi) = lo <= x <= hi. Definitions are resolved
+// while parsing: a let is replaced by its expression and a call of a def is a
+// CallExpression that evaluates the body with the arguments bound to the
+// parameters. Like pragmas, they do not become statements of the program.
+type Definition struct {
+	Token      constants.Token
+	Keyword    string
+	Name       string
+	Parameters []string
+	Body       Expression
+}
+
+func (d *Definition) TokenLiteral() string { return d.Token.Lexeme }
+
+func (d *Definition) Children() []Node { return []Node{d.Body} }
+
+func (d *Definition) setChildren(children []Node) { d.Body = children[0].(Expression) }
+
+func (d *Definition) Evaluate(env *Env) (float64, error) { return 0, nil }
+
+func (d *Definition) PartialEvaluate(env *Env) (string, error) { return d.String(), nil }
+
+func (d *Definition) String() string {
+	if d.Keyword == "def" {
+		return fmt.Sprintf("def %s(%s) = %s", d.Name, strings.Join(d.Parameters, ", "), d.Body.String())
+	}
+	return fmt.Sprintf("let %s = %s", d.Name, d.Body.String())
+}
+
+// call evaluates the body of a def with the arguments bound to the parameters.
+func (d *Definition) call(env *Env, args []Value) (Value, error) {
+	if len(args) != len(d.Parameters) {
+		return nil, fmt.Errorf("%s: expected %d arguments, got %d", d.Name, len(d.Parameters), len(args))
+	}
+
+	scope := env.scope()
+	for i, parameter := range d.Parameters {
+		scope = scope.bind(parameter, args[i])
+	}
+	return d.Body.EvaluateValue(scope)
+}
+
+// inline partially evaluates the body of a def with the parameters standing
+// for the residual arguments. The residual of a call that does not fold is the
+// inlined body, so that it can be parsed and evaluated without the def. A
+// quantifier around the call renames its variable when the body reads a
+// variable of the same name, so the inlined body is not captured by it.
+func (d *Definition) inline(env *Env, args []string) (string, error) {
+	if len(args) != len(d.Parameters) {
+		return "", fmt.Errorf("%s: expected %d arguments, got %d", d.Name, len(d.Parameters), len(args))
+	}
+
+	scope := env.scope()
+	for i, parameter := range d.Parameters {
+		scope = scope.bindResidual(parameter, args[i])
+	}
+	return d.Body.PartialEvaluate(scope)
+}
@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// plannedAssert is an assert and the when blocks around it, outermost first.
+type plannedAssert struct {
+	assert *AssertStatement
+	guards []*WhenBlock
+}
+
+// planAsserts lists the asserts of statements in source order.
+func planAsserts(statements []Statement, guards []*WhenBlock) []plannedAssert {
+	var plan []plannedAssert
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *AssertStatement:
+			plan = append(plan, plannedAssert{assert: s, guards: guards})
+		case *WhenBlock:
+			nested := append(append([]*WhenBlock{}, guards...), s)
+			plan = append(plan, planAsserts(s.Statements, nested)...)
+		case *SuiteBlock:
+			plan = append(plan, planAsserts(s.Statements, guards)...)
+		}
+	}
+	return plan
+}
+
+// evaluationOrder orders the plan so that every assert comes after its
+// prerequisites. Asserts that do not depend on each other keep their source
+// order.
+func evaluationOrder(plan []plannedAssert) []plannedAssert {
+	byName := map[string]int{}
+	for i, planned := range plan {
+		if planned.assert.Name != "" {
+			byName[planned.assert.Name] = i
+		}
+	}
+
+	waiting := make([]int, len(plan))
+	dependents := make([][]int, len(plan))
+	for i, planned := range plan {
+		for _, name := range planned.assert.After {
+			if prerequisite, ok := byName[name]; ok {
+				waiting[i]++
+				dependents[prerequisite] = append(dependents[prerequisite], i)
+			}
+		}
+	}
+
+	order := make([]plannedAssert, 0, len(plan))
+	done := make([]bool, len(plan))
+	for len(order) < len(plan) {
+		next := -1
+		for i := range plan {
+			if !done[i] && waiting[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			// Only a cycle, which the parser rejects, leaves asserts waiting.
+			for i := range plan {
+				if !done[i] {
+					order = append(order, plan[i])
+				}
+			}
+			break
+		}
+
+		done[next] = true
+		order = append(order, plan[next])
+		for _, dependent := range dependents[next] {
+			waiting[dependent]--
+		}
+	}
+	return order
+}
+
+// checkDependencies reports prerequisites that name no assert and cycles
+// among prerequisites.
+func checkDependencies(statements []Statement) []error {
+	var errs []error
+	asserts := map[string]*AssertStatement{}
+	forEachAssert(statements, nil, func(as *AssertStatement, _ []string) {
+		if as.Name != "" {
+			asserts[as.Name] = as
+		}
+	})
+
+	forEachAssert(statements, nil, func(as *AssertStatement, _ []string) {
+		for _, name := range as.After {
+			if _, ok := asserts[name]; !ok {
+				errs = append(errs, fmt.Errorf("%s depends on unknown assert %q", as.label(), name))
+			}
+		}
+	})
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+
+		// The path is unwound even when a cycle is found, so that a cycle
+		// is only reported once and not again from another start.
+		state[name] = visiting
+		path = append(path, name)
+		defer func() {
+			path = path[:len(path)-1]
+			state[name] = visited
+		}()
+
+		for _, prerequisite := range asserts[name].After {
+			if _, ok := asserts[prerequisite]; !ok {
+				continue
+			}
+			if err := visit(prerequisite); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	forEachAssert(statements, nil, func(as *AssertStatement, _ []string) {
+		if as.Name == "" || state[as.Name] != unvisited {
+			return
+		}
+		if err := visit(as.Name); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return errs
+}
@@ -0,0 +1,211 @@
+package parser
+
+import "time"
+
+// Env is the environment expressions are evaluated in: the value map, the
+// variables bound by quantifiers and the parameters of defs, and the program
+// whose settings apply. Every evaluation of a program has its own Env, so
+// programs with different values, pragmas or clocks can be evaluated side by
+// side and concurrently. A nil Env has no values and the default settings.
+type Env struct {
+	values  map[string]Value
+	bound   *binding
+	program *Program
+
+	// assumed holds the facts of the assumptions while the program is
+	// partially evaluated.
+	assumed facts
+
+	// reads records the variables read from the value map, if set.
+	reads *readSet
+
+	// observed records the values of the subexpressions evaluated, if set.
+	observed *observer
+
+	// failures records why the expressions evaluated did not hold, e.g.
+	// which element violated a forall, if set.
+	failures map[Expression]string
+
+	// fileTolerance is set by the tolerance pragma of an included file for
+	// the statements of that file, see withTolerance.
+	fileTolerance *Tolerance
+}
+
+// binding is a variable bound by a quantifier or a def, in front of the
+// bindings it shadows. While a call of a def is inlined by partial
+// evaluation, its parameters are bound without a value to the residuals of
+// the arguments.
+type binding struct {
+	name     string
+	value    Value
+	residual string
+	next     *binding
+}
+
+func newEnv(program *Program, values map[string]Value) *Env {
+	return &Env{values: values, program: program}
+}
+
+// lookup returns the value of a variable: the innermost binding of the name,
+// or else its value in the value map.
+func (env *Env) lookup(name string) (Value, bool) {
+	if env == nil {
+		return nil, false
+	}
+
+	for b := env.bound; b != nil; b = b.next {
+		if b.name == name {
+			return b.value, b.value != nil
+		}
+	}
+
+	env.reads.record(name)
+	value, ok := env.values[name]
+	return value, ok
+}
+
+// bind returns an environment in which name is bound to value.
+func (env *Env) bind(name string, value Value) *Env {
+	scope := env.copy()
+	scope.bound = &binding{name: name, value: value, next: scope.bound}
+	return scope
+}
+
+// scope returns the environment the body of a def is evaluated in: the value
+// map and settings without the variables bound where the def is called, so
+// that the body only sees its parameters. The values of the body are not
+// explained.
+func (env *Env) scope() *Env {
+	scope := env.copy()
+	scope.bound, scope.observed = nil, nil
+	return scope
+}
+
+// evaluate evaluates a subexpression and records its value when the
+// evaluation is observed.
+func (env *Env) evaluate(e Expression) (Value, error) {
+	value, err := e.EvaluateValue(env)
+	if env != nil {
+		env.observed.observe(e, value, err)
+	}
+	return value, err
+}
+
+// observing returns an environment that records the values of the
+// subexpressions it evaluates into o.
+func (env *Env) observing(o *observer) *Env {
+	scope := env.copy()
+	scope.observed = o
+	return scope
+}
+
+// unobserved returns an environment that records no values.
+func (env *Env) unobserved() *Env {
+	if env == nil || env.observed == nil {
+		return env
+	}
+	return env.observing(nil)
+}
+
+// bindResidual returns an environment in which name stands for the residual
+// of a partially evaluated expression.
+func (env *Env) bindResidual(name, residual string) *Env {
+	scope := env.copy()
+	scope.bound = &binding{name: name, residual: residual, next: scope.bound}
+	return scope
+}
+
+// residual returns the residual a name stands for while a def is inlined. The
+// variable of a quantifier stands for itself.
+func (env *Env) residual(name string) (string, bool) {
+	if env == nil {
+		return "", false
+	}
+
+	for b := env.bound; b != nil; b = b.next {
+		if b.name == name {
+			return b.residual, b.value == nil
+		}
+	}
+	return "", false
+}
+
+// recordingFailures returns an environment that records why the expressions
+// it evaluates do not hold. The record belongs to this evaluation, so it is
+// not shared with other evaluations of the same expressions.
+func (env *Env) recordingFailures() *Env {
+	scope := env.copy()
+	scope.failures = map[Expression]string{}
+	return scope
+}
+
+// recordFailure records why an expression did not hold.
+func (env *Env) recordFailure(e Expression, reason string) {
+	if env != nil && env.failures != nil {
+		env.failures[e] = reason
+	}
+}
+
+// failure returns why an expression did not hold, or "" when that was not
+// recorded.
+func (env *Env) failure(e Expression) string {
+	if env == nil {
+		return ""
+	}
+	return env.failures[e]
+}
+
+// withValues returns an environment with another value map.
+func (env *Env) withValues(values map[string]Value) *Env {
+	scope := env.copy()
+	scope.values = values
+	return scope
+}
+
+func (env *Env) copy() *Env {
+	if env == nil {
+		return &Env{}
+	}
+	scope := *env
+	return &scope
+}
+
+// withTolerance returns an environment for a statement of an included file
+// with a tolerance pragma, t, which replaces the tolerance of the program.
+// The statements of other files have a nil t and keep env.
+func (env *Env) withTolerance(t *Tolerance) *Env {
+	if t == nil {
+		return env
+	}
+	scope := env.copy()
+	scope.fileTolerance = t
+	return scope
+}
+
+// tolerance is the tolerance of ~= and approx(): the one of the file of the
+// statement being evaluated, then the one of the program.
+func (env *Env) tolerance() Tolerance {
+	if env != nil && env.fileTolerance != nil {
+		return *env.fileTolerance
+	}
+	if env == nil || env.program == nil || env.program.Tolerance == nil {
+		return DefaultTolerance
+	}
+	return *env.program.Tolerance
+}
+
+// now reads the clock of the program.
+func (env *Env) now() time.Time {
+	if env == nil || env.program == nil || env.program.Clock == nil {
+		return time.Now()
+	}
+	return env.program.Clock()
+}
+
+// facts returns the assumptions of a partial evaluation.
+func (env *Env) facts() facts {
+	if env == nil {
+		return facts{}
+	}
+	return env.assumed
+}
@@ -0,0 +1,308 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// evaluation holds the state of a single call to Evaluate: the outcome of
+// each named assert, the guards of the when blocks evaluated so far, the
+// require that stopped the evaluation, if any, and the scenario and row of a
+// where table being evaluated.
+type evaluation struct {
+	*Program
+	env       *Env
+	unitsErr  error
+	outcomes  map[string]Status
+	guards    map[*WhenBlock]guardOutcome
+	stoppedBy *AssertStatement
+	scenario  string
+	row       string
+}
+
+type guardOutcome struct {
+	holds bool
+	err   error
+}
+
+func newEvaluation(p *Program, env *Env, unitsErr error, scenario string) *evaluation {
+	return &evaluation{
+		Program:  p,
+		env:      env,
+		unitsErr: unitsErr,
+		scenario: scenario,
+		outcomes: map[string]Status{},
+		guards:   map[*WhenBlock]guardOutcome{},
+	}
+}
+
+// run evaluates the selected asserts in dependency order and returns their
+// results in source order.
+func (e *evaluation) run() []Result {
+	plan := planAsserts(e.Statements, nil)
+
+	byAssert := map[*AssertStatement][]Result{}
+	for _, planned := range evaluationOrder(plan) {
+		if !e.isSelected(planned.assert) {
+			continue
+		}
+
+		results := e.evaluateTimed(planned)
+		if planned.assert.Name != "" {
+			e.outcomes[planned.assert.Name] = overallStatus(results)
+		}
+		byAssert[planned.assert] = results
+	}
+
+	var results []Result
+	for _, planned := range plan {
+		results = append(results, byAssert[planned.assert]...)
+	}
+	return results
+}
+
+// evaluateTimed evaluates an assert and records, in each of its results,
+// how long the evaluation took and the variables it read.
+func (e *evaluation) evaluateTimed(planned plannedAssert) []Result {
+	reads := &readSet{names: map[string]bool{}}
+	env := e.env.copy()
+	env.reads = reads
+
+	start := time.Now()
+	results := e.evaluateRows(planned, env)
+	duration := time.Since(start)
+
+	for i := range results {
+		results[i].Duration = duration / time.Duration(len(results))
+		results[i].Reads = reads.sorted()
+		e.trace(results[i])
+	}
+	return results
+}
+
+// evaluateRows evaluates an assert once, or once per row of its where table
+// with the values of the row added to the value map.
+func (e *evaluation) evaluateRows(planned plannedAssert, env *Env) []Result {
+	table := planned.assert.Where
+	if table == nil {
+		return []Result{e.withCase(e.evaluatePlanned(planned, env))}
+	}
+
+	guards := e.guards
+	defer func() { e.guards, e.row = guards, "" }()
+
+	var results []Result
+	for i := range table.Rows {
+		e.row = table.describeRow(i)
+		e.guards = map[*WhenBlock]guardOutcome{}
+
+		row, err := table.rowValues(i)
+		if err == nil {
+			row, err = withUnits(row, e.Units)
+		}
+		if err != nil {
+			rowErr := fmt.Errorf("error evaluating %s: %w", e.label(planned.assert), err)
+			results = append(results, e.withCase(newResult(planned.assert, -1, StatusError, rowErr)))
+			continue
+		}
+
+		values := make(map[string]Value, len(env.values)+len(row))
+		for name, value := range env.values {
+			values[name] = value
+		}
+		for name, value := range row {
+			values[name] = value
+		}
+		results = append(results, e.withCase(e.evaluatePlanned(planned, env.withValues(values))))
+	}
+	return results
+}
+
+// label names an assert in messages, with the scenario and row being
+// evaluated.
+func (e *evaluation) label(as *AssertStatement) string {
+	if c := e.describeCase(); c != "" {
+		return fmt.Sprintf("%s (%s)", as.label(), c)
+	}
+	return as.label()
+}
+
+func (e *evaluation) describeCase() string {
+	var parts []string
+	if e.scenario != "" {
+		parts = append(parts, fmt.Sprintf("scenario %q", e.scenario))
+	}
+	if e.row != "" {
+		parts = append(parts, e.row)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (e *evaluation) withCase(result Result) Result {
+	result.Case = e.describeCase()
+	return result
+}
+
+// trace logs the result of an assert at debug level.
+func (e *evaluation) trace(result Result) {
+	if e.Logger == nil {
+		return
+	}
+
+	args := []any{"number", result.Number, "source", result.Source, "status", result.Status.String(), "value", result.Value, "duration", result.Duration, "reads", result.Reads}
+	if result.Name != "" {
+		args = append(args, "name", result.Name)
+	}
+	if result.Case != "" {
+		args = append(args, "case", result.Case)
+	}
+	if result.Err != nil {
+		args = append(args, "error", result.Err.Error())
+	}
+	if result.Reason != "" {
+		args = append(args, "reason", result.Reason)
+	}
+	e.Logger.Debug("evaluated assert", args...)
+}
+
+// overallStatus is the status of the first result that did not pass, or pass.
+func overallStatus(results []Result) Status {
+	for _, result := range results {
+		if result.Status != StatusPass {
+			return result.Status
+		}
+	}
+	return StatusPass
+}
+
+// evaluatePlanned evaluates an assert unless the evaluation was stopped by a
+// failed require, a prerequisite did not pass or was not evaluated, or a guard
+// around it does not hold.
+func (e *evaluation) evaluatePlanned(planned plannedAssert, env *Env) Result {
+	as := planned.assert
+	if e.stoppedBy != nil {
+		return newResult(as, -1, StatusSkip, fmt.Errorf("skipped %s: evaluation stopped after %s failed", e.label(as), e.stoppedBy.label()))
+	}
+
+	for _, name := range as.After {
+		status, ok := e.outcomes[name]
+		if !ok {
+			return newResult(as, -1, StatusSkip, fmt.Errorf("skipped %s: prerequisite %q was not evaluated", e.label(as), name))
+		}
+		if status == StatusPass {
+			continue
+		}
+		return newResult(as, -1, StatusSkip, fmt.Errorf("skipped %s: prerequisite %q %s", e.label(as), name, describeOutcome(status)))
+	}
+
+	for _, block := range planned.guards {
+		guard := e.guardOutcome(block, env)
+		if guard.err != nil {
+			err := fmt.Errorf("error evaluating %s: guard %s: %w", e.label(as), block.Guard.String(), guard.err)
+			return e.stopOnFailure(newResult(as, -1, e.failureStatus(guard.err), err), as)
+		}
+		if !guard.holds {
+			return newResult(as, -1, StatusSkip, fmt.Errorf("skipped %s: guard %s does not hold", e.label(as), block.Guard.String()))
+		}
+	}
+
+	var observed *observer
+	if e.Explain {
+		observed = &observer{}
+		env = env.observing(observed)
+	}
+
+	value, err := -1.0, e.unitsErr
+	if err == nil {
+		value, err = e.evaluateStatement(as, env)
+	}
+
+	if err == nil {
+		return newResult(as, value, StatusPass, nil)
+	}
+
+	result := newResult(as, value, e.failureStatus(err), fmt.Errorf("error evaluating %s: %w", e.label(as), err))
+	if e.Explain {
+		result.Explanation = explain(as, observed)
+	}
+	return e.stopOnFailure(result, as)
+}
+
+// stopOnFailure stops the evaluation when a require fails or has an error.
+func (e *evaluation) stopOnFailure(result Result, as *AssertStatement) Result {
+	if (result.Status == StatusFail || result.Status == StatusError) && as.Severity == SeverityRequire {
+		e.stoppedBy = as
+	}
+	return result
+}
+
+// guardOutcome evaluates the guard of a when block once per evaluation.
+func (e *evaluation) guardOutcome(block *WhenBlock, env *Env) guardOutcome {
+	if outcome, ok := e.guards[block]; ok {
+		return outcome
+	}
+
+	outcome := guardOutcome{err: e.unitsErr}
+	if outcome.err == nil {
+		outcome.holds, outcome.err = block.guardHolds(env)
+	}
+	e.guards[block] = outcome
+	return outcome
+}
+
+// newResult returns the result of an assert. The error of a skipped assert
+// only says why it was skipped and becomes its reason.
+func newResult(as *AssertStatement, value float64, status Status, err error) Result {
+	result := Result{
+		Number:   as.number(),
+		Name:     as.Name,
+		Suite:    as.Suite,
+		Source:   as.source,
+		Span:     as.Span,
+		Severity: as.Severity,
+		Value:    value,
+		Status:   status,
+		Err:      err,
+	}
+	if status == StatusSkip && err != nil {
+		result.Reason, result.Err = err.Error(), nil
+	}
+	return result
+}
+
+// readSet records the variables an assert reads from the value map. The
+// variables of quantifiers and the parameters of defs are bound in the Env and
+// never reach it.
+type readSet struct {
+	names map[string]bool
+}
+
+func (r *readSet) record(name string) {
+	if r != nil {
+		r.names[name] = true
+	}
+}
+
+func (r *readSet) sorted() []string {
+	names := make([]string, 0, len(r.names))
+	for name := range r.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func describeOutcome(status Status) string {
+	switch status {
+	case StatusFail:
+		return "failed"
+	case StatusError:
+		return "had an error"
+	case StatusSkip:
+		return "was skipped"
+	default:
+		return "is " + status.String()
+	}
+}
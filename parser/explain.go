@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"encoding/json"
+	"parser/constants"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Explanation holds the value of every subexpression of an assert that did
+// not pass, in the order they were evaluated. String draws the values under
+// the source in the style of power asserts:
+//
+//	assert (x + y) * 4 == z * 2
+//	        | | |  |   |  | |
+//	        1 3 2  12  |  5 10
+//	                   false
+type Explanation struct {
+	Source string           `json:"source"`
+	Span   Span             `json:"span"`
+	Values []ExplainedValue `json:"values"`
+}
+
+// ExplainedValue is the value of a subexpression. Line and Column are the
+// position of the token the value is drawn under: the operator of an
+// operation and the start of a variable or call.
+type ExplainedValue struct {
+	Expression string `json:"expression"`
+	Value      string `json:"value,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+}
+
+// observer records the values of subexpressions as the evaluation of an
+// assert sees them, children before their parents, so that an explanation
+// shows the values that decided the result without evaluating anything
+// again. Only the branch an if takes is evaluated, and neither the argument
+// of defined() nor the body of a quantifier or a def, which are evaluated
+// without an observer. Literals are left out.
+type observer struct {
+	exprs  []Expression
+	values []ExplainedValue
+}
+
+func (o *observer) observe(e Expression, value Value, err error) {
+	if o == nil {
+		return
+	}
+
+	switch e.(type) {
+	case *NumberLiteral, *StringLiteral, *QuantityLiteral, *TimeLiteral:
+		return
+	}
+
+	tok := explainedToken(e)
+	explained := ExplainedValue{Expression: e.String(), Line: tok.Line, Column: tok.Column}
+	if err != nil {
+		explained.Error = err.Error()
+	} else {
+		explained.Value, explained.Type = displayValue(e, value)
+	}
+	o.exprs = append(o.exprs, e)
+	o.values = append(o.values, explained)
+}
+
+// explain returns the explanation of an assert from the values observed
+// while it was evaluated.
+func explain(as *AssertStatement, observed *observer) *Explanation {
+	explanation := &Explanation{Source: as.source, Span: as.Span}
+	if observed != nil {
+		explanation.Values = observed.values
+	}
+	return explanation
+}
+
+// explainedToken returns the token a value is drawn under. A call is drawn
+// under the start of its name.
+func explainedToken(e Expression) constants.Token {
+	switch expr := e.(type) {
+	case *Variable:
+		return expr.Token
+	case *PrefixExpression:
+		return expr.Token
+	case *InfixExpression:
+		return expr.Token
+	case *ChainedComparison:
+		return expr.Token
+	case *ConditionalExpression:
+		return expr.Token
+	case *CallExpression:
+		tok := expr.Token
+		if tok.Column > len(expr.Function) {
+			tok.Column -= len(expr.Function)
+		}
+		return tok
+	case *QuantifierExpression:
+		return expr.Token
+	case *ListLiteral:
+		return expr.Token
+	case *IndexExpression:
+		return expr.Token
+	case *MemberExpression:
+		return expr.Token
+	case *RangeExpression:
+		return expr.Token
+	default:
+		return constants.Token{}
+	}
+}
+
+// displayValue formats a value for an explanation. Conditions, which follow
+// the assert convention, are shown as true or false.
+func displayValue(e Expression, value Value) (string, string) {
+	if number, ok := value.(NumberValue); ok && isCondition(e) {
+		return strconv.FormatBool(number == 0), "boolean"
+	}
+	return value.String(), value.Type()
+}
+
+func isCondition(e Expression) bool {
+	switch expr := e.(type) {
+	case *InfixExpression:
+		switch expr.Operator {
+		case "==", "!=", "<", "<=", ">", ">=", "~=", "in":
+			return true
+		}
+		return false
+	case *PrefixExpression:
+		return expr.Operator == "!"
+	case *ChainedComparison, *QuantifierExpression:
+		return true
+	case *CallExpression:
+		return expr.Function == "defined" || expr.Function == "approx"
+	default:
+		return false
+	}
+}
+
+// JSON returns the explanation as JSON.
+func (x *Explanation) JSON() ([]byte, error) {
+	return json.MarshalIndent(x, "", "  ")
+}
+
+// String draws every line of the source with the values of the tokens on it
+// below. Every row places the values that end before the next token to their
+// right, the others hang from bars until a later row has room for them.
+func (x *Explanation) String() string {
+	var out strings.Builder
+
+	for i, line := range strings.Split(x.Source, "\n") {
+		lineNumber := x.Span.Start.Line + i
+		offset := 1
+		if i == 0 {
+			offset = x.Span.Start.Column
+		}
+
+		var pending []placedValue
+		for _, value := range x.Values {
+			column := value.Column - offset
+			if value.Line != lineNumber || value.Value == "" || column < 0 || column >= len(line) {
+				continue
+			}
+			pending = append(pending, placedValue{column: column, text: value.Value})
+		}
+		sort.SliceStable(pending, func(a, b int) bool { return pending[a].column < pending[b].column })
+
+		out.WriteString(line + "\n")
+		if len(pending) == 0 {
+			continue
+		}
+		out.WriteString(drawRow(pending, nil) + "\n")
+		for len(pending) > 0 {
+			placed := map[int]bool{}
+			for j := range pending {
+				if j == len(pending)-1 || pending[j].column+len(pending[j].text) < pending[j+1].column {
+					placed[j] = true
+				}
+			}
+			out.WriteString(drawRow(pending, placed) + "\n")
+
+			var remaining []placedValue
+			for j, value := range pending {
+				if !placed[j] {
+					remaining = append(remaining, value)
+				}
+			}
+			pending = remaining
+		}
+	}
+
+	return strings.TrimRight(out.String(), "\n")
+}
+
+type placedValue struct {
+	column int
+	text   string
+}
+
+// drawRow draws the placed values and a bar for every other pending value.
+func drawRow(pending []placedValue, placed map[int]bool) string {
+	var row []byte
+	for j, value := range pending {
+		text := "|"
+		if placed[j] {
+			text = value.text
+		}
+		for len(row) < value.column {
+			row = append(row, ' ')
+		}
+		row = append(row[:value.column], text...)
+	}
+	return strings.TrimRight(string(row), " ")
+}
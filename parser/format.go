@@ -0,0 +1,397 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"parser/constants"
+	"parser/lexer"
+	"strings"
+)
+
+// lineWidth is the width Format breaks long expressions at.
+const lineWidth = 80
+
+// indentUnit indents the statements of blocks, the rows of where tables and
+// the lines an expression is broken into.
+const indentUnit = "    "
+
+// statementLines are the first and last line of a statement in the source.
+type statementLines struct {
+	first, last int
+}
+
+// Format parses source and prints it in the canonical style: one statement
+// per line, the statements of blocks indented by four spaces, where tables
+// aligned and expressions with only the parentheses their precedence needs.
+// Expressions that do not fit in 80 columns are broken before their
+// operators. Statements that were separated by blank lines are separated by
+// one blank line.
+//
+// Format does not read included files or apply pragmas, lets are printed as
+// they are written. Formatting its output again gives the same output.
+func Format(source string) (string, error) {
+	p := &Parser{l: lexer.NewLexer(source), errors: []string{}, modules: newModules(nil), layout: map[Statement]statementLines{}}
+	p.nextToken()
+	p.nextToken()
+
+	statements := p.parseLayout()
+	if len(p.errors) > 0 {
+		return "", errors.New(strings.Join(p.errors, "\n"))
+	}
+
+	f := &formatter{layout: p.layout}
+	f.statements(statements, "")
+	return f.out.String(), nil
+}
+
+// parseLayout parses the statements of the input as they are written, with
+// the lines they span recorded in p.layout.
+func (p *Parser) parseLayout() []Statement {
+	var statements []Statement
+	for p.curToken.Type != constants.TOKEN_EOF {
+		errs := len(p.errors)
+		stmt := p.parseStatement()
+		if include, ok := stmt.(*IncludeStatement); ok && include.Namespace != "" {
+			p.modules.namespaces[include.Namespace] = true
+		}
+		if stmt == nil {
+			p.skipped(errs)
+		} else {
+			statements = append(statements, stmt)
+		}
+		p.nextToken()
+	}
+	return statements
+}
+
+func (p *Parser) recordLayout(stmt Statement, first int) {
+	if stmt != nil {
+		p.layout[stmt] = statementLines{first: first, last: p.curToken.Line}
+	}
+}
+
+// skipped reports a token that does not start a statement when the parser
+// keeps the layout, unless parsing the statement already gave an error.
+// Otherwise the token is skipped.
+func (p *Parser) skipped(errs int) {
+	if p.layout != nil && len(p.errors) == errs {
+		p.errorAt(p.curToken, fmt.Sprintf("unexpected %s on line %d", p.curToken.Lexeme, p.curToken.Line))
+	}
+}
+
+type formatter struct {
+	layout map[Statement]statementLines
+	out    strings.Builder
+}
+
+func (f *formatter) statements(statements []Statement, indent string) {
+	for i, stmt := range statements {
+		if i > 0 && f.layout[stmt].first > f.layout[statements[i-1]].last+1 {
+			f.out.WriteString("\n")
+		}
+		f.statement(stmt, indent)
+	}
+}
+
+func (f *formatter) statement(stmt Statement, indent string) {
+	switch s := stmt.(type) {
+	case *AssertStatement:
+		f.assert(s, indent)
+	case *AssumeStatement:
+		f.write(wrapStatement(indent+"assume ", s.Expression, indent))
+	case *Definition:
+		head := "let " + s.Name
+		if s.Keyword == "def" {
+			head = fmt.Sprintf("def %s(%s)", s.Name, strings.Join(s.Parameters, ", "))
+		}
+		f.write(wrapStatement(indent+head+" = ", s.Body, indent))
+	case *WhenBlock:
+		f.block(wrapStatement(indent+formatTags(s.Tags)+"when ", s.Guard, indent), s.Statements, indent)
+	case *SuiteBlock:
+		f.block([]string{indent + s.header()}, s.Statements, indent)
+	case *ScenarioBlock:
+		f.scenario(s, indent)
+	case *VarDeclaration:
+		f.write([]string{indent + formatDeclaration(s)})
+	default:
+		f.write([]string{indent + stmt.String()})
+	}
+}
+
+// assert prints the expression after the header when it fits, on the next
+// line for named asserts when it fits there, and broken otherwise.
+func (f *formatter) assert(as *AssertStatement, indent string) {
+	header := indent + as.header()
+	expression := formatExpression(as.Expression)
+
+	var lines []string
+	switch {
+	case len(header)+1+len(expression) <= lineWidth:
+		lines = []string{header + " " + expression}
+	case strings.HasSuffix(header, ":") && len(indent+indentUnit)+len(expression) <= lineWidth:
+		lines = []string{header, indent + indentUnit + expression}
+	default:
+		lines = wrapStatement(header+" ", as.Expression, indent)
+	}
+
+	if as.Where != nil {
+		lines[len(lines)-1] += " where"
+		lines = append(lines, formatWhereTable(as.Where, indent+indentUnit)...)
+	}
+	f.write(lines)
+}
+
+func (f *formatter) block(header []string, statements []Statement, indent string) {
+	header[len(header)-1] += " {"
+	f.write(header)
+	f.statements(statements, indent+indentUnit)
+	f.write([]string{indent + "}"})
+}
+
+// scenario prints a scenario on one line when it fits and one assignment per
+// line otherwise.
+func (f *formatter) scenario(sb *ScenarioBlock, indent string) {
+	header := fmt.Sprintf("%sscenario %q", indent, sb.Name)
+	if len(sb.Assignments) == 0 {
+		f.write([]string{header + " {}"})
+		return
+	}
+
+	assignments := make([]string, len(sb.Assignments))
+	for i, assignment := range sb.Assignments {
+		assignments[i] = assignment.Name + " = " + formatExpression(assignment.Value)
+	}
+	if line := header + " { " + strings.Join(assignments, "; ") + " }"; len(line) <= lineWidth {
+		f.write([]string{line})
+		return
+	}
+
+	lines := []string{header + " {"}
+	for _, assignment := range assignments {
+		lines = append(lines, indent+indentUnit+assignment)
+	}
+	f.write(append(lines, indent+"}"))
+}
+
+func (f *formatter) write(lines []string) {
+	for _, line := range lines {
+		f.out.WriteString(line + "\n")
+	}
+}
+
+func formatDeclaration(vd *VarDeclaration) string {
+	switch {
+	case vd.Interval != nil:
+		return fmt.Sprintf("var %s: %s in [%s]", vd.Name, vd.Type, formatExpressions(vd.Interval))
+	case vd.Members != nil:
+		return fmt.Sprintf("var %s: %s in {%s}", vd.Name, vd.Type, formatExpressions(vd.Members))
+	default:
+		return fmt.Sprintf("var %s: %s", vd.Name, vd.Type)
+	}
+}
+
+// formatWhereTable prints the rows of a where table with their columns
+// aligned.
+func formatWhereTable(wt *WhereTable, indent string) []string {
+	rows := [][]string{wt.Columns}
+	for _, row := range wt.Rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = formatExpression(cell)
+		}
+		rows = append(rows, cells)
+	}
+
+	widths := make([]int, len(wt.Columns))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		line := indent + "|"
+		for j, cell := range row {
+			line += " " + cell + strings.Repeat(" ", widths[j]-len(cell)) + " |"
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+// wrapStatement returns the lines of a statement made of prefix followed by
+// e.
+func wrapStatement(prefix string, e Expression, indent string) []string {
+	lines := wrapExpression(e, len(prefix), indent)
+	lines[0] = prefix + lines[0]
+	return lines
+}
+
+// wrapExpression returns the lines of e when it starts at column: the first
+// without indentation and the others indented by indent and a unit more.
+// Operations that do not fit are broken before their operator, their operands
+// in turn as far as they do not fit.
+func wrapExpression(e Expression, column int, indent string) []string {
+	flat := formatExpression(e)
+	if column+len(flat) <= lineWidth {
+		return []string{flat}
+	}
+
+	continuation := indent + indentUnit
+	switch expr := e.(type) {
+	case *InfixExpression:
+		precedence := operatorPrecedence(expr.Operator)
+		lines := wrapOperand(expr.Left, leftNeedsParentheses(expr.Left, precedence, isComparisonOperator(expr.Operator)), column, indent)
+		return appendOperand(lines, expr.Operator, expr.Right, precedenceOf(expr.Right) <= precedence, continuation)
+	case *ChainedComparison:
+		lines := wrapOperand(expr.Operands[0], leftNeedsParentheses(expr.Operands[0], LESSGREATER, true), column, indent)
+		for i, operand := range expr.Operands[1:] {
+			lines = appendOperand(lines, expr.Operators[i], operand, precedenceOf(operand) <= LESSGREATER, continuation)
+		}
+		return lines
+	default:
+		return []string{flat}
+	}
+}
+
+func wrapOperand(e Expression, parenthesize bool, column int, indent string) []string {
+	if !parenthesize {
+		return wrapExpression(e, column, indent)
+	}
+	lines := wrapExpression(e, column+1, indent)
+	lines[0] = "(" + lines[0]
+	lines[len(lines)-1] += ")"
+	return lines
+}
+
+// appendOperand appends the lines of an operand, on a new line that starts
+// with its operator.
+func appendOperand(lines []string, operator string, e Expression, parenthesize bool, indent string) []string {
+	prefix := indent + operator + " "
+	operand := wrapOperand(e, parenthesize, len(prefix), indent)
+	operand[0] = prefix + operand[0]
+	return append(lines, operand...)
+}
+
+// formatExpression prints e on one line with the parentheses the precedence
+// of the parser needs, and those rightNeedsParentheses keeps for a reader, and
+// no others. Operators of equal precedence are left
+// associative, and a comparison on the left of a comparison is parenthesized,
+// as it would be chained otherwise. Quantifiers and conditionals, which
+// extend as far to the right as possible, are parenthesized as operands.
+func formatExpression(e Expression) string {
+	switch expr := e.(type) {
+	case *InfixExpression:
+		precedence := operatorPrecedence(expr.Operator)
+		left := formatOperand(expr.Left, leftNeedsParentheses(expr.Left, precedence, isComparisonOperator(expr.Operator)))
+		right := formatOperand(expr.Right, rightNeedsParentheses(expr.Right, precedence))
+		return left + " " + expr.Operator + " " + right
+	case *ChainedComparison:
+		parts := []string{formatOperand(expr.Operands[0], leftNeedsParentheses(expr.Operands[0], LESSGREATER, true))}
+		for i, operand := range expr.Operands[1:] {
+			parts = append(parts, expr.Operators[i], formatOperand(operand, precedenceOf(operand) <= LESSGREATER))
+		}
+		return strings.Join(parts, " ")
+	case *PrefixExpression:
+		return expr.Operator + formatOperand(expr.Right, precedenceOf(expr.Right) < PREFIX)
+	case *RangeExpression:
+		return formatOperand(expr.Start, precedenceOf(expr.Start) < RANGE) + ".." + formatOperand(expr.End, precedenceOf(expr.End) <= RANGE)
+	case *ConditionalExpression:
+		return fmt.Sprintf("if %s then %s else %s", formatExpression(expr.Condition), formatExpression(expr.Consequence), formatExpression(expr.Alternative))
+	case *QuantifierExpression:
+		return fmt.Sprintf("%s %s in %s: %s", expr.Quantifier, expr.Variable, formatExpression(expr.Domain), formatExpression(expr.Body))
+	case *CallExpression:
+		return expr.Function + "(" + formatExpressions(expr.Arguments) + ")"
+	case *ListLiteral:
+		return "[" + formatExpressions(expr.Elements) + "]"
+	case *IndexExpression:
+		return formatOperand(expr.Left, precedenceOf(expr.Left) < CALL) + "[" + formatExpression(expr.Index) + "]"
+	case *MemberExpression:
+		return formatOperand(expr.Object, precedenceOf(expr.Object) < CALL) + "." + expr.Property
+	default:
+		return e.String()
+	}
+}
+
+func formatOperand(e Expression, parenthesize bool) string {
+	if parenthesize {
+		return "(" + formatExpression(e) + ")"
+	}
+	return formatExpression(e)
+}
+
+func formatExpressions(exprs []Expression) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = formatExpression(e)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// leftNeedsParentheses reports whether the left operand of an operator of the
+// given precedence is parenthesized.
+func leftNeedsParentheses(left Expression, precedence int, comparison bool) bool {
+	if comparison && isComparisonExpression(left) {
+		return true
+	}
+	return precedenceOf(left) < precedence
+}
+
+// rightNeedsParentheses reports whether the right operand of an operator of
+// the given precedence is parenthesized. The parser binds + tighter than -
+// and / tighter than *, but a reader takes them left to right, so the right
+// operand of - or * keeps its parentheses when it is an operation of the same
+// pair: a - (b + c) is not printed as a - b + c, nor a * (b / c) as a * b / c.
+func rightNeedsParentheses(right Expression, precedence int) bool {
+	switch precedence {
+	case SUBTRACT:
+		precedence = SUM
+	case PRODUCT:
+		precedence = DIVISION
+	}
+	return precedenceOf(right) <= precedence
+}
+
+// precedenceOf returns the precedence of the operation e is, the precedence
+// of the parser, and for operands that need no parentheses one above all of
+// them.
+func precedenceOf(e Expression) int {
+	switch expr := e.(type) {
+	case *InfixExpression:
+		return operatorPrecedence(expr.Operator)
+	case *ChainedComparison:
+		return LESSGREATER
+	case *RangeExpression:
+		return RANGE
+	case *PrefixExpression:
+		return PREFIX
+	case *CallExpression:
+		return CALL
+	case *IndexExpression, *MemberExpression:
+		return INDEX
+	case *ConditionalExpression, *QuantifierExpression:
+		return LOWEST
+	default:
+		return INDEX + 1
+	}
+}
+
+func operatorPrecedence(operator string) int {
+	return precedences[lexer.NewLexer(operator).NewToken().Type]
+}
+
+func isComparisonOperator(operator string) bool {
+	return isComparison(lexer.NewLexer(operator).NewToken().Type)
+}
+
+func isComparisonExpression(e Expression) bool {
+	switch expr := e.(type) {
+	case *InfixExpression:
+		return isComparisonOperator(expr.Operator)
+	case *ChainedComparison:
+		return true
+	default:
+		return false
+	}
+}
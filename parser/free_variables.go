@@ -0,0 +1,338 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// variableCollector finds the free variables of expressions: the variables
+// read from the value map, not the ones bound by quantifiers, the parameters
+// of defs or the columns of where tables. A variable that is only read by
+// defined() or on the left of ?? is optional, it may be missing.
+type variableCollector struct {
+	required map[string]bool
+	bound    map[string]int
+	calling  map[*Definition]bool
+}
+
+func newVariableCollector() *variableCollector {
+	return &variableCollector{required: map[string]bool{}, bound: map[string]int{}, calling: map[*Definition]bool{}}
+}
+
+func (vc *variableCollector) collect(e Expression, optional bool) {
+	switch expr := e.(type) {
+	case *Variable:
+		if vc.bound[expr.Value] > 0 {
+			return
+		}
+		vc.required[expr.Value] = vc.required[expr.Value] || !optional
+
+	case *PrefixExpression:
+		vc.collect(expr.Right, optional)
+
+	case *InfixExpression:
+		vc.collect(expr.Left, optional || expr.Operator == "??")
+		vc.collect(expr.Right, optional)
+
+	case *ChainedComparison:
+		vc.collectAll(optional, expr.Operands...)
+
+	case *ConditionalExpression:
+		vc.collectAll(optional, expr.Condition, expr.Consequence, expr.Alternative)
+
+	case *CallExpression:
+		vc.collectAll(optional || expr.Function == "defined", expr.Arguments...)
+		// The body of a def only sees its parameters, not the variables
+		// bound where it is called.
+		if expr.definition != nil && !vc.calling[expr.definition] {
+			vc.calling[expr.definition] = true
+			bound := vc.bound
+			vc.bound = map[string]int{}
+			vc.bindAll(expr.definition.Parameters)
+			vc.collect(expr.definition.Body, optional)
+			vc.bound = bound
+			delete(vc.calling, expr.definition)
+		}
+
+	case *QuantifierExpression:
+		vc.collect(expr.Domain, optional)
+		vc.bound[expr.Variable]++
+		vc.collect(expr.Body, optional)
+		vc.bound[expr.Variable]--
+
+	case *ListLiteral:
+		vc.collectAll(optional, expr.Elements...)
+
+	case *IndexExpression:
+		vc.collectAll(optional, expr.Left, expr.Index)
+
+	case *MemberExpression:
+		vc.collect(expr.Object, optional)
+
+	case *RangeExpression:
+		vc.collectAll(optional, expr.Start, expr.End)
+	}
+}
+
+func (vc *variableCollector) collectAll(optional bool, exprs ...Expression) {
+	for _, e := range exprs {
+		vc.collect(e, optional)
+	}
+}
+
+func (vc *variableCollector) bindAll(names []string) {
+	for _, name := range names {
+		vc.bound[name]++
+	}
+}
+
+func (vc *variableCollector) unbindAll(names []string) {
+	for _, name := range names {
+		vc.bound[name]--
+	}
+}
+
+// collectStatement collects the variables of a statement, the guards of when
+// blocks and the asserts inside blocks included.
+func (vc *variableCollector) collectStatement(stmt Statement) {
+	switch s := stmt.(type) {
+	case *AssertStatement:
+		if s.Where != nil {
+			vc.bindAll(s.Where.Columns)
+			defer vc.unbindAll(s.Where.Columns)
+		}
+		vc.collect(s.Expression, false)
+	case *AssumeStatement:
+		vc.collect(s.Expression, false)
+	case *WhenBlock:
+		vc.collect(s.Guard, false)
+		for _, nested := range s.Statements {
+			vc.collectStatement(nested)
+		}
+	case *SuiteBlock:
+		for _, nested := range s.Statements {
+			vc.collectStatement(nested)
+		}
+	}
+}
+
+func (vc *variableCollector) names() []string {
+	names := make([]string, 0, len(vc.required))
+	for name := range vc.required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FreeVariables returns the variables a statement or expression reads from the
+// value map, in sorted order.
+func FreeVariables(node Node) []string {
+	vc := newVariableCollector()
+	switch n := node.(type) {
+	case Expression:
+		vc.collect(n, false)
+	case Statement:
+		vc.collectStatement(n)
+	}
+	return vc.names()
+}
+
+// FreeVariables returns the variables the statements and assumptions of the
+// program read from the value map, in sorted order.
+func (p *Program) FreeVariables() []string {
+	vc := newVariableCollector()
+	for _, stmt := range p.Statements {
+		vc.collectStatement(stmt)
+	}
+	for _, assumption := range p.Assumptions {
+		vc.collectStatement(assumption)
+	}
+	return vc.names()
+}
+
+// StatementVariables returns the free variables of every assert, the guards of
+// the when blocks it is in included. The variables of the assert numbered n
+// are at index n-1.
+func (p *Program) StatementVariables() [][]string {
+	var variables [][]string
+	forEachGuardedAssert(p.Statements, nil, func(as *AssertStatement, guards []Expression) {
+		variables = append(variables, assertVariables(as, guards).names())
+	})
+	return variables
+}
+
+func assertVariables(as *AssertStatement, guards []Expression) *variableCollector {
+	vc := newVariableCollector()
+	for _, guard := range guards {
+		vc.collect(guard, false)
+	}
+	vc.collectStatement(as)
+	return vc
+}
+
+// forEachGuardedAssert calls fn for every assert with the guards of the when
+// blocks it is in, outermost first.
+func forEachGuardedAssert(statements []Statement, guards []Expression, fn func(*AssertStatement, []Expression)) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *AssertStatement:
+			fn(s, guards)
+		case *WhenBlock:
+			forEachGuardedAssert(s.Statements, append(append([]Expression{}, guards...), s.Guard), fn)
+		case *SuiteBlock:
+			forEachGuardedAssert(s.Statements, guards, fn)
+		}
+	}
+}
+
+// Validation is the check of the value map against the free variables of a
+// program, made before evaluating it.
+type Validation struct {
+	// Missing are the variables the program reads that the value map does
+	// not have, in sorted order. Variables that are only read by defined()
+	// or on the left of ?? may be missing and are not listed.
+	Missing []MissingVariable
+
+	// Unused are the keys of the value map that no statement reads, in
+	// sorted order.
+	Unused []string
+}
+
+// MissingVariable is a variable that is not in the value map, with the
+// numbers of the asserts that read it and the keys of the value map that are
+// close to its name.
+type MissingVariable struct {
+	Name        string
+	Statements  []int
+	Suggestions []string
+}
+
+func (mv MissingVariable) Error() string {
+	statements := make([]string, len(mv.Statements))
+	for i, number := range mv.Statements {
+		statements[i] = fmt.Sprint(number)
+	}
+
+	msg := fmt.Sprintf("missing variable %s", mv.Name)
+	if len(statements) == 1 {
+		msg += ", read by statement " + statements[0]
+	} else if len(statements) > 1 {
+		msg += ", read by statements " + strings.Join(statements, ", ")
+	}
+	if len(mv.Suggestions) > 0 {
+		msg += ", did you mean " + strings.Join(mv.Suggestions, " or ") + "?"
+	}
+	return msg
+}
+
+// Valid reports whether the value map has every variable the program needs.
+// Unused keys do not make it invalid.
+func (v Validation) Valid() bool {
+	return len(v.Missing) == 0
+}
+
+// Errors returns an error per missing variable followed by one per unused key.
+func (v Validation) Errors() []error {
+	var errs []error
+	for _, missing := range v.Missing {
+		errs = append(errs, missing)
+	}
+	for _, name := range v.Unused {
+		errs = append(errs, fmt.Errorf("unused value %s", name))
+	}
+	return errs
+}
+
+// Validate checks the value map against the free variables of the program and
+// reports every missing variable and unused key at once, instead of failing
+// on the first unknown variable while evaluating.
+func (p *Program) Validate() Validation {
+	var validation Validation
+
+	readBy := map[string][]int{}
+	forEachGuardedAssert(p.Statements, nil, func(as *AssertStatement, guards []Expression) {
+		for name, required := range assertVariables(as, guards).required {
+			if required {
+				readBy[name] = append(readBy[name], as.number())
+			}
+		}
+	})
+	for _, assumption := range p.Assumptions {
+		vc := newVariableCollector()
+		vc.collectStatement(assumption)
+		for name, required := range vc.required {
+			if _, ok := readBy[name]; required && !ok {
+				readBy[name] = nil
+			}
+		}
+	}
+
+	used := map[string]bool{}
+	for _, name := range p.FreeVariables() {
+		used[name] = true
+	}
+
+	keys := make([]string, 0, len(p.values))
+	for name := range p.values {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	names := make([]string, 0, len(readBy))
+	for name := range readBy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := p.values[name]; !ok {
+			validation.Missing = append(validation.Missing, MissingVariable{Name: name, Statements: readBy[name], Suggestions: suggest(name, keys)})
+		}
+	}
+
+	for _, name := range keys {
+		if !used[name] {
+			validation.Unused = append(validation.Unused, name)
+		}
+	}
+	return validation
+}
+
+// suggest returns the candidates that are at most two edits away from name,
+// closest first.
+func suggest(name string, candidates []string) []string {
+	distances := map[string]int{}
+	var suggestions []string
+	for _, candidate := range candidates {
+		distance := editDistance(name, candidate)
+		if distance <= 2 && distance < len(name) {
+			distances[candidate] = distance
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return distances[suggestions[i]] < distances[suggestions[j]] })
+	return suggestions
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
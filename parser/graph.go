@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GraphOptions configures the DOT and Mermaid export of a tree.
+type GraphOptions struct {
+	// Values annotates the expressions with their values against the value
+	// map of the program, as they are evaluated; a statement or expression on
+	// its own is evaluated without values. Conditions that do not hold and
+	// expressions that cannot be evaluated are marked as failed.
+	Values bool
+}
+
+// graph is a tree of labelled nodes, numbered in preorder.
+type graph struct {
+	env   *Env
+	nodes []graphNode
+	edges [][2]int
+}
+
+type graphNode struct {
+	label  string
+	value  string
+	failed bool
+}
+
+// DOT returns the tree of a statement or expression as a Graphviz digraph.
+func DOT(node Node, options GraphOptions) string {
+	return newGraph(nil, node, options).dot()
+}
+
+// Mermaid returns the tree of a statement or expression as a Mermaid
+// flowchart.
+func Mermaid(node Node, options GraphOptions) string {
+	return newGraph(nil, node, options).mermaid()
+}
+
+// DOT returns the tree of the program, its statements and assumptions under a
+// program node, as a Graphviz digraph.
+func (p *Program) DOT(options GraphOptions) string {
+	return newGraph(p, nil, options).dot()
+}
+
+// Mermaid returns the tree of the program as a Mermaid flowchart.
+func (p *Program) Mermaid(options GraphOptions) string {
+	return newGraph(p, nil, options).mermaid()
+}
+
+func newGraph(program *Program, node Node, options GraphOptions) *graph {
+	g := &graph{}
+	var values map[Expression]ExplainedValue
+	if options.Values {
+		if program != nil {
+			g.env, _ = program.env(program.values)
+		}
+		values = map[Expression]ExplainedValue{}
+	}
+
+	if program == nil {
+		g.add(node, values, true)
+		return g
+	}
+
+	root := g.addNode(graphNode{label: "program"})
+	for _, stmt := range program.Statements {
+		g.addChild(root, stmt, values, true)
+	}
+	for _, assumption := range program.Assumptions {
+		g.addChild(root, assumption, values, true)
+	}
+	return g
+}
+
+func (g *graph) addNode(node graphNode) int {
+	g.nodes = append(g.nodes, node)
+	return len(g.nodes) - 1
+}
+
+// add adds a node and its children and returns its number. When values is
+// not nil and the node is an expression that is evaluated on its own, the
+// expression of a statement or the node given to DOT or Mermaid, the values
+// of its subexpressions are recorded into it first. Subexpressions that are
+// not evaluated, like the body of a quantifier, get no value.
+func (g *graph) add(node Node, values map[Expression]ExplainedValue, evaluated bool) int {
+	e, isExpression := node.(Expression)
+	if values != nil && isExpression && evaluated {
+		observed := &observer{}
+		g.env.observing(observed).evaluate(e)
+		for i, sub := range observed.exprs {
+			values[sub] = observed.values[i]
+		}
+	}
+
+	added := graphNode{label: graphLabel(node)}
+	if isExpression && values != nil {
+		if value, ok := values[e]; ok {
+			added.value = value.Value
+			if value.Error != "" {
+				added.value = "error: " + value.Error
+			}
+			added.failed = value.Error != "" || (value.Type == "boolean" && value.Value == "false")
+		}
+	}
+
+	n := g.addNode(added)
+	for _, child := range node.Children() {
+		if child != nil {
+			g.addChild(n, child, values, !isExpression)
+		}
+	}
+	return n
+}
+
+// addChild adds a node and its children under parent. The edge is added
+// first, so that edges are in the order of the nodes.
+func (g *graph) addChild(parent int, child Node, values map[Expression]ExplainedValue, evaluated bool) {
+	g.edges = append(g.edges, [2]int{parent, len(g.nodes)})
+	g.add(child, values, evaluated)
+}
+
+// graphLabel returns the operator, name or value a node is labelled with.
+func graphLabel(node Node) string {
+	switch n := node.(type) {
+	case *AssertStatement:
+		if n.Name != "" {
+			return fmt.Sprintf("%s %q", n.Severity, n.Name)
+		}
+		return n.Severity.String()
+	case *SuiteBlock:
+		return fmt.Sprintf("suite %q", n.Name)
+	case *ScenarioBlock:
+		return fmt.Sprintf("scenario %q", n.Name)
+	case *VarDeclaration:
+		return "var " + n.Name
+	case *Definition:
+		return n.Keyword + " " + n.Name
+	case *IncludeStatement:
+		return n.String()
+	case *PragmaStatement:
+		return n.String()
+	case *Variable:
+		return n.Value
+	case *StringLiteral:
+		return fmt.Sprintf("%q", n.Value)
+	case *PrefixExpression:
+		return n.Operator
+	case *InfixExpression:
+		return n.Operator
+	case *ChainedComparison:
+		return strings.Join(n.Operators, " ")
+	case *ConditionalExpression:
+		return "if"
+	case *CallExpression:
+		return n.Function + "()"
+	case *QuantifierExpression:
+		return n.Quantifier + " " + n.Variable
+	case *ListLiteral:
+		return "[]"
+	case *IndexExpression:
+		return "index"
+	case *MemberExpression:
+		return "." + n.Property
+	case *RangeExpression:
+		return ".."
+	default:
+		return node.TokenLiteral()
+	}
+}
+
+func (g *graph) dot() string {
+	var out strings.Builder
+	out.WriteString("digraph AST {\n")
+	out.WriteString("  node [shape=box];\n")
+	for i, node := range g.nodes {
+		label := node.label
+		if node.value != "" {
+			label += "\n= " + node.value
+		}
+		attributes := fmt.Sprintf("label=%s", dotQuote(label))
+		if node.failed {
+			attributes += ", color=red"
+		}
+		out.WriteString(fmt.Sprintf("  n%d [%s];\n", i, attributes))
+	}
+	for _, edge := range g.edges {
+		out.WriteString(fmt.Sprintf("  n%d -> n%d;\n", edge[0], edge[1]))
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+func (g *graph) mermaid() string {
+	var out strings.Builder
+	out.WriteString("flowchart TD\n")
+	failed := false
+	for i, node := range g.nodes {
+		label := mermaidEscape(node.label)
+		if node.value != "" {
+			label += "<br/>= " + mermaidEscape(node.value)
+		}
+		class := ""
+		if node.failed {
+			class = ":::failed"
+			failed = true
+		}
+		out.WriteString(fmt.Sprintf("  n%d[\"%s\"]%s\n", i, label, class))
+	}
+	for _, edge := range g.edges {
+		out.WriteString(fmt.Sprintf("  n%d --> n%d\n", edge[0], edge[1]))
+	}
+	if failed {
+		out.WriteString("  classDef failed stroke:#d00,color:#d00\n")
+	}
+	return out.String()
+}
+
+// dotQuote quotes a label for DOT, where newlines are written as \n.
+func dotQuote(label string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(label) + `"`
+}
+
+// mermaidEscape writes the characters Mermaid would read as markup as entity
+// codes.
+func mermaidEscape(label string) string {
+	replacer := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;")
+	return replacer.Replace(label)
+}
@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"fmt"
+	"io/fs"
+	"parser/constants"
+	"parser/lexer"
+	"path"
+	"strings"
+)
+
+// IncludeStatement is include "common.assert", which parses another file in
+// place, or import "limits.assert" as limits, which only takes the let and
+// def definitions of the file and makes them available as limits.name. Paths
+// are resolved relative to the file that includes them.
+type IncludeStatement struct {
+	Token     constants.Token
+	Path      string
+	Namespace string
+}
+
+func (is *IncludeStatement) TokenLiteral() string { return is.Token.Lexeme }
+
+func (is *IncludeStatement) Children() []Node { return nil }
+
+func (is *IncludeStatement) Evaluate(env *Env) (float64, error) { return 0, nil }
+
+func (is *IncludeStatement) PartialEvaluate(env *Env) (string, error) { return is.String(), nil }
+
+func (is *IncludeStatement) String() string {
+	if is.Namespace != "" {
+		return fmt.Sprintf("import %q as %s", is.Path, is.Namespace)
+	}
+	return fmt.Sprintf("include %q", is.Path)
+}
+
+// modules is shared by the parser of a program and the parsers of the files
+// it includes: the file system, the definitions by qualified name, the
+// namespaces of imports and the files being included, to detect cycles.
+type modules struct {
+	fsys        fs.FS
+	definitions map[string]*Definition
+	namespaces  map[string]bool
+	included    map[string]bool
+	including   []string
+}
+
+func newModules(fsys fs.FS) *modules {
+	return &modules{
+		fsys:        fsys,
+		definitions: map[string]*Definition{},
+		namespaces:  map[string]bool{},
+		included:    map[string]bool{},
+	}
+}
+
+// NewFileParser returns a parser for a file of fsys. Its include and import
+// statements are read from fsys too, and its errors start with the file, line
+// and column they refer to.
+func NewFileParser(fsys fs.FS, name string) (Parserer, error) {
+	source, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Parser{l: lexer.NewLexer(string(source)), errors: []string{}, file: name, modules: newModules(fsys)}
+	p.modules.including = []string{name}
+	p.nextToken()
+	p.nextToken()
+	return p, nil
+}
+
+// include parses the file of an include or import statement into the program.
+// A file that is already included in the same namespace is skipped.
+func (p *Parser) include(stmt *IncludeStatement, program *Program) {
+	if p.modules.fsys == nil {
+		p.errorAt(stmt.Token, fmt.Sprintf("cannot %s without a file system, use NewFileParser", stmt.String()))
+		return
+	}
+
+	name := path.Join(path.Dir(p.file), stmt.Path)
+	for i, including := range p.modules.including {
+		if including == name {
+			cycle := append(append([]string{}, p.modules.including[i:]...), name)
+			p.errorAt(stmt.Token, fmt.Sprintf("include cycle: %s", strings.Join(cycle, " -> ")))
+			return
+		}
+	}
+
+	namespace := p.namespace
+	if stmt.Namespace != "" {
+		namespace += stmt.Namespace + "."
+		p.modules.namespaces[strings.TrimSuffix(namespace, ".")] = true
+	}
+	if p.modules.included[namespace+name] {
+		return
+	}
+	p.modules.included[namespace+name] = true
+
+	source, err := fs.ReadFile(p.modules.fsys, name)
+	if err != nil {
+		p.errorAt(stmt.Token, fmt.Sprintf("cannot %s: %s", stmt.String(), err))
+		return
+	}
+
+	included := &Parser{
+		l:         lexer.NewLexer(string(source)),
+		file:      name,
+		namespace: namespace,
+		imported:  p.imported || stmt.Namespace != "",
+		modules:   p.modules,
+		included:  true,
+	}
+	included.nextToken()
+	included.nextToken()
+
+	p.modules.including = append(p.modules.including, name)
+	included.parseStatements(program)
+	p.modules.including = p.modules.including[:len(p.modules.including)-1]
+
+	p.errors = append(p.errors, included.errors...)
+}
+
+// define adds a let or def to the definitions, qualified by the namespace of
+// the file it is in.
+func (p *Parser) define(definition *Definition) {
+	name := p.namespace + definition.Name
+	if _, ok := p.modules.definitions[name]; ok {
+		p.errorAt(definition.Token, fmt.Sprintf("%s is defined twice", name))
+		return
+	}
+	p.modules.definitions[name] = definition
+}
+
+// lookup finds a definition by the name used in the current file: names of
+// the file's own namespace first, then qualified and top level names.
+func (p *Parser) lookup(name string) *Definition {
+	if definition, ok := p.modules.definitions[p.namespace+name]; ok {
+		return definition
+	}
+	return p.modules.definitions[name]
+}
+
+func (p *Parser) isNamespace(name string) bool {
+	return p.modules.namespaces[p.namespace+name] || p.modules.namespaces[name]
+}
+
+// qualify returns the name of a definition or namespace as the top level
+// would write it.
+func (p *Parser) qualify(name string) string {
+	if _, ok := p.modules.definitions[p.namespace+name]; ok {
+		return p.namespace + name
+	}
+	if p.modules.namespaces[p.namespace+name] {
+		return p.namespace + name
+	}
+	return name
+}
+
+// errorAt records an error about a token, prefixed with its file, line and
+// column when the token was read from a file.
+func (p *Parser) errorAt(tok constants.Token, msg string) {
+	if tok.File != "" {
+		msg = fmt.Sprintf("%s:%d:%d: %s", tok.File, tok.Line, tok.Column, msg)
+	}
+	p.errors = append(p.errors, msg)
+}
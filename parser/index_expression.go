@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+)
+
+// IndexExpression is for expressions like xs[0].
+type IndexExpression struct {
+	Token constants.Token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Lexeme }
+
+func (ie *IndexExpression) Children() []Node { return []Node{ie.Left, ie.Index} }
+
+func (ie *IndexExpression) setChildren(children []Node) {
+	ie.Left = children[0].(Expression)
+	ie.Index = children[1].(Expression)
+}
+
+func (ie *IndexExpression) Evaluate(env *Env) (float64, error) { return evaluateNumber(ie, env) }
+
+func (ie *IndexExpression) EvaluateValue(env *Env) (Value, error) {
+	left, err := env.evaluate(ie.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := env.evaluate(ie.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := evaluateIndex(left, index)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ie.Left.String(), err)
+	}
+	return value, nil
+}
+
+func evaluateIndex(leftValue, indexValue Value) (Value, error) {
+	if object, ok := leftValue.(ObjectValue); ok {
+		key, ok := indexValue.(StringValue)
+		if !ok {
+			return nil, fmt.Errorf("object key must be a string, got %s", indexValue.Type())
+		}
+		return lookupField(object, string(key))
+	}
+
+	list, err := toList(leftValue)
+	if err != nil {
+		return nil, fmt.Errorf("index: %s", err)
+	}
+
+	index, err := toInteger(indexValue)
+	if err != nil {
+		return nil, fmt.Errorf("index: %s", err)
+	}
+
+	if index < 0 || index >= len(list) {
+		return nil, fmt.Errorf("index out of range: %d with length %d", index, len(list))
+	}
+
+	return list[index], nil
+}
+
+func (ie *IndexExpression) PartialEvaluate(env *Env) (string, error) {
+	left, err := ie.Left.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	index, err := ie.Index.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	leftValue, ok := constantValue(left)
+	if !ok {
+		return fmt.Sprintf("%s[%s]", left, index), nil
+	}
+
+	indexValue, ok := constantValue(index)
+	if !ok {
+		return fmt.Sprintf("%s[%s]", left, index), nil
+	}
+
+	evaluatedValue, err := evaluateIndex(leftValue, indexValue)
+	if err != nil {
+		return "", err
+	}
+
+	return evaluatedValue.String(), nil
+}
+
+func (ie *IndexExpression) String() string {
+	return fmt.Sprintf("%s[%s]", ie.Left.String(), ie.Index.String())
+}
@@ -15,73 +15,182 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Lexeme }
 
-func (ie *InfixExpression) PartialEvaluate() (string, error) {
-	left, err := ie.Left.PartialEvaluate()
+func (ie *InfixExpression) Children() []Node { return []Node{ie.Left, ie.Right} }
+
+func (ie *InfixExpression) setChildren(children []Node) {
+	ie.Left = children[0].(Expression)
+	ie.Right = children[1].(Expression)
+}
+
+func (ie *InfixExpression) PartialEvaluate(env *Env) (string, error) {
+	left, err := ie.Left.PartialEvaluate(env)
 	if err != nil {
 		return "", err
 	}
 
-	right, err := ie.Right.PartialEvaluate()
+	right, err := ie.Right.PartialEvaluate(env)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = IsConstant(left)
+	leftValue, ok := constantValue(left)
+	if !ok {
+		return ie.formatResidual(env, left, right), nil
+	}
+
+	if ie.Operator == "??" {
+		return leftValue.String(), nil
+	}
+
+	rightValue, ok := constantValue(right)
+	if !ok {
+		return ie.formatResidual(env, left, right), nil
+	}
+
+	evaluatedValue, err := evaluateInfix(env, ie.Operator, leftValue, rightValue)
 	if err != nil {
-		return fmt.Sprintf("(%s %s %s)", left, ie.Operator, right), nil
+		return "", err
+	}
+
+	return evaluatedValue.String(), nil
+}
+
+func (ie *InfixExpression) formatResidual(env *Env, left, right string) string {
+	if simplified, ok := env.facts().simplify(ie.Operator, left, right); ok {
+		return simplified
+	}
+	if ie.Operator == "~=" {
+		return formatApprox(env, left, right)
 	}
+	return fmt.Sprintf("(%s %s %s)", left, ie.Operator, right)
+}
+
+func (ie *InfixExpression) Evaluate(env *Env) (float64, error) { return evaluateNumber(ie, env) }
 
-	_, err = IsConstant(right)
+func (ie *InfixExpression) EvaluateValue(env *Env) (Value, error) {
+	left, err := env.evaluate(ie.Left)
+	if ie.Operator == "??" {
+		if isMissing(err) {
+			return env.evaluate(ie.Right)
+		}
+		return left, err
+	}
 	if err != nil {
-		return fmt.Sprintf("(%s %s %s)", left, ie.Operator, right), nil
+		return nil, err
+	}
+
+	if r, ok := ie.Right.(*RangeExpression); ok && ie.Operator == "in" {
+		start, end, err := r.bounds(env)
+		if err != nil {
+			return nil, err
+		}
+		return truth(rangeContains(left, start, end)), nil
 	}
 
-	evaluatedValue, err := ie.Evaluate()
+	right, err := env.evaluate(ie.Right)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return fmt.Sprintf("%.2f", evaluatedValue), nil
+	return evaluateInfix(env, ie.Operator, left, right)
 }
 
-func (ie *InfixExpression) Evaluate() (float64, error) {
-	left, err := ie.Left.Evaluate()
+func evaluateInfix(env *Env, operator string, leftValue, rightValue Value) (Value, error) {
+	switch operator {
+	case "==":
+		return truth(valuesEqual(leftValue, rightValue)), nil
+	case "!=":
+		return truth(!valuesEqual(leftValue, rightValue)), nil
+	case "in":
+		if object, ok := rightValue.(ObjectValue); ok {
+			key, ok := leftValue.(StringValue)
+			if !ok {
+				return nil, fmt.Errorf("in: object key must be a string, got %s", leftValue.Type())
+			}
+			_, found := object[string(key)]
+			return truth(found), nil
+		}
+
+		list, err := toList(rightValue)
+		if err != nil {
+			return nil, fmt.Errorf("in: %s", err)
+		}
+		for _, element := range list {
+			if valuesEqual(leftValue, element) {
+				return truth(true), nil
+			}
+		}
+		return truth(false), nil
+	}
+
+	_, leftIsTime := leftValue.(TimeValue)
+	_, rightIsTime := rightValue.(TimeValue)
+	if leftIsTime || rightIsTime {
+		return evaluateTimeInfix(operator, leftValue, rightValue)
+	}
+
+	_, leftIsQuantity := leftValue.(QuantityValue)
+	_, rightIsQuantity := rightValue.(QuantityValue)
+	if leftIsQuantity || rightIsQuantity {
+		return evaluateQuantityInfix(env, operator, leftValue, rightValue)
+	}
+
+	if leftString, ok := leftValue.(StringValue); ok {
+		if rightString, ok := rightValue.(StringValue); ok {
+			return compareStrings(operator, string(leftString), string(rightString))
+		}
+	}
+
+	left, err := toNumber(leftValue)
 	if err != nil {
-		return -1, err
+		return nil, fmt.Errorf("%s: %s", operator, err)
 	}
 
-	right, err := ie.Right.Evaluate()
+	right, err := toNumber(rightValue)
 	if err != nil {
-		return -1, err
+		return nil, fmt.Errorf("%s: %s", operator, err)
 	}
 
-	switch ie.Operator {
+	switch operator {
 	case "+":
-		return left + right, nil
+		return NumberValue(left + right), nil
 	case "*":
-		return left * right, nil
+		return NumberValue(left * right), nil
 	case "-":
-		return left - right, nil
+		return NumberValue(left - right), nil
 	case "/":
 		if right == 0 {
-			return 0, fmt.Errorf("division by zero")
-		} else {
-			return left / right, nil
-		}
-	case "==":
-		if left == right {
-			return 0, nil
+			return nil, fmt.Errorf("division by zero")
 		} else {
-			return 1, nil
+			return NumberValue(left / right), nil
 		}
+	case "<":
+		return truth(left < right), nil
 	case "<=":
-		if left != right {
-			return 1, nil
-		} else {
-			return 0, nil
-		}
+		return truth(left <= right), nil
+	case ">":
+		return truth(left > right), nil
+	case ">=":
+		return truth(left >= right), nil
+	case "~=":
+		return truth(approxEqual(left, right, env.tolerance())), nil
+	default:
+		return NumberValue(left), nil
+	}
+}
+
+func compareStrings(operator string, left, right string) (Value, error) {
+	switch operator {
+	case "<":
+		return truth(left < right), nil
+	case "<=":
+		return truth(left <= right), nil
+	case ">":
+		return truth(left > right), nil
+	case ">=":
+		return truth(left >= right), nil
 	default:
-		return left, nil
+		return nil, fmt.Errorf("unsupported operator for strings: %s", operator)
 	}
 }
 
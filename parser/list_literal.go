@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// ListLiteral is for expressions like [1, 2, 3] or ["eu", "us"].
+type ListLiteral struct {
+	Token    constants.Token
+	Elements []Expression
+}
+
+func (ll *ListLiteral) TokenLiteral() string { return ll.Token.Lexeme }
+
+func (ll *ListLiteral) Children() []Node { return toNodes(ll.Elements) }
+
+func (ll *ListLiteral) setChildren(children []Node) { ll.Elements = toExpressions(children) }
+
+func (ll *ListLiteral) Evaluate(env *Env) (float64, error) { return evaluateNumber(ll, env) }
+
+func (ll *ListLiteral) EvaluateValue(env *Env) (Value, error) {
+	list := make(ListValue, len(ll.Elements))
+	for i, element := range ll.Elements {
+		value, err := env.evaluate(element)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = value
+	}
+	return list, nil
+}
+
+func (ll *ListLiteral) PartialEvaluate(env *Env) (string, error) {
+	elements := make([]string, len(ll.Elements))
+	for i, element := range ll.Elements {
+		value, err := element.PartialEvaluate(env)
+		if err != nil {
+			return "", err
+		}
+		elements[i] = value
+	}
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", ")), nil
+}
+
+func (ll *ListLiteral) String() string {
+	elements := make([]string, len(ll.Elements))
+	for i, element := range ll.Elements {
+		elements[i] = element.String()
+	}
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// MemberExpression is for field access on objects like db.pool.max.
+type MemberExpression struct {
+	Token    constants.Token
+	Object   Expression
+	Property string
+}
+
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Lexeme }
+
+func (me *MemberExpression) Children() []Node { return []Node{me.Object} }
+
+func (me *MemberExpression) setChildren(children []Node) { me.Object = children[0].(Expression) }
+
+func (me *MemberExpression) Evaluate(env *Env) (float64, error) { return evaluateNumber(me, env) }
+
+func (me *MemberExpression) EvaluateValue(env *Env) (Value, error) {
+	value, err := env.evaluate(me.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	object, ok := value.(ObjectValue)
+	if !ok {
+		return nil, fmt.Errorf("%s: cannot access field %q on %s", me.Object.String(), me.Property, value.Type())
+	}
+
+	field, err := lookupField(object, me.Property)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", me.Object.String(), err)
+	}
+	return field, nil
+}
+
+// lookupField returns a field of an object, naming the fields that do exist
+// when it is missing.
+func lookupField(object ObjectValue, name string) (Value, error) {
+	field, ok := object[name]
+	if !ok {
+		return nil, &MissingValueError{
+			Name:    name,
+			Message: fmt.Sprintf("unknown field %q (available: %s)", name, strings.Join(object.Keys(), ", ")),
+		}
+	}
+	return field, nil
+}
+
+func (me *MemberExpression) PartialEvaluate(env *Env) (string, error) {
+	object, err := me.Object.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s.%s", object, me.Property), nil
+}
+
+func (me *MemberExpression) String() string {
+	return fmt.Sprintf("%s.%s", me.Object.String(), me.Property)
+}
@@ -1,9 +1,6 @@
 package parser
 
-import (
-	"fmt"
-	"parser/constants"
-)
+import "parser/constants"
 
 type NumberLiteral struct {
 	Token constants.Token
@@ -12,8 +9,14 @@ type NumberLiteral struct {
 
 func (nl *NumberLiteral) TokenLiteral() string { return nl.Token.Lexeme }
 
-func (nl *NumberLiteral) Evaluate() (float64, error) { return nl.Value, nil }
+func (nl *NumberLiteral) Children() []Node { return nil }
 
-func (nl *NumberLiteral) PartialEvaluate() (string, error) { return fmt.Sprintf("%.2f", nl.Value), nil }
+func (nl *NumberLiteral) Evaluate(env *Env) (float64, error) { return nl.Value, nil }
+
+func (nl *NumberLiteral) EvaluateValue(env *Env) (Value, error) { return NumberValue(nl.Value), nil }
+
+func (nl *NumberLiteral) PartialEvaluate(env *Env) (string, error) {
+	return formatNumber(nl.Value), nil
+}
 
 func (nl *NumberLiteral) String() string { return nl.Token.Lexeme }
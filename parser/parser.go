@@ -2,9 +2,12 @@ package parser
 
 import (
 	"fmt"
+	"io"
 	"parser/constants"
 	"parser/lexer"
 	"strconv"
+	"strings"
+	"unicode"
 )
 
 type Parser struct {
@@ -12,10 +15,40 @@ type Parser struct {
 	curToken  constants.Token
 	peekToken constants.Token
 	errors    []string
+
+	// file is the file being parsed, "" for a string. namespace prefixes the
+	// let and def names of an imported file, and imported is set when only
+	// definitions are taken from the file.
+	file      string
+	namespace string
+	imported  bool
+	modules   *modules
+
+	// included is set for the parser of an included file. A tolerance pragma
+	// of the file sets tolerance, which is given to the statements of the
+	// file, own, once the file is parsed.
+	included  bool
+	tolerance *Tolerance
+	own       []Statement
+
+	// bound holds the parameters of a def and the variables of quantifiers
+	// being parsed, which are not resolved as lets.
+	bound map[string]int
+
+	// lineStarts are the offsets of the lines of the input, see offset.
+	lineStarts []int
+
+	// astOutput receives the AST of the parsed program, if set.
+	astOutput io.Writer
+
+	// layout records the lines of every statement for Format. When it is
+	// set, tokens that do not start a statement are errors instead of being
+	// skipped.
+	layout map[Statement]statementLines
 }
 
 func NewParser(l lexer.Lexerer) Parserer {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []string{}, modules: newModules(nil)}
 	p.nextToken()
 	p.nextToken()
 	return p
@@ -24,21 +57,33 @@ func NewParser(l lexer.Lexerer) Parserer {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NewToken()
+	p.peekToken.File = p.file
 }
 
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// SetASTOutput makes ParseProgram write the AST of the program to out. By
+// default the AST is not written anywhere.
+func (p *Parser) SetASTOutput(out io.Writer) {
+	p.astOutput = out
+}
+
 func (p *Parser) printAST(node any) {
-    visitor := NewPrintVisitor()
+    if p.astOutput == nil {
+        return
+    }
+
+    fmt.Fprintln(p.astOutput, "AST :-")
+    visitor := NewPrintVisitor(p.astOutput)
     switch n := node.(type) {
     case *Program:
         visitor.VisitProgram(n, 0)
     case Expression:
         visitor.VisitExpression(n, 0)
     default:
-        fmt.Println("Unknown node type")
+        fmt.Fprintln(p.astOutput, "Unknown node type")
     }
 }
 
@@ -46,31 +91,195 @@ func (p *Parser) ParseProgram() ProgramEvaluator {
 	program := &Program{}
 	program.Statements = []Statement{}
 
+	p.parseStatements(program)
+
+	p.numberAsserts(program)
+	for _, err := range checkDependencies(program.Statements) {
+		p.errors = append(p.errors, err.Error())
+	}
+
+	p.printAST(program)
+
+	return program
+}
+
+// parseStatements parses statements up to the end of the input into the
+// program. Statements that configure the program are applied while parsing.
+func (p *Parser) parseStatements(program *Program) {
 	for p.curToken.Type != constants.TOKEN_EOF {
+		start := p.curToken
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if _, ok := stmt.(*Definition); !ok && stmt != nil && p.imported {
+			if _, ok := stmt.(*IncludeStatement); !ok {
+				p.errorAt(start, fmt.Sprintf("imported files can only hold let, def, include and import, not %s", stmt.TokenLiteral()))
+				stmt = nil
+			}
+		}
+
+		if pragma, ok := stmt.(*PragmaStatement); ok {
+			if err := pragma.apply(p, program); err != nil {
+				p.errorAt(start, err.Error())
+			}
+		} else if declaration, ok := stmt.(*VarDeclaration); ok {
+			if err := declaration.declare(program); err != nil {
+				p.errorAt(start, err.Error())
+			}
+		} else if scenario, ok := stmt.(*ScenarioBlock); ok {
+			if err := scenario.declare(program); err != nil {
+				p.errorAt(start, err.Error())
+			}
+		} else if assumption, ok := stmt.(*AssumeStatement); ok {
+			program.Assumptions = append(program.Assumptions, assumption)
+			p.own = append(p.own, assumption)
+		} else if definition, ok := stmt.(*Definition); ok {
+			p.define(definition)
+		} else if include, ok := stmt.(*IncludeStatement); ok {
+			p.include(include, program)
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
+			p.own = append(p.own, stmt)
 		}
 		p.nextToken()
 	}
 
-	fmt.Println("AST :-")
-	p.printAST(program)
+	if p.tolerance != nil {
+		for _, stmt := range p.own {
+			setTolerance(stmt, p.tolerance)
+		}
+	}
+}
 
-	return program
+// numberAsserts gives every assert its position in the program and checks
+// that assert names are unique.
+func (p *Parser) numberAsserts(program *Program) {
+	names := map[string]bool{}
+	index := 0
+	forEachAssert(program.Statements, nil, func(as *AssertStatement, _ []string) {
+		as.index = index
+		index++
+
+		if as.Name == "" {
+			return
+		}
+		if names[as.Name] {
+			p.errorAt(as.Token, fmt.Sprintf("assert name %q is used twice", as.Name))
+		}
+		names[as.Name] = true
+	})
 }
 
-func (p *Parser) parseStatement() Statement {
+func (p *Parser) parseStatement() (stmt Statement) {
+	if p.layout != nil {
+		first := p.curToken.Line
+		defer func() { p.recordLayout(stmt, first) }()
+	}
+
+	if p.curToken.Type == constants.TOKEN_TAG {
+		return p.parseTaggedStatement()
+	}
+
 	switch p.curToken.Lexeme {
-	case "assert":
+	case "assert", "require", "warn":
 		return p.parseAssertStatement()
+	case "pragma":
+		return p.parsePragmaStatement()
+	case "var":
+		return p.parseVarDeclaration()
+	case "assume":
+		return p.parseAssumeStatement()
+	case "when":
+		return p.parseWhenBlock()
+	case "suite":
+		return p.parseSuiteBlock()
+	case "scenario":
+		return p.parseScenarioBlock()
+	case "let", "def":
+		return p.parseDefinition()
+	case "include", "import":
+		return p.parseIncludeStatement()
 	default:
 		return nil
 	}
 }
 
+// parseTaggedStatement parses @tag annotations followed by the assert or
+// block they annotate.
+func (p *Parser) parseTaggedStatement() Statement {
+	var tags []string
+	start := p.curToken
+	for p.curToken.Type == constants.TOKEN_TAG {
+		tags = append(tags, p.curToken.Lexeme)
+		p.nextToken()
+	}
+
+	switch stmt := p.parseStatement().(type) {
+	case *AssertStatement:
+		stmt.Tags = append(tags, stmt.Tags...)
+		stmt.source, stmt.Span = p.sourceOf(start)
+		return stmt
+	case *WhenBlock:
+		stmt.Tags = append(tags, stmt.Tags...)
+		return stmt
+	case *SuiteBlock:
+		stmt.Tags = append(tags, stmt.Tags...)
+		return stmt
+	case nil:
+		return nil
+	default:
+		msg := fmt.Sprintf("tags can only annotate asserts, when blocks and suites, not %s", stmt.TokenLiteral())
+		p.errorAt(p.curToken, msg)
+		return nil
+	}
+}
+
+// parseAssertStatement parses assert expr, the named form
+// assert "name": expr and prerequisites as in assert "name" after "a", "b":
+// expr, and the same forms of require and warn.
 func (p *Parser) parseAssertStatement() *AssertStatement {
 	stmt := &AssertStatement{Token: p.curToken}
+	switch p.curToken.Lexeme {
+	case "require":
+		stmt.Severity = SeverityRequire
+	case "warn":
+		stmt.Severity = SeverityWarn
+	}
+
+	p.nextToken()
+
+	if p.curToken.Type == constants.TOKEN_STRING && (p.peekTokenIs(constants.TOKEN_COLON) || p.peekToken.Lexeme == "after") {
+		stmt.Name = p.curToken.Lexeme
+		p.nextToken()
+		if p.curToken.Type == constants.TOKEN_COLON {
+			p.nextToken()
+		}
+	}
+
+	if p.curToken.Lexeme == "after" && p.peekTokenIs(constants.TOKEN_STRING) {
+		p.nextToken()
+		stmt.After = append(stmt.After, p.curToken.Lexeme)
+		for p.peekTokenIs(constants.TOKEN_COMMA) {
+			p.nextToken()
+			if p.expectPeek(constants.TOKEN_STRING) {
+				stmt.After = append(stmt.After, p.curToken.Lexeme)
+			}
+		}
+		p.expectPeek(constants.TOKEN_COLON)
+		p.nextToken()
+	}
+
+	stmt.Expression = p.parseExpression(LOWEST)
+
+	if p.peekToken.Type == constants.TOKEN_VARIABLE && p.peekToken.Lexeme == "where" {
+		p.nextToken()
+		stmt.Where = p.parseWhereTable()
+	}
+
+	stmt.source, stmt.Span = p.sourceOf(stmt.Token)
+	return stmt
+}
+
+func (p *Parser) parseAssumeStatement() *AssumeStatement {
+	stmt := &AssumeStatement{Token: p.curToken}
 
 	p.nextToken()
 
@@ -79,6 +288,335 @@ func (p *Parser) parseAssertStatement() *AssertStatement {
 	return stmt
 }
 
+// parseWhenBlock parses when guard { statements }. Blocks hold asserts and
+// other blocks.
+func (p *Parser) parseWhenBlock() Statement {
+	block := &WhenBlock{Token: p.curToken}
+
+	p.nextToken()
+	block.Guard = p.parseExpression(LOWEST)
+
+	statements, ok := p.parseBlockStatements(block.Token)
+	if !ok {
+		return nil
+	}
+	block.Statements = statements
+
+	return block
+}
+
+// parseWhereTable parses the rows after where. Every row starts on its own
+// line and is written as | cell | cell |; the first row names the columns.
+func (p *Parser) parseWhereTable() *WhereTable {
+	table := &WhereTable{Token: p.curToken}
+
+	for p.peekTokenIs(constants.TOKEN_PIPE) {
+		p.nextToken()
+		line := p.curToken.Line
+
+		var cells []Expression
+		for p.peekToken.Line == line && !p.peekTokenIs(constants.TOKEN_EOF) {
+			p.nextToken()
+			cells = append(cells, p.parseExpression(LOWEST))
+			if !p.expectPeek(constants.TOKEN_PIPE) {
+				return nil
+			}
+		}
+
+		if table.Columns == nil {
+			for _, cell := range cells {
+				column, ok := cell.(*Variable)
+				if !ok {
+					msg := fmt.Sprintf("where table on line %d: column %s must be a name", table.Token.Line, cell.String())
+					p.errorAt(p.curToken, msg)
+					return nil
+				}
+				table.Columns = append(table.Columns, column.Value)
+			}
+			continue
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+
+	if err := table.check(); err != nil {
+		p.errorAt(table.Token, err.Error())
+		return nil
+	}
+	return table
+}
+
+// parseScenarioBlock parses scenario "name" { x = 3; y = -6 }. Assignments
+// are separated by semicolons or new lines.
+func (p *Parser) parseScenarioBlock() Statement {
+	block := &ScenarioBlock{Token: p.curToken}
+
+	if !p.expectPeek(constants.TOKEN_STRING) {
+		return nil
+	}
+	block.Name = p.curToken.Lexeme
+
+	if !p.expectPeek(constants.TOKEN_LEFT_BRACE) {
+		return nil
+	}
+	p.nextToken()
+
+	for p.curToken.Type != constants.TOKEN_RIGHT_BRACE {
+		switch p.curToken.Type {
+		case constants.TOKEN_EOF:
+			msg := fmt.Sprintf("scenario block on line %d is not closed", block.Token.Line)
+			p.errorAt(p.curToken, msg)
+			return nil
+		case constants.TOKEN_SEMICOLON:
+			p.nextToken()
+			continue
+		case constants.TOKEN_VARIABLE:
+		default:
+			msg := fmt.Sprintf("expected an assignment in scenario %q, got %s instead", block.Name, p.curToken.Lexeme)
+			p.errorAt(p.curToken, msg)
+			return nil
+		}
+
+		assignment := Assignment{Token: p.curToken, Name: p.curToken.Lexeme}
+		if !p.expectPeek(constants.TOKEN_EQUAL) {
+			return nil
+		}
+		p.nextToken()
+		assignment.Value = p.parseExpression(LOWEST)
+		if assignment.Value == nil {
+			return nil
+		}
+		block.Assignments = append(block.Assignments, assignment)
+		p.nextToken()
+	}
+
+	return block
+}
+
+// parseDefinition parses let name = expr and def name(a, b) = expr.
+func (p *Parser) parseDefinition() Statement {
+	definition := &Definition{Token: p.curToken, Keyword: p.curToken.Lexeme}
+
+	if !p.expectPeek(constants.TOKEN_VARIABLE) {
+		return nil
+	}
+	definition.Name = p.curToken.Lexeme
+
+	if definition.Keyword == "def" {
+		if !p.expectPeek(constants.TOKEN_LEFT_PAREN) {
+			return nil
+		}
+		for !p.peekTokenIs(constants.TOKEN_RIGHT_PAREN) {
+			if len(definition.Parameters) > 0 && !p.expectPeek(constants.TOKEN_COMMA) {
+				return nil
+			}
+			if !p.expectPeek(constants.TOKEN_VARIABLE) {
+				return nil
+			}
+			definition.Parameters = append(definition.Parameters, p.curToken.Lexeme)
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(constants.TOKEN_EQUAL) {
+		return nil
+	}
+	p.nextToken()
+
+	for _, parameter := range definition.Parameters {
+		p.bind(parameter)
+	}
+	definition.Body = p.parseExpression(LOWEST)
+	for _, parameter := range definition.Parameters {
+		p.unbind(parameter)
+	}
+
+	if definition.Body == nil {
+		return nil
+	}
+	return definition
+}
+
+// parseIncludeStatement parses include "file" and import "file" as name.
+func (p *Parser) parseIncludeStatement() Statement {
+	stmt := &IncludeStatement{Token: p.curToken}
+
+	if !p.expectPeek(constants.TOKEN_STRING) {
+		return nil
+	}
+	stmt.Path = p.curToken.Lexeme
+
+	if stmt.Token.Lexeme == "import" {
+		if !p.peekTokenIs(constants.TOKEN_VARIABLE) || p.peekToken.Lexeme != "as" {
+			p.errorAt(p.peekToken, fmt.Sprintf("expected as after import %q", stmt.Path))
+			return nil
+		}
+		p.nextToken()
+		if !p.expectPeek(constants.TOKEN_VARIABLE) {
+			return nil
+		}
+		stmt.Namespace = p.curToken.Lexeme
+	}
+
+	return stmt
+}
+
+func (p *Parser) bind(name string) {
+	if p.bound == nil {
+		p.bound = map[string]int{}
+	}
+	p.bound[name]++
+}
+
+func (p *Parser) unbind(name string) { p.bound[name]-- }
+
+// parseSuiteBlock parses suite "name" { statements }. Suites hold asserts and
+// when blocks, but not other suites.
+func (p *Parser) parseSuiteBlock() Statement {
+	block := &SuiteBlock{Token: p.curToken}
+
+	if !p.expectPeek(constants.TOKEN_STRING) {
+		return nil
+	}
+	block.Name = p.curToken.Lexeme
+
+	statements, ok := p.parseBlockStatements(block.Token)
+	if !ok {
+		return nil
+	}
+	block.Statements = statements
+
+	forEachAssert(block.Statements, nil, func(as *AssertStatement, _ []string) {
+		as.Suite = block.Name
+	})
+
+	return block
+}
+
+// parseBlockStatements parses { statements } after the header of the block
+// started by token. Blocks hold asserts and when blocks.
+func (p *Parser) parseBlockStatements(token constants.Token) ([]Statement, bool) {
+	if !p.expectPeek(constants.TOKEN_LEFT_BRACE) {
+		return nil, false
+	}
+	p.nextToken()
+
+	var statements []Statement
+	for p.curToken.Type != constants.TOKEN_RIGHT_BRACE {
+		if p.curToken.Type == constants.TOKEN_EOF {
+			msg := fmt.Sprintf("%s block on line %d is not closed", token.Lexeme, token.Line)
+			p.errorAt(p.curToken, msg)
+			return nil, false
+		}
+
+		errs := len(p.errors)
+		switch stmt := p.parseStatement().(type) {
+		case *AssertStatement, *WhenBlock:
+			statements = append(statements, stmt)
+		case nil:
+			p.skipped(errs)
+		default:
+			msg := fmt.Sprintf("%s is not allowed in a %s block", stmt.TokenLiteral(), token.Lexeme)
+			p.errorAt(p.curToken, msg)
+		}
+		p.nextToken()
+	}
+
+	return statements, true
+}
+
+// parsePragmaStatement parses pragma name followed by numeric arguments, each
+// with an optional sign, up to the end of the line, a ; or a }.
+func (p *Parser) parsePragmaStatement() Statement {
+	stmt := &PragmaStatement{Token: p.curToken}
+
+	if !p.expectPeek(constants.TOKEN_VARIABLE) {
+		return nil
+	}
+	stmt.Name = p.curToken.Lexeme
+
+	for p.peekToken.Line == stmt.Token.Line && !p.peekTokenIs(constants.TOKEN_EOF) &&
+		!p.peekTokenIs(constants.TOKEN_SEMICOLON) && !p.peekTokenIs(constants.TOKEN_RIGHT_BRACE) {
+		p.nextToken()
+		sign := 1.0
+		if p.curToken.Type == constants.TOKEN_MINUS && p.peekTokenIs(constants.TOKEN_NUMBER) && p.peekToken.Line == stmt.Token.Line {
+			sign = -1
+			p.nextToken()
+		}
+		if p.curToken.Type != constants.TOKEN_NUMBER {
+			msg := fmt.Sprintf("unexpected %s in pragma %s on line %d, column %d", p.curToken.Lexeme, stmt.Name, p.curToken.Line, p.curToken.Column)
+			p.errorAt(p.curToken, msg)
+			p.skipLine(stmt.Token.Line)
+			return nil
+		}
+
+		value, err := strconv.ParseFloat(p.curToken.Lexeme, 64)
+		if err != nil {
+			msg := fmt.Sprintf("could not parse %q as float", p.curToken.Lexeme)
+			p.errorAt(p.curToken, msg)
+			return nil
+		}
+		stmt.Arguments = append(stmt.Arguments, sign*value)
+	}
+
+	return stmt
+}
+
+// skipLine skips the rest of a line after an error, so that its tokens are
+// not reported again as statements.
+func (p *Parser) skipLine(line int) {
+	for !p.peekTokenIs(constants.TOKEN_EOF) && p.peekToken.Line == line {
+		p.nextToken()
+	}
+}
+
+// parseVarDeclaration parses var name: type, optionally followed by a domain
+// in [low, high] or in {a, b, c}.
+func (p *Parser) parseVarDeclaration() Statement {
+	stmt := &VarDeclaration{Token: p.curToken}
+
+	if !p.expectPeek(constants.TOKEN_VARIABLE) {
+		return nil
+	}
+	stmt.Name = p.curToken.Lexeme
+
+	if !p.expectPeek(constants.TOKEN_COLON) {
+		return nil
+	}
+
+	if !p.expectPeek(constants.TOKEN_VARIABLE) {
+		return nil
+	}
+	stmt.Type = p.curToken.Lexeme
+
+	if !p.peekTokenIs(constants.TOKEN_IN) {
+		return stmt
+	}
+	p.nextToken()
+
+	switch {
+	case p.peekTokenIs(constants.TOKEN_LEFT_BRACKET):
+		p.nextToken()
+		stmt.Interval = p.parseExpressionList(constants.TOKEN_RIGHT_BRACKET)
+		if len(stmt.Interval) != 2 {
+			msg := fmt.Sprintf("domain of %s must be an interval [low, high]", stmt.Name)
+			p.errorAt(p.curToken, msg)
+			return nil
+		}
+	case p.peekTokenIs(constants.TOKEN_LEFT_BRACE):
+		p.nextToken()
+		stmt.Members = p.parseExpressionList(constants.TOKEN_RIGHT_BRACE)
+		if stmt.Members == nil {
+			return nil
+		}
+	default:
+		msg := fmt.Sprintf("expected [low, high] or {a, b} after in, got %s instead", p.peekToken.Lexeme)
+		p.errorAt(p.curToken, msg)
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpression(precedence int) Expression {
 	prefix := p.prefixParseFns(p.curToken.Type)
 	if prefix == nil {
@@ -108,10 +646,22 @@ func (p *Parser) prefixParseFns(tokenType constants.TokenType) func() Expression
 		return p.parseVariable
 	case constants.TOKEN_NUMBER:
 		return p.parseNumberLiteral
-	case constants.TOKEN_NOT:
+	case constants.TOKEN_QUANTITY:
+		return p.parseQuantityLiteral
+	case constants.TOKEN_TIME:
+		return p.parseTimeLiteral
+	case constants.TOKEN_STRING:
+		return p.parseStringLiteral
+	case constants.TOKEN_NOT, constants.TOKEN_MINUS:
 		return p.parsePrefixExpression
 	case constants.TOKEN_LEFT_PAREN:
 		return p.parseGroupedExpression
+	case constants.TOKEN_LEFT_BRACKET:
+		return p.parseListLiteral
+	case constants.TOKEN_FORALL, constants.TOKEN_EXISTS:
+		return p.parseQuantifierExpression
+	case constants.TOKEN_IF:
+		return p.parseConditionalExpression
 	default:
 		return nil
 	}
@@ -119,15 +669,47 @@ func (p *Parser) prefixParseFns(tokenType constants.TokenType) func() Expression
 
 func (p *Parser) infixParseFns(tokenType constants.TokenType) func(Expression) Expression {
 	switch tokenType {
-	case constants.TOKEN_PLUS, constants.TOKEN_MINUS, constants.TOKEN_DIVIDE, constants.TOKEN_MULTIPLY, constants.TOKEN_DOUBLE_EQUAL, constants.TOKEN_NOT_EQUAL:
+	case constants.TOKEN_PLUS, constants.TOKEN_MINUS, constants.TOKEN_DIVIDE, constants.TOKEN_MULTIPLY, constants.TOKEN_DOUBLE_EQUAL, constants.TOKEN_NOT_EQUAL, constants.TOKEN_APPROX,
+		constants.TOKEN_LESS, constants.TOKEN_LESS_EQUAL, constants.TOKEN_GREATER, constants.TOKEN_GREATER_EQUAL, constants.TOKEN_IN,
+		constants.TOKEN_COALESCE:
 		return p.parseInfixExpression
+	case constants.TOKEN_RANGE:
+		return p.parseRangeExpression
+	case constants.TOKEN_LEFT_BRACKET:
+		return p.parseIndexExpression
+	case constants.TOKEN_DOT:
+		return p.parseMemberExpression
+	case constants.TOKEN_LEFT_PAREN:
+		return p.parseCallExpression
 	default:
 		return nil
 	}
 }
 
 func (p *Parser) parseVariable() Expression {
-	return &Variable{Token: p.curToken, Value: p.curToken.Lexeme}
+	return p.resolve(&Variable{Token: p.curToken, Value: p.curToken.Lexeme})
+}
+
+// resolve replaces a variable that names a let by a copy of the expression of
+// the let, so that each use is a tree of its own.
+// A def must be called, so its name has to be followed by arguments.
+func (p *Parser) resolve(variable *Variable) Expression {
+	if p.bound[variable.Value] > 0 {
+		return variable
+	}
+
+	definition := p.lookup(variable.Value)
+	switch {
+	case definition == nil:
+		return variable
+	case definition.Keyword == "let":
+		return cloneExpression(definition.Body)
+	case !p.peekTokenIs(constants.TOKEN_LEFT_PAREN):
+		p.errorAt(variable.Token, fmt.Sprintf("%s is a def and must be called with %d arguments", variable.Value, len(definition.Parameters)))
+		return nil
+	default:
+		return variable
+	}
 }
 
 func (p *Parser) parseNumberLiteral() Expression {
@@ -136,7 +718,7 @@ func (p *Parser) parseNumberLiteral() Expression {
 	value, err := strconv.ParseFloat(p.curToken.Lexeme, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Lexeme)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, msg)
 		return nil
 	}
 
@@ -144,6 +726,37 @@ func (p *Parser) parseNumberLiteral() Expression {
 	return lit
 }
 
+// parseQuantityLiteral splits a literal like 1.5GiB into its number and unit.
+func (p *Parser) parseQuantityLiteral() Expression {
+	lexeme := p.curToken.Lexeme
+	split := strings.IndexFunc(lexeme, unicode.IsLetter)
+
+	value, err := strconv.ParseFloat(lexeme[:split], 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", lexeme[:split])
+		p.errorAt(p.curToken, msg)
+		return nil
+	}
+
+	unitName := lexeme[split:]
+	if _, ok := units[unitName]; !ok {
+		p.errorAt(p.curToken, unknownUnitError(unitName).Error())
+		return nil
+	}
+
+	return &QuantityLiteral{Token: p.curToken, Value: value, Unit: unitName}
+}
+
+func (p *Parser) parseTimeLiteral() Expression {
+	value, err := parseTime(p.curToken.Lexeme)
+	if err != nil {
+		p.errorAt(p.curToken, err.Error())
+		return nil
+	}
+
+	return &TimeLiteral{Token: p.curToken, Value: value}
+}
+
 func (p *Parser) parsePrefixExpression() Expression {
 	expression := &PrefixExpression{
 		Token:    p.curToken,
@@ -158,6 +771,10 @@ func (p *Parser) parsePrefixExpression() Expression {
 }
 
 func (p *Parser) parseInfixExpression(left Expression) Expression {
+	if isComparison(p.curToken.Type) {
+		return p.parseComparison(left)
+	}
+
 	expression := &InfixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Lexeme,
@@ -171,6 +788,209 @@ func (p *Parser) parseInfixExpression(left Expression) Expression {
 	return expression
 }
 
+func (p *Parser) parseStringLiteral() Expression {
+	return &StringLiteral{Token: p.curToken, Value: p.curToken.Lexeme}
+}
+
+func (p *Parser) parseListLiteral() Expression {
+	list := &ListLiteral{Token: p.curToken}
+	list.Elements = p.parseExpressionList(constants.TOKEN_RIGHT_BRACKET)
+	if list.Elements == nil {
+		return nil
+	}
+	return list
+}
+
+func (p *Parser) parseIndexExpression(left Expression) Expression {
+	exp := &IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(constants.TOKEN_RIGHT_BRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseMemberExpression(left Expression) Expression {
+	exp := &MemberExpression{Token: p.curToken, Object: left}
+
+	if !p.expectPeek(constants.TOKEN_VARIABLE) {
+		return nil
+	}
+	exp.Property = p.curToken.Lexeme
+
+	if namespace, ok := left.(*Variable); ok && p.bound[namespace.Value] == 0 && p.isNamespace(namespace.Value) {
+		name := namespace.Value + "." + exp.Property
+		// Format does not read imported files, their names are not checked.
+		if p.lookup(name) == nil && !p.isNamespace(name) && p.layout == nil {
+			p.errorAt(exp.Token, fmt.Sprintf("%s has no let or def named %s", namespace.Value, exp.Property))
+			return nil
+		}
+		return p.resolve(&Variable{Token: namespace.Token, Value: name})
+	}
+
+	return exp
+}
+
+func (p *Parser) parseCallExpression(left Expression) Expression {
+	function, ok := left.(*Variable)
+	if !ok {
+		msg := fmt.Sprintf("cannot call %s, expected a function name", left.String())
+		p.errorAt(p.curToken, msg)
+		return nil
+	}
+
+	exp := &CallExpression{Token: p.curToken, Function: function.Value}
+	exp.Arguments = p.parseExpressionList(constants.TOKEN_RIGHT_PAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
+
+	if p.bound[function.Value] == 0 {
+		if definition := p.lookup(function.Value); definition != nil {
+			if len(exp.Arguments) != len(definition.Parameters) {
+				p.errorAt(exp.Token, fmt.Sprintf("%s expects %d arguments, got %d", function.Value, len(definition.Parameters), len(exp.Arguments)))
+				return nil
+			}
+			exp.Function = p.qualify(function.Value)
+			exp.definition = definition
+		}
+	}
+	return exp
+}
+
+func (p *Parser) parseRangeExpression(left Expression) Expression {
+	exp := &RangeExpression{Token: p.curToken, Start: left}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	exp.End = p.parseExpression(precedence)
+
+	return exp
+}
+
+// parseQuantifierExpression parses forall x in domain: body and the exists
+// form. The body extends as far to the right as possible.
+func (p *Parser) parseQuantifierExpression() Expression {
+	exp := &QuantifierExpression{Token: p.curToken, Quantifier: p.curToken.Lexeme}
+
+	if !p.expectPeek(constants.TOKEN_VARIABLE) {
+		return nil
+	}
+	exp.Variable = p.curToken.Lexeme
+
+	if !p.expectPeek(constants.TOKEN_IN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Domain = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(constants.TOKEN_COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	p.bind(exp.Variable)
+	exp.Body = p.parseExpression(LOWEST)
+	p.unbind(exp.Variable)
+
+	return exp
+}
+
+// parseConditionalExpression parses if cond then a else b. Like a quantifier
+// body, the else branch extends as far to the right as possible.
+func (p *Parser) parseConditionalExpression() Expression {
+	exp := &ConditionalExpression{Token: p.curToken}
+
+	p.nextToken()
+	exp.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(constants.TOKEN_THEN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(constants.TOKEN_ELSE) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Alternative = p.parseExpression(LOWEST)
+
+	return exp
+}
+
+// parseExpressionList parses comma separated expressions up to the end token.
+// It returns nil if the list is malformed.
+func (p *Parser) parseExpressionList(end constants.TokenType) []Expression {
+	list := []Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(constants.TOKEN_COMMA) {
+		p.nextToken()
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+// parseComparison parses a comparison and any comparisons chained after it,
+// like lo <= x < hi. A single comparison is returned as an InfixExpression.
+func (p *Parser) parseComparison(left Expression) Expression {
+	chain := &ChainedComparison{Token: p.curToken, Operands: []Expression{left}}
+
+	for {
+		chain.Operators = append(chain.Operators, p.curToken.Lexeme)
+
+		precedence := p.curPrecedence()
+		p.nextToken()
+		chain.Operands = append(chain.Operands, p.parseExpression(precedence))
+
+		if !isComparison(p.peekToken.Type) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if len(chain.Operators) == 1 {
+		return &InfixExpression{
+			Token:    chain.Token,
+			Operator: chain.Operators[0],
+			Left:     chain.Operands[0],
+			Right:    chain.Operands[1],
+		}
+	}
+
+	return chain
+}
+
+func isComparison(t constants.TokenType) bool {
+	switch t {
+	case constants.TOKEN_LESS, constants.TOKEN_LESS_EQUAL, constants.TOKEN_GREATER, constants.TOKEN_GREATER_EQUAL:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *Parser) parseGroupedExpression() Expression {
 	p.nextToken()
 
@@ -185,7 +1005,7 @@ func (p *Parser) parseGroupedExpression() Expression {
 
 func (p *Parser) noPrefixParseFnError(t constants.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %v found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, msg)
 }
 
 func (p *Parser) expectPeek(t constants.TokenType) bool {
@@ -204,30 +1024,46 @@ func (p *Parser) peekTokenIs(t constants.TokenType) bool {
 
 func (p *Parser) peekError(t constants.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %v, got %v instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, msg)
 }
 
 // Operator precedence
 const (
 	_ int = iota
 	LOWEST
-	EQUALS    // ==
-	NOT_EQUAL // <=
-	SUBTRACT  // -
-	SUM       // +
-	PRODUCT   // *
-	DIVISION  // /
-	PREFIX    // -X or !X
+	EQUALS      // == or ~=
+	NOT_EQUAL   // !=
+	LESSGREATER // <, <=, >, >= or in
+	RANGE       // 0..n
+	COALESCE    // x ?? 0
+	SUBTRACT    // -
+	SUM         // +
+	PRODUCT     // *
+	DIVISION    // /
+	PREFIX      // -X or !X
+	CALL        // sum(X)
+	INDEX       // xs[0] or a.b
 )
 
 var precedences = map[constants.TokenType]int{
-	constants.TOKEN_DOUBLE_EQUAL: EQUALS,
-	constants.TOKEN_NOT_EQUAL:    NOT_EQUAL,
-	constants.TOKEN_MINUS:        SUBTRACT,
-	constants.TOKEN_PLUS:         SUM,
-	constants.TOKEN_MULTIPLY:     PRODUCT,
-	constants.TOKEN_DIVIDE:       DIVISION,
-	constants.TOKEN_NOT:          PREFIX,
+	constants.TOKEN_DOUBLE_EQUAL:  EQUALS,
+	constants.TOKEN_APPROX:        EQUALS,
+	constants.TOKEN_NOT_EQUAL:     NOT_EQUAL,
+	constants.TOKEN_LESS:          LESSGREATER,
+	constants.TOKEN_LESS_EQUAL:    LESSGREATER,
+	constants.TOKEN_GREATER:       LESSGREATER,
+	constants.TOKEN_GREATER_EQUAL: LESSGREATER,
+	constants.TOKEN_IN:            LESSGREATER,
+	constants.TOKEN_RANGE:         RANGE,
+	constants.TOKEN_COALESCE:      COALESCE,
+	constants.TOKEN_MINUS:         SUBTRACT,
+	constants.TOKEN_PLUS:          SUM,
+	constants.TOKEN_MULTIPLY:      PRODUCT,
+	constants.TOKEN_DIVIDE:        DIVISION,
+	constants.TOKEN_NOT:           PREFIX,
+	constants.TOKEN_LEFT_PAREN:    CALL,
+	constants.TOKEN_LEFT_BRACKET:  INDEX,
+	constants.TOKEN_DOT:           INDEX,
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -1,13 +1,110 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"parser/constants"
 	"parser/lexer"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
+// evaluate evaluates a program and returns its results and whether it
+// succeeded.
+func evaluate(program ProgramEvaluator) ([]Result, bool) {
+	report := program.Evaluate()
+	return report.Results, report.Success()
+}
+
+func resultValues(results []Result) []float64 {
+	values := make([]float64, len(results))
+	for i, result := range results {
+		values[i] = result.Value
+	}
+	return values
+}
+
+// runValuesTestCases partially evaluates every test case, then evaluates it
+// with its values, units and clock.
+func runValuesTestCases(t *testing.T, testCases []ValuesTestCase) {
+	t.Helper()
+	for _, testCase := range testCases {
+		t.Log("Testing:", testCase.input)
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != 0 {
+			t.Errorf("Parser errors: %v", p.Errors())
+			continue
+		}
+
+		partialResults, _, success := program.PartialEvaluate()
+		require.True(t, success)
+		require.Equal(t, testCase.expectedPartialResults, partialResults)
+
+		require.NoError(t, program.SetValues(testCase.values))
+		if testCase.units != nil {
+			require.NoError(t, program.SetUnits(testCase.units))
+		}
+		if testCase.clock != nil {
+			program.SetClock(testCase.clock)
+		}
+
+		results, success := evaluate(program)
+		require.Equal(t, testCase.succeed, success)
+		require.Equal(t, testCase.expectedResults, resultValues(results))
+	}
+}
+
+func resultErrors(results []Result) []error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return errs
+}
+
+// resultMessages returns the errors of results and the reasons skipped asserts
+// were skipped, in order.
+func resultMessages(results []Result) []string {
+	var messages []string
+	for _, result := range results {
+		if message := resultMessage(result); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// resultMessage returns the error of a result or, for a skipped assert, the
+// reason it was skipped.
+func resultMessage(result Result) string {
+	if result.Err != nil {
+		return result.Err.Error()
+	}
+	return result.Reason
+}
+
+func errorStrings(errs []error) []string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
+
 type ParserTestCase struct {
 	input                  string
 	expectedResults        []float64
@@ -62,7 +159,7 @@ func TestParser(t *testing.T) {
 			},
 		},
 		{
-			input:           "assert (x * 6.00)",
+			input:           "assert (x * 6)",
 			expectedResults: []float64{0},
 			succeed:         true,
 			valueMap: map[string]float64{
@@ -125,9 +222,9 @@ func TestParser(t *testing.T) {
 			program.SetValueMap(testCase.valueMap)
 		}
 
-		results, _, success := program.Evaluate()
+		results, success := evaluate(program)
 		require.Equal(t, testCase.succeed, success)
-		require.Equal(t, testCase.expectedResults, results)
+		require.Equal(t, testCase.expectedResults, resultValues(results))
 	}
 }
 
@@ -135,22 +232,22 @@ func TestPartialEvaluation(t *testing.T) {
 	testCases := []ParserTestCase{
 		{
 			input:                  "assert x * (2 * 3)",
-			expectedPartialResults: []string{"assert (x * 6.00)"},
+			expectedPartialResults: []string{"assert (x * 6)"},
 			succeed:                true,
 		},
 		{
 			input:                  "assert x * (2 * 3) == 6",
-			expectedPartialResults: []string{"assert ((x * 6.00) == 6.00)"},
+			expectedPartialResults: []string{"assert ((x * 6) == 6)"},
 			succeed:                true,
 		},
 		{
 			input:                  "assert x * y + (2 * 3)\n assert (z + 2) * 3",
-			expectedPartialResults: []string{"assert ((x * y) + 6.00)", "assert ((z + 2.00) * 3.00)"},
+			expectedPartialResults: []string{"assert ((x * y) + 6)", "assert ((z + 2) * 3)"},
 			succeed:                true,
 		},
 		{
 			input:                  "assert !(1 * 0) * x + (5 * 6 - y)",
-			expectedPartialResults: []string{"assert ((1.00 * x) + (30.00 - y))"},
+			expectedPartialResults: []string{"assert ((1 * x) + (30 - y))"},
 			succeed:                true,
 		},
 	}
@@ -187,13 +284,13 @@ func TestDualParser(t *testing.T) {
 	testCases := []DualParserTestCase{
 		{
 			initialInput:          "assert x * (2 * 3)",
-			partialEvaluatedInput: []string{"assert (x * 6.00)"},
+			partialEvaluatedInput: []string{"assert (x * 6)"},
 			valueMap:              map[string]float64{"x": 0},
 			expectedResults:       []float64{0},
 		},
 		{
 			initialInput:          "assert (2 + 6) * (x - 3) \n assert (y + 6) \n assert z * 2",
-			partialEvaluatedInput: []string{"assert (8.00 * (x - 3.00))", "assert (y + 6.00)", "assert (z * 2.00)"},
+			partialEvaluatedInput: []string{"assert (8 * (x - 3))", "assert (y + 6)", "assert (z * 2)"},
 			valueMap:              map[string]float64{"x": 3, "y": -6, "z": 0},
 			expectedResults:       []float64{0, 0, 0},
 		},
@@ -216,10 +313,6 @@ func TestDualParser(t *testing.T) {
 
 		combinedResult := strings.Join(results, "\n")
 
-		if len(testCase.valueMap) > 0 {
-			program.SetValueMap(testCase.valueMap)
-		}
-
 		l = lexer.NewLexer(combinedResult)
 		p = NewParser(l)
 		program = p.ParseProgram()
@@ -229,8 +322,2527 @@ func TestDualParser(t *testing.T) {
 			continue
 		}
 
-		parsedResults, _, success := program.Evaluate()
+		if len(testCase.valueMap) > 0 {
+			program.SetValueMap(testCase.valueMap)
+		}
+
+		parsedResults, success := evaluate(program)
 		require.True(t, success)
-		require.Equal(t, testCase.expectedResults, parsedResults)
+		require.Equal(t, testCase.expectedResults, resultValues(parsedResults))
+	}
+}
+
+type ValuesTestCase struct {
+	input                  string
+	values                 map[string]any
+	units                  map[string]string
+	clock                  func() time.Time
+	expectedResults        []float64
+	expectedPartialResults []string
+	succeed                bool
+}
+
+func TestListsAndAggregates(t *testing.T) {
+	testCases := []ValuesTestCase{
+		{
+			input:                  `assert region in ["eu", "us"]`,
+			values:                 map[string]any{"region": "eu"},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{`assert (region in ["eu", "us"])`},
+			succeed:                true,
+		},
+		{
+			input:                  `assert region in ["eu", "us"]`,
+			values:                 map[string]any{"region": "ap"},
+			expectedResults:        []float64{1},
+			expectedPartialResults: []string{`assert (region in ["eu", "us"])`},
+			succeed:                false,
+		},
+		{
+			input:                  "assert sum(latencies) / len(latencies) < 100",
+			values:                 map[string]any{"latencies": []any{80.0, 120.0, 70.0}},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert ((sum(latencies) / len(latencies)) < 100)"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert max(errors) == 0",
+			values:                 map[string]any{"errors": []float64{0, 2, 0}},
+			expectedResults:        []float64{1},
+			expectedPartialResults: []string{"assert (max(errors) == 0)"},
+			succeed:                false,
+		},
+		{
+			input:                  "assert xs[1] - [4, 5, 6][2] == -1",
+			values:                 map[string]any{"xs": []any{1, 5}},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert ((xs[1] - 6) == -1)"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert sum([1, 2, 3]) + avg([2, 4]) - 2 == min([9, 12]) + count([1, 2]) * max([-1, -2])",
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert 0"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert percentile([15, 20, 35, 40, 50], 50) == 35\n assert percentile([1, 2], 50) == 1.5",
+			expectedResults:        []float64{0, 0},
+			expectedPartialResults: []string{"assert 0", "assert 0"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert x <= 2\n assert x != 2\n assert x >= 3",
+			values:                 map[string]any{"x": 2},
+			expectedResults:        []float64{0, 1, 1},
+			expectedPartialResults: []string{"assert (x <= 2)", "assert (x != 2)", "assert (x >= 3)"},
+			succeed:                false,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+}
+
+func TestListErrors(t *testing.T) {
+	testCases := []struct {
+		input         string
+		values        map[string]any
+		expectedError string
+	}{
+		{input: "assert [1, 2]", expectedError: "expected number, got list"},
+		{input: "assert xs[3]", values: map[string]any{"xs": []any{1}}, expectedError: "index out of range: 3 with length 1"},
+		{input: "assert avg([])", expectedError: "avg: empty list"},
+		{input: "assert foo(1)", expectedError: "unknown function: foo"},
+		{input: "assert 1 in 2", expectedError: "in: expected list, got number"},
+	}
+
+	for _, testCase := range testCases {
+		t.Log("Testing:", testCase.input)
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(testCase.values))
+
+		results, success := evaluate(program)
+		require.False(t, success)
+		errs := resultErrors(results)
+		require.Len(t, errs, 1)
+		require.Contains(t, errs[0].Error(), testCase.expectedError)
+	}
+}
+
+func TestQuantifiers(t *testing.T) {
+	testCases := []ValuesTestCase{
+		{
+			input:                  "assert forall s in lags: s < 5",
+			values:                 map[string]any{"lags": []any{1, 2, 4}},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert (forall s in lags: (s < 5))"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert exists i in 0..n: xs[i] == 0",
+			values:                 map[string]any{"n": 3, "xs": []any{4, 0, 1}},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert (exists i in (0..n): (xs[i] == 0))"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert exists i in 0..3: i == 3",
+			expectedResults:        []float64{1},
+			expectedPartialResults: []string{"assert (exists i in (0..3): (i == 3))"},
+			succeed:                false,
+		},
+		{
+			input:                  "assert forall s in shards: s <= 5\n assert s == 7",
+			values:                 map[string]any{"shards": map[string]any{"a": 1, "b": 5}, "s": 7},
+			expectedResults:        []float64{0, 0},
+			expectedPartialResults: []string{"assert (forall s in shards: (s <= 5))", "assert (s == 7)"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert forall i in [1, 2]: exists j in [2, 3]: i * 2 != j",
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert (forall i in [1, 2]: (exists j in [2, 3]: ((i * 2) != j)))"},
+			succeed:                true,
+		},
+		{
+			// Quantifiers and in do not build the list of a range.
+			input:                  "assert exists i in 0..1000000000: i == 3\n assert n in 0..1000000000\n assert 2.5 in 0..1000000000",
+			values:                 map[string]any{"n": 999999999},
+			expectedResults:        []float64{0, 0, 1},
+			expectedPartialResults: []string{"assert (exists i in (0..1000000000): (i == 3))", "assert (n in (0..1000000000))", "assert (2.5 in (0..1000000000))"},
+			succeed:                false,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+
+	program := NewParser(lexer.NewLexer("assert len(0..1000000000) > 0")).ParseProgram()
+	results, _ := evaluate(program)
+	require.EqualError(t, results[0].Err, "error evaluating statement 1: range 0..1000000000 has 1000000000 elements, more than the 1000000 a list can have; only quantifiers and in take longer ranges")
+}
+
+func TestQuantifierFailureReports(t *testing.T) {
+	testCases := []struct {
+		input         string
+		values        map[string]any
+		expectedError string
+	}{
+		{
+			input:         "assert forall s in lags: s < 5",
+			values:        map[string]any{"lags": []any{1, 7, 9}},
+			expectedError: "violated by s = 7 (index 1)",
+		},
+		{
+			input:         "assert forall s in shards: s < 5",
+			values:        map[string]any{"shards": map[string]any{"b": 9, "a": 1}},
+			expectedError: `violated by s = 9 (key "b")`,
+		},
+		{
+			input:         "assert exists i in 0..2: i > 4",
+			expectedError: "no i in 2 elements satisfied the body",
+		},
+		{
+			input:         "assert forall i in 0..2: [5][i] == 5",
+			expectedError: "forall i = 1 (index 1): [5]: index out of range: 1 with length 1",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Log("Testing:", testCase.input)
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(testCase.values))
+
+		results, success := evaluate(program)
+		require.False(t, success)
+		errs := resultErrors(results)
+		require.Len(t, errs, 1)
+		require.Contains(t, errs[0].Error(), testCase.expectedError)
+	}
+}
+
+func TestNestedObjects(t *testing.T) {
+	snapshot := map[string]any{
+		"db": map[string]any{
+			"pool":   map[string]any{"max": 50, "used": 12},
+			"region": "eu",
+		},
+		"shards": []any{
+			map[string]any{"name": "a", "lag": 1},
+			map[string]any{"name": "b", "lag": 3},
+		},
+	}
+
+	testCases := []ValuesTestCase{
+		{
+			input:                  "assert db.pool.max == 50",
+			values:                 snapshot,
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert (db.pool.max == 50)"},
+			succeed:                true,
+		},
+		{
+			input:                  `assert db["pool"]["used"] < db.pool.max / 2`,
+			values:                 snapshot,
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{`assert (db["pool"]["used"] < (db.pool.max / 2))`},
+			succeed:                true,
+		},
+		{
+			input:                  `assert forall s in shards: s.lag < 5` + "\n" + `assert "pool" in db` + "\n" + `assert db.region in ["eu", "us"]`,
+			values:                 snapshot,
+			expectedResults:        []float64{0, 0, 0},
+			expectedPartialResults: []string{"assert (forall s in shards: (s.lag < 5))", `assert ("pool" in db)`, `assert (db.region in ["eu", "us"])`},
+			succeed:                true,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+}
+
+func TestNestedObjectErrors(t *testing.T) {
+	values := map[string]any{
+		"db": map[string]any{"pool": map[string]any{"max": 50, "min": 5}},
+	}
+
+	testCases := []struct {
+		input         string
+		expectedError string
+	}{
+		{input: "assert db.pool.size", expectedError: `db.pool: unknown field "size" (available: max, min)`},
+		{input: "assert db.pol.max", expectedError: `db: unknown field "pol" (available: pool)`},
+		{input: `assert db["pool"]["size"]`, expectedError: `db["pool"]: unknown field "size" (available: max, min)`},
+		{input: "assert db.pool.max.value", expectedError: `db.pool.max: cannot access field "value" on number`},
+		{input: "assert cache.size", expectedError: "unknown variable: cache"},
+	}
+
+	for _, testCase := range testCases {
+		t.Log("Testing:", testCase.input)
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(values))
+
+		results, success := evaluate(program)
+		require.False(t, success)
+		errs := resultErrors(results)
+		require.Len(t, errs, 1)
+		require.Contains(t, errs[0].Error(), testCase.expectedError)
+	}
+}
+
+func TestMissingValues(t *testing.T) {
+	testCases := []ValuesTestCase{
+		{
+			input:                  "assert defined(x)\n assert defined(y)\n assert defined(db.pool.max)\n assert !defined(db.cache)",
+			values:                 map[string]any{"x": 1, "db": map[string]any{"pool": map[string]any{"max": 5}, "cache": nil}},
+			expectedResults:        []float64{0, 1, 0, 0},
+			expectedPartialResults: []string{"assert defined(x)", "assert defined(y)", "assert defined(db.pool.max)", "assert (! defined(db.cache))"},
+			succeed:                false,
+		},
+		{
+			input:                  "assert x ?? 0 < 5\n assert (y ?? 3) + 1 == 4\n assert db.pool.size ?? db.pool.max == 5",
+			values:                 map[string]any{"x": 1, "db": map[string]any{"pool": map[string]any{"max": 5}}},
+			expectedResults:        []float64{0, 0, 0},
+			expectedPartialResults: []string{"assert ((x ?? 0) < 5)", "assert (((y ?? 3) + 1) == 4)", "assert ((db.pool.size ?? db.pool.max) == 5)"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert 2 ?? x\n assert defined(3)",
+			expectedResults:        []float64{2, 0},
+			expectedPartialResults: []string{"assert 2", "assert 0"},
+			succeed:                false,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+}
+
+func TestMissingPolicy(t *testing.T) {
+	testCases := []struct {
+		policy           MissingPolicy
+		expectedStatuses []Status
+		succeed          bool
+	}{
+		{policy: MissingFail, expectedStatuses: []Status{StatusPass, StatusError, StatusError, StatusFail}, succeed: false},
+		{policy: MissingSkip, expectedStatuses: []Status{StatusPass, StatusSkip, StatusSkip, StatusFail}, succeed: false},
+		{policy: MissingUnknown, expectedStatuses: []Status{StatusPass, StatusUnknown, StatusUnknown, StatusFail}, succeed: false},
+	}
+
+	input := "assert x == 1\n assert y == 1\n assert forall s in shards: s.lag < 5\n assert x == 2"
+	values := map[string]any{"x": 1, "shards": []any{map[string]any{"name": "a"}}}
+
+	for _, testCase := range testCases {
+		t.Log("Testing policy:", testCase.policy)
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(values))
+		program.SetMissingPolicy(testCase.policy)
+
+		results, success := evaluate(program)
+		require.Equal(t, testCase.succeed, success)
+
+		statuses := make([]Status, len(results))
+		for i, result := range results {
+			statuses[i] = result.Status
+		}
+		require.Equal(t, testCase.expectedStatuses, statuses)
+		require.Contains(t, resultMessage(results[1]), "unknown variable: y")
+	}
+}
+
+func TestConditionalExpression(t *testing.T) {
+	testCases := []ValuesTestCase{
+		{
+			input:                  "assert latency < (if premium == 1 then 100 else 300)",
+			values:                 map[string]any{"latency": 150, "premium": 1},
+			expectedResults:        []float64{1},
+			expectedPartialResults: []string{"assert (latency < (if (premium == 1) then 100 else 300))"},
+			succeed:                false,
+		},
+		{
+			input:                  "assert latency < (if premium == 1 then 100 else 300)",
+			values:                 map[string]any{"latency": 150, "premium": 0},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert (latency < (if (premium == 1) then 100 else 300))"},
+			succeed:                true,
+		},
+		{
+			input:                  `assert if mode == "batch" then true_value else missing / 0`,
+			values:                 map[string]any{"mode": "batch", "true_value": 0},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{`assert (if (mode == "batch") then true_value else (missing / 0))`},
+			succeed:                true,
+		},
+		{
+			input:                  "assert x < (if 1 == 1 then 2 * 5 else y)\n assert if 2 < 1 then x else y + 1",
+			values:                 map[string]any{"x": 3, "y": -1},
+			expectedResults:        []float64{0, 0},
+			expectedPartialResults: []string{"assert (x < 10)", "assert (y + 1)"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert latency < (if premium then 100 else 300)",
+			values:                 map[string]any{"latency": 150, "premium": true},
+			expectedResults:        []float64{1},
+			expectedPartialResults: []string{"assert (latency < (if premium then 100 else 300))"},
+			succeed:                false,
+		},
+		{
+			input:                  "assert latency < (if premium then 100 else 300)",
+			values:                 map[string]any{"latency": 150, "premium": false},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert (latency < (if premium then 100 else 300))"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert enabled\n assert !enabled\n assert forall f in flags: f",
+			values:                 map[string]any{"enabled": true, "flags": []any{true, false}},
+			expectedResults:        []float64{0, 1, 1},
+			expectedPartialResults: []string{"assert enabled", "assert (! enabled)", "assert (forall f in flags: f)"},
+			succeed:                false,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+
+	program := NewParser(lexer.NewLexer("assert x < if c then 1 else 2 + 3")).ParseProgram().(*Program)
+	require.Equal(t, "assert (x < (if c then 1 else (2 + 3)))", program.Statements[0].String())
+}
+
+func TestChainedComparisons(t *testing.T) {
+	testCases := []ValuesTestCase{
+		{
+			input:                  "assert lo <= x < hi",
+			values:                 map[string]any{"lo": 1, "x": 1, "hi": 5},
+			expectedResults:        []float64{0},
+			expectedPartialResults: []string{"assert (lo <= x < hi)"},
+			succeed:                true,
+		},
+		{
+			input:                  "assert 0 <= x * 2 < 10\n assert 0 < 1 <= x\n assert x < 1 < 2 < y",
+			values:                 map[string]any{"x": 5, "y": 3},
+			expectedResults:        []float64{1, 0, 1},
+			expectedPartialResults: []string{"assert (0 <= (x * 2) < 10)", "assert (1 <= x)", "assert (x < 1 < 2 < y)"},
+			succeed:                false,
+		},
+		{
+			input:                  "assert 1 < 2 <= 2\n assert 3 < 2 < x\n assert x > 2 >= 3",
+			values:                 map[string]any{"x": 5},
+			expectedResults:        []float64{0, 1, 1},
+			expectedPartialResults: []string{"assert 0", "assert 1", "assert 1"},
+			succeed:                false,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+}
+
+func TestChainedComparisonFailureReports(t *testing.T) {
+	l := lexer.NewLexer("assert 0 <= x < 10")
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	program.SetValueMap(map[string]float64{"x": 12})
+	results, success := evaluate(program)
+	require.False(t, success)
+	require.Contains(t, results[0].Err.Error(), "assertion failed: (0 <= x < 10): link 2 (x < 10) failed with 12 < 10")
+
+	program.SetValueMap(map[string]float64{"x": -1})
+	results, success = evaluate(program)
+	require.False(t, success)
+	require.Contains(t, results[0].Err.Error(), "link 1 (0 <= x) failed with 0 <= -1")
+}
+
+func TestResidualNumbers(t *testing.T) {
+	input := `assert x < 0.001s
+assert y < 1 / 3
+assert y == avg([0.1, 0.2, 0.25])
+assert 0.1 + 0.2 == 0.3`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	partialResults, errs, success := program.PartialEvaluate()
+	require.True(t, success)
+	require.Empty(t, errs)
+	require.Equal(t, []string{
+		"assert (x < 0.001s)",
+		"assert (y < 0.3333333333333333)",
+		"assert (y == 0.18333333333333335)",
+		"assert 1",
+	}, partialResults)
+
+	// Folded numbers keep every digit, so the residual evaluates like the
+	// program it came from.
+	for _, program := range []ProgramEvaluator{program, NewParser(lexer.NewLexer(strings.Join(partialResults, "\n"))).ParseProgram()} {
+		require.NoError(t, program.SetUnits(map[string]string{"x": "s"}))
+		require.NoError(t, program.SetValues(map[string]any{"x": 0.0005, "y": 0.2}))
+		require.Equal(t, []float64{0, 0, 1, 1}, resultValues(program.Evaluate().Results))
+	}
+}
+
+func TestApproximateEquality(t *testing.T) {
+	testCases := []ValuesTestCase{
+		{
+			input:                  "assert 0.1 + 0.2 == 0.3\n assert 0.1 + 0.2 ~= 0.3\n assert x + 0.2 ~= 0.3",
+			values:                 map[string]any{"x": 0.1},
+			expectedResults:        []float64{1, 0, 0},
+			expectedPartialResults: []string{"assert 1", "assert 0", "assert ((x + 0.2) ~= 0.3)"},
+			succeed:                false,
+		},
+		{
+			input:                  "assert approx(x, 100, 0.5)\n assert approx(x, 110, 0, 0.1)\n assert approx(x, 110, 0, 0.01)",
+			values:                 map[string]any{"x": 100.4},
+			expectedResults:        []float64{0, 0, 1},
+			expectedPartialResults: []string{"assert approx(x, 100, 0.5)", "assert approx(x, 110, 0, 0.1)", "assert approx(x, 110, 0, 0.01)"},
+			succeed:                false,
+		},
+		{
+			input:                  "pragma tolerance 0.5\n assert x ~= 1\n assert 1.3 ~= 1",
+			values:                 map[string]any{"x": 1.4},
+			expectedResults:        []float64{0, 0},
+			expectedPartialResults: []string{"assert approx(x, 1, 0.5, 0)", "assert 0"},
+			succeed:                true,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+}
+
+func TestProgramTolerance(t *testing.T) {
+	program := NewParser(lexer.NewLexer("pragma tolerance 0.5\n assert 1.2 ~= 1")).ParseProgram()
+
+	results, success := evaluate(program)
+	require.True(t, success)
+	require.Equal(t, []float64{0}, resultValues(results))
+
+	program.SetTolerance(0.1, 0)
+	results, success = evaluate(program)
+	require.False(t, success)
+	require.Equal(t, []float64{1}, resultValues(results))
+
+	p := NewParser(lexer.NewLexer("pragma tolerance\n pragma colour 2\n assert 1 ~= 1"))
+	p.ParseProgram()
+	require.Equal(t, []string{"pragma tolerance expects an absolute and an optional relative tolerance", "unknown pragma: colour"}, p.Errors())
+
+	for _, testCase := range []struct {
+		input         string
+		expectedError string
+	}{
+		{"pragma tolerance -1\n assert 1 ~= 1", "pragma tolerance must not be negative"},
+		{"pragma tolerance 0.1 -0.5\n assert 1 ~= 1", "pragma tolerance must not be negative"},
+		{"pragma tolerance 0.1 x\n assert 1 ~= 1", "unexpected x in pragma tolerance on line 1, column 22"},
+		{"pragma tolerance 0.1 -\n assert 1 ~= 1", "unexpected - in pragma tolerance on line 1, column 22"},
+		{"pragma tolerance 0.1 assert 1 ~= 1", "unexpected assert in pragma tolerance on line 1, column 22"},
+	} {
+		p := NewParser(lexer.NewLexer(testCase.input))
+		p.ParseProgram()
+		require.Equal(t, []string{testCase.expectedError}, p.Errors(), testCase.input)
+	}
+}
+
+func TestProgramsSideBySide(t *testing.T) {
+	input := "assert x ~= 1\n assert now() < 2024-06-01T00:00:00Z"
+	loose := NewParser(lexer.NewLexer("pragma tolerance 0.5\n" + input)).ParseProgram().(*Program)
+	strict := NewParser(lexer.NewLexer(input)).ParseProgram().(*Program)
+
+	loose.SetValueMap(map[string]float64{"x": 1.4})
+	loose.SetClock(func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) })
+	strict.SetValueMap(map[string]float64{"x": 1.1})
+	strict.SetClock(func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) })
+
+	var wg sync.WaitGroup
+	reports := make([]Report, 2)
+	for i, program := range []*Program{loose, strict} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				reports[i] = program.Evaluate()
+			}
+		}()
 	}
+	wg.Wait()
+
+	require.Equal(t, []float64{0, 0}, resultValues(reports[0].Results))
+	require.Equal(t, []float64{1, 1}, resultValues(reports[1].Results))
+
+	// Evaluations of the same program keep what they found to themselves.
+	shared := NewParser(lexer.NewLexer("assert forall s in lags: s < 5")).ParseProgram()
+	require.NoError(t, shared.SetValues(map[string]any{"lags": []any{1, 7}}))
+	reports = make([]Report, 4)
+	for i := range reports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reports[i] = shared.Evaluate()
+		}()
+	}
+	wg.Wait()
+	for _, report := range reports {
+		require.EqualError(t, report.Results[0].Err, "error evaluating statement 1: assertion failed: (forall s in lags: (s < 5)): violated by s = 7 (index 1)")
+	}
+}
+
+func TestUnits(t *testing.T) {
+	testCases := []ValuesTestCase{
+		{
+			input:                  "assert latency < 200ms\n assert latency < 200ms + 1s\n assert 1.5GiB == 1536MiB",
+			values:                 map[string]any{"latency": 0.25},
+			units:                  map[string]string{"latency": "s"},
+			expectedResults:        []float64{1, 0, 0},
+			expectedPartialResults: []string{"assert (latency < 200ms)", "assert (latency < 1200ms)", "assert 0"},
+			succeed:                false,
+		},
+		{
+			input:                  "assert avg(latencies) <= 0.1s\n assert max(latencies) * 2 < 1s\n assert used / limit < 0.8",
+			values:                 map[string]any{"latencies": []any{80, 120, 70}, "used": 700, "limit": 1},
+			units:                  map[string]string{"latencies": "ms", "used": "MiB", "limit": "GiB"},
+			expectedResults:        []float64{0, 0, 0},
+			expectedPartialResults: []string{"assert (avg(latencies) <= 0.1s)", "assert ((max(latencies) * 2) < 1s)", "assert ((used / limit) < 0.8)"},
+			succeed:                true,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+}
+
+func TestUnitMismatches(t *testing.T) {
+	input := "assert latency + memory > 0ms\n assert latency < 200\n assert (if x == 1 then 1s else 1MB) > 0s\n assert 2s * 3ms > 1s\n assert forall s in sizes: s < 1GiB"
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	program.SetValueMap(map[string]float64{"latency": 150, "memory": 512, "x": 1})
+	require.NoError(t, program.SetUnits(map[string]string{"latency": "ms", "memory": "MiB"}))
+
+	errs := program.CheckUnits()
+	require.Len(t, errs, 4)
+	require.Contains(t, errs[0].Error(), "unit mismatch in (latency + memory): + cannot combine time and data")
+	require.Contains(t, errs[1].Error(), "unit mismatch in (latency < 200): < cannot combine time and a plain number")
+	require.Contains(t, errs[2].Error(), "unit mismatch in (if (x == 1) then 1s else 1MB): branches cannot combine time and data")
+	require.Contains(t, errs[3].Error(), "unit mismatch in (2s * 3ms): * cannot combine time and time")
+
+	results, success := evaluate(program)
+	require.False(t, success)
+	require.Equal(t, []Status{StatusError, StatusError, StatusError, StatusError, StatusError}, []Status{results[0].Status, results[1].Status, results[2].Status, results[3].Status, results[4].Status})
+	require.Contains(t, results[4].Err.Error(), "unknown variable: sizes")
+
+	require.EqualError(t, program.SetUnits(map[string]string{"latency": "parsec"}), `variable latency: unknown unit "parsec" (known units: B, GB, GiB, KB, KiB, MB, MiB, TB, TiB, d, h, min, ms, ns, s, us)`)
+
+	p = NewParser(lexer.NewLexer("assert 5parsec"))
+	p.ParseProgram()
+	require.Len(t, p.Errors(), 1)
+	require.Contains(t, p.Errors()[0], `unknown unit "parsec"`)
+}
+
+func TestTimesAndDurations(t *testing.T) {
+	fixedClock := func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	values := map[string]any{
+		"expires_at": time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC),
+		"started_at": time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC),
+		"timeout":    90 * time.Second,
+		"cert":       map[string]any{"expires": "2024-06-20T00:00:00Z"},
+	}
+
+	testCases := []ValuesTestCase{
+		{
+			input:                  "assert expires_at - now() > 30d\n assert time(cert.expires) - now() > 30d",
+			values:                 values,
+			expectedResults:        []float64{0, 1},
+			expectedPartialResults: []string{"assert ((expires_at - now()) > 30d)", "assert ((time(cert.expires) - now()) > 30d)"},
+			succeed:                false,
+			clock:                  fixedClock,
+		},
+		{
+			input:                  "assert started_at + timeout < now()\n assert now() - 2h <= started_at",
+			values:                 values,
+			expectedResults:        []float64{0, 0},
+			expectedPartialResults: []string{"assert ((started_at + timeout) < now())", "assert ((now() - 2h) <= started_at)"},
+			succeed:                true,
+			clock:                  fixedClock,
+		},
+		{
+			input:                  "assert 2024-01-02 - 2024-01-01 == 1d\n assert 2024-01-01T00:00:00Z + 12h < 2024-01-01T13:00:00+01:00\n assert 2024-01-01T10:30Z + 90min",
+			values:                 values,
+			expectedResults:        []float64{0, 1, -1},
+			expectedPartialResults: []string{"assert 0", "assert 1", "assert 2024-01-01T12:00:00Z"},
+			succeed:                false,
+			clock:                  fixedClock,
+		},
+	}
+
+	runValuesTestCases(t, testCases)
+}
+
+func TestTimeTypeRules(t *testing.T) {
+	l := lexer.NewLexer("assert now() + now() > 1d\n assert now() > 1d\n assert now() * 2 > now()\n assert 2024-01-01 - 1 > 0")
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	errs := program.CheckUnits()
+	require.Len(t, errs, 4)
+	require.Contains(t, errs[0].Error(), "+ cannot combine instant and instant")
+	require.Contains(t, errs[1].Error(), "> cannot combine instant and time")
+	require.Contains(t, errs[2].Error(), "* cannot combine instant and a plain number")
+	require.Contains(t, errs[3].Error(), "- cannot combine instant and a plain number")
+
+	_, err := evaluateTimeInfix("+", TimeValue{Time: time.Now()}, TimeValue{Time: time.Now()})
+	require.EqualError(t, err, "+: cannot combine two times")
+	_, err = evaluateTimeInfix("-", NumberValue(1), TimeValue{Time: time.Now()})
+	require.EqualError(t, err, "-: cannot combine number and time")
+}
+
+func TestDeclarations(t *testing.T) {
+	input := `var cpu: float in [0, 100]
+var mode: string in {"a", "b"}
+var replicas: int
+assert cpu < 90
+assert mode == "a"
+assert replicas >= 2`
+
+	testCases := []struct {
+		values          map[string]any
+		expectedErrors  []string
+		expectedResults []float64
+	}{
+		{
+			values:          map[string]any{"cpu": 50, "mode": "a", "replicas": 3},
+			expectedErrors:  nil,
+			expectedResults: []float64{0, 0, 0},
+		},
+		{
+			values: map[string]any{"cpu": 150, "mode": "c", "replicas": 2.5},
+			expectedErrors: []string{
+				"variable cpu: 150 is not in [0, 100]",
+				`variable mode: "c" is not one of {"a", "b"}`,
+				"variable replicas: expected an integer, got 2.5",
+			},
+			expectedResults: []float64{-1, -1, -1},
+		},
+		{
+			values: map[string]any{"cpu": "high", "mode": "b"},
+			expectedErrors: []string{
+				"variable cpu: expected float, got string",
+			},
+			expectedResults: []float64{-1, 1, -1},
+		},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(testCase.values))
+		require.Equal(t, testCase.expectedErrors, errorStrings(program.Check()))
+
+		results, success := evaluate(program)
+		require.Equal(t, testCase.expectedErrors == nil, success)
+		require.Equal(t, testCase.expectedResults, resultValues(results))
+	}
+}
+
+func TestDeclaredTypes(t *testing.T) {
+	input := `var enabled: boolean
+var latency: duration in [0ms, 1s]
+var hosts: list
+var limits: object
+assert enabled
+assert latency < 500ms
+assert len(hosts) > 1
+assert limits.cpu > 1
+assert if enabled then latency < 200ms else 0`
+
+	testCases := []struct {
+		values          map[string]any
+		expectedErrors  []string
+		expectedResults []float64
+	}{
+		{
+			values:          map[string]any{"enabled": true, "latency": 100 * time.Millisecond, "hosts": []any{"a", "b"}, "limits": map[string]any{"cpu": 2}},
+			expectedErrors:  nil,
+			expectedResults: []float64{0, 0, 0, 0, 0},
+		},
+		{
+			values: map[string]any{"enabled": 0, "latency": 2 * time.Second, "hosts": "a", "limits": []any{2}},
+			expectedErrors: []string{
+				"variable enabled: expected boolean, got number",
+				"variable hosts: expected list, got string",
+				"variable latency: 2s is not in [0ms, 1s]",
+				"variable limits: expected object, got list",
+			},
+			expectedResults: []float64{-1, -1, -1, -1, -1},
+		},
+		{
+			values: map[string]any{"enabled": false, "latency": 5, "hosts": []any{}, "limits": map[string]any{}},
+			expectedErrors: []string{
+				"variable latency: expected duration, got number",
+			},
+			expectedResults: []float64{1, -1, 1, -1, -1},
+		},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(testCase.values))
+		require.Equal(t, testCase.expectedErrors, errorStrings(program.Check()))
+
+		results, success := evaluate(program)
+		require.Equal(t, testCase.expectedErrors == nil, success)
+		require.Equal(t, testCase.expectedResults, resultValues(results))
+	}
+
+	l := lexer.NewLexer(`var enabled: boolean
+var hosts: list
+assert enabled + 1
+assert enabled < 1
+assert -enabled
+assert ! enabled
+assert hosts < 1`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+	require.NoError(t, program.SetValues(map[string]any{}))
+	require.Equal(t, []string{
+		"error checking statement 1: type mismatch in (enabled + 1): + cannot combine boolean and number",
+		"error checking statement 2: type mismatch in (enabled < 1): < cannot combine boolean and number",
+		"error checking statement 3: type mismatch in (-enabled): - expects a number, got boolean",
+		"error checking statement 5: type mismatch in (hosts < 1): < cannot combine list and number",
+	}, errorStrings(program.Check()))
+}
+
+func TestTypeErrors(t *testing.T) {
+	input := `var cpu: float
+var mode: string
+var started: time
+assert mode > 5
+assert cpu + mode > 1
+assert cpuu < 90
+assert -mode == 1
+assert cpu in 5
+assert mode in ["a", 1]
+assert started + started > now()
+assert forall m in modes: m == "a"
+assert now() - started > 1h`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+	require.NoError(t, program.SetValues(map[string]any{}))
+
+	require.Equal(t, []string{
+		"error checking statement 1: type mismatch in (mode > 5): > cannot combine string and number",
+		"error checking statement 2: type mismatch in (cpu + mode): + cannot combine number and string",
+		"error checking statement 3: undeclared variable cpuu",
+		"error checking statement 4: type mismatch in (-mode): - expects a number, got string",
+		"error checking statement 5: type mismatch in (cpu in 5): in expects a list or an object, got number",
+		`error checking statement 6: type mismatch in (mode in ["a", 1]): in cannot combine string and number`,
+		"error checking statement 7: type mismatch in (started + started): + cannot combine time and time",
+		"error checking statement 8: undeclared variable modes",
+	}, errorStrings(program.Check()))
+}
+
+func TestDeclarationErrors(t *testing.T) {
+	testCases := []struct {
+		input         string
+		expectedError string
+	}{
+		{"var x: bool", `unknown type "bool" for variable x (known types: boolean, duration, float, int, list, object, string, time)`},
+		{"var x: duration in [1GiB, 2GiB]", "domain of x: expected duration, got data (GiB)"},
+		{"var x: int in [10, 1]", "domain of x: 10 is greater than 1"},
+		{"var x: float in [0, y]", "domain of x must be constant, got y"},
+		{`var x: string in {"a", 1}`, "domain of x: expected string, got number"},
+		{"var x: int in [1, 2, 3]", "domain of x must be an interval [low, high]"},
+		{"var x: float in 5", "expected [low, high] or {a, b} after in, got 5 instead"},
+		{"var x: float\nvar x: float", "variable x is declared twice"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		p.ParseProgram()
+		require.Contains(t, p.Errors(), testCase.expectedError, testCase.input)
+	}
+}
+
+func TestAssumptions(t *testing.T) {
+	input := `assume x > 0
+assume 0 <= cpu <= 100
+assume y != 0
+assume mode == "fast"
+assert x / x == 1
+assert x >= 0
+assert x < 0
+assert cpu <= 100
+assert cpu > 50
+assert 0 < x < 10
+assert y / y + z
+assert z / z
+assert mode == "fast"`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	partialResults, errs, success := program.PartialEvaluate()
+	require.True(t, success)
+	require.Empty(t, errs)
+	require.Equal(t, []string{
+		"assume (x > 0)",
+		"assume (0 <= cpu <= 100)",
+		"assume (y != 0)",
+		`assume (mode == "fast")`,
+		"assert 0",
+		"assert 0",
+		"assert 1",
+		"assert 0",
+		"assert (cpu > 50)",
+		"assert (x < 10)",
+		"assert (1 + z)",
+		"assert (z / z)",
+		"assert 0",
+	}, partialResults)
+
+	require.NoError(t, program.SetValues(map[string]any{"x": -1, "cpu": 150, "y": 2, "z": 1, "mode": "fast"}))
+	report := program.Evaluate()
+	require.False(t, report.Success())
+	require.Len(t, report.Results, 9)
+	require.Equal(t, []string{
+		"error evaluating assumption 1: assumption broken: (x > 0)",
+		"error evaluating assumption 2: assumption broken: (0 <= cpu <= 100): link 2 (cpu <= 100) failed with 150 <= 100",
+	}, errorStrings(report.BrokenAssumptions))
+
+	require.NoError(t, program.SetValues(map[string]any{"x": 2, "cpu": 60, "y": 2}))
+	require.Empty(t, program.Evaluate().BrokenAssumptions)
+
+	// The residual keeps the assumptions its asserts were simplified under,
+	// so evaluating it still reports the ones the values break.
+	residual := NewParser(lexer.NewLexer(strings.Join(partialResults, "\n"))).ParseProgram()
+	require.NoError(t, residual.SetValues(map[string]any{"x": -1, "cpu": 50, "y": 2, "z": 1, "mode": "fast"}))
+	require.Equal(t, []string{
+		"error evaluating assumption 1: assumption broken: (x > 0)",
+	}, errorStrings(residual.Evaluate().BrokenAssumptions))
+
+	// Without the assumptions nothing is folded.
+	l = lexer.NewLexer("assert x / x == 1\n assert x >= 0")
+	p = NewParser(l)
+	partialResults, _, _ = p.ParseProgram().PartialEvaluate()
+	require.Equal(t, []string{"assert ((x / x) == 1)", "assert (x >= 0)"}, partialResults)
+}
+
+func TestWhenBlocks(t *testing.T) {
+	input := `when env == "prod" {
+    assert replicas >= 3
+    when region == "eu" {
+        assert gdpr == 1
+    }
+}
+assert replicas >= 1`
+
+	testCases := []struct {
+		values           map[string]any
+		policy           MissingPolicy
+		expectedStatuses []Status
+		succeed          bool
+	}{
+		{
+			values:           map[string]any{"env": "prod", "region": "us", "replicas": 3},
+			expectedStatuses: []Status{StatusPass, StatusSkip, StatusPass},
+			succeed:          true,
+		},
+		{
+			values:           map[string]any{"env": "prod", "region": "eu", "replicas": 2, "gdpr": 1},
+			expectedStatuses: []Status{StatusFail, StatusPass, StatusPass},
+			succeed:          false,
+		},
+		{
+			values:           map[string]any{"env": "dev", "replicas": 1},
+			expectedStatuses: []Status{StatusSkip, StatusSkip, StatusPass},
+			succeed:          true,
+		},
+		{
+			values:           map[string]any{"replicas": 1},
+			expectedStatuses: []Status{StatusError, StatusError, StatusPass},
+			succeed:          false,
+		},
+		{
+			values:           map[string]any{"replicas": 1},
+			policy:           MissingSkip,
+			expectedStatuses: []Status{StatusSkip, StatusSkip, StatusPass},
+			succeed:          true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(testCase.values))
+		program.SetMissingPolicy(testCase.policy)
+
+		results, success := evaluate(program)
+		require.Equal(t, testCase.succeed, success)
+
+		var statuses []Status
+		for _, result := range results {
+			statuses = append(statuses, result.Status)
+		}
+		require.Equal(t, testCase.expectedStatuses, statuses)
+	}
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.NoError(t, program.SetValues(map[string]any{"env": "dev", "replicas": 1}))
+	results := program.Evaluate().Results
+	require.Equal(t, `skipped statement 1: guard (env == "prod") does not hold`, results[0].Reason)
+	require.Equal(t, `skipped statement 2: guard (env == "prod") does not hold`, results[1].Reason)
+	require.Empty(t, resultErrors(results))
+}
+
+func TestWhenBlockPartialEvaluation(t *testing.T) {
+	testCases := []struct {
+		input                  string
+		expectedPartialResults []string
+	}{
+		{
+			input:                  `when "prod" == "prod" { assert x > 1 } assert y`,
+			expectedPartialResults: []string{"assert (x > 1)", "assert y"},
+		},
+		{
+			input:                  "when 1 == 2 {\n assert x > 1\n}\nassert y",
+			expectedPartialResults: []string{"assert y"},
+		},
+		{
+			input:                  `when env == "prod" { assert replicas >= 1 + 2 when 2 > 1 { assert gdpr } }`,
+			expectedPartialResults: []string{"when (env == \"prod\") {\n    assert (replicas >= 3)\n    assert gdpr\n}"},
+		},
+		{
+			input:                  `@prod when 1 == 1 { @db assert x > 1 when env == "eu" { assert y } } assert z`,
+			expectedPartialResults: []string{"@prod @db assert (x > 1)", "@prod when (env == \"eu\") {\n    assert y\n}", "assert z"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		partialResults, errs, success := program.PartialEvaluate()
+		require.True(t, success)
+		require.Empty(t, errs)
+		require.Equal(t, testCase.expectedPartialResults, partialResults)
+	}
+}
+
+func TestWhenBlockErrors(t *testing.T) {
+	testCases := []struct {
+		input         string
+		expectedError string
+	}{
+		{"when x { pragma tolerance 1 }", "pragma is not allowed in a when block"},
+		{"when x {\n assert y", "when block on line 1 is not closed"},
+		{"when x assert y", "expected next token to be"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		p.ParseProgram()
+		require.NotEmpty(t, p.Errors(), testCase.input)
+		require.Contains(t, p.Errors()[0], testCase.expectedError)
+	}
+}
+
+func TestSelection(t *testing.T) {
+	input := `@smoke assert "db-pool-size": pool >= 10
+suite "cache" {
+    @slow assert "cache-hit-rate": hit_rate > 0.9
+    assert evictions < 100
+}
+@prod suite "api" {
+    when region == "eu" {
+        @smoke assert latency < 200
+    }
+    assert "api-errors": errors == 0
+}`
+	values := map[string]any{"pool": 12, "hit_rate": 0.95, "evictions": 10, "region": "eu", "latency": 100, "errors": 1}
+
+	testCases := []struct {
+		selection      Selection
+		expectedNames  []string
+		expectedSuites []string
+	}{
+		{
+			selection:      Selection{},
+			expectedNames:  []string{"db-pool-size", "cache-hit-rate", "", "", "api-errors"},
+			expectedSuites: []string{"", "cache", "cache", "api", "api"},
+		},
+		{
+			selection:      Selection{Names: []string{"db-pool-size", "api-errors"}},
+			expectedNames:  []string{"db-pool-size", "api-errors"},
+			expectedSuites: []string{"", "api"},
+		},
+		{
+			selection:      Selection{Suites: []string{"cache"}},
+			expectedNames:  []string{"cache-hit-rate", ""},
+			expectedSuites: []string{"cache", "cache"},
+		},
+		{
+			selection:      Selection{Tags: "smoke"},
+			expectedNames:  []string{"db-pool-size", ""},
+			expectedSuites: []string{"", "api"},
+		},
+		{
+			selection:      Selection{Tags: "prod and not smoke"},
+			expectedNames:  []string{"api-errors"},
+			expectedSuites: []string{"api"},
+		},
+		{
+			selection:      Selection{Suites: []string{"api"}, Tags: "(slow or smoke) and !prod or @smoke"},
+			expectedNames:  []string{""},
+			expectedSuites: []string{"api"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(values))
+		require.NoError(t, program.Select(testCase.selection))
+
+		results := program.Evaluate().Results
+		var names, suites []string
+		for _, result := range results {
+			names = append(names, result.Name)
+			suites = append(suites, result.Suite)
+		}
+		require.Equal(t, testCase.expectedNames, names)
+		require.Equal(t, testCase.expectedSuites, suites)
+
+	}
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.NoError(t, program.SetValues(values))
+	results := program.Evaluate().Results
+	require.EqualError(t, results[4].Err, `error evaluating assert "api-errors": assertion failed: (errors == 0)`)
+
+	require.NoError(t, program.Select(Selection{Suites: []string{"cache"}}))
+	partialResults, _, success := program.PartialEvaluate()
+	require.True(t, success)
+	require.Equal(t, []string{"suite \"cache\" {\n    @slow assert \"cache-hit-rate\": (hit_rate > 0.9)\n    assert (evictions < 100)\n}"}, partialResults)
+
+	require.NoError(t, program.Select(Selection{Tags: "smoke"}))
+	partialResults, _, success = program.PartialEvaluate()
+	require.True(t, success)
+	require.Equal(t, []string{
+		"@smoke assert \"db-pool-size\": (pool >= 10)",
+		"@prod suite \"api\" {\n    when (region == \"eu\") {\n        @smoke assert (latency < 200)\n    }\n}",
+	}, partialResults)
+
+	require.EqualError(t, program.Select(Selection{Names: []string{"nope"}}), `unknown assert "nope"`)
+	require.EqualError(t, program.Select(Selection{Suites: []string{"db"}}), `unknown suite "db"`)
+	require.EqualError(t, program.Select(Selection{Tags: "smoke and"}), `tag expression "smoke and": expected a tag, got the end of the expression`)
+	require.EqualError(t, program.Select(Selection{Tags: "(smoke"}), `tag expression "(smoke": expected ), got ""`)
+	require.EqualError(t, program.Select(Selection{Tags: "smoke slow"}), `tag expression "smoke slow": unexpected slow`)
+}
+
+func TestSelectionParseErrors(t *testing.T) {
+	testCases := []struct {
+		input         string
+		expectedError string
+	}{
+		{`assert "a": x > 1 assert "a": y > 1`, `assert name "a" is used twice`},
+		{"@smoke pragma tolerance 1", "tags can only annotate asserts, when blocks and suites, not pragma"},
+		{`suite "a" { suite "b" { assert x } }`, "suite is not allowed in a suite block"},
+		{`suite "a" { assert x`, "suite block on line 1 is not closed"},
+		{"suite a { assert x }", "expected next token to be"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		p.ParseProgram()
+		require.NotEmpty(t, p.Errors(), testCase.input)
+		require.Contains(t, p.Errors()[0], testCase.expectedError)
+	}
+}
+
+func TestSeverities(t *testing.T) {
+	input := `warn disk < 80
+require "db-up": db == 1
+assert pool >= 10
+when env == "prod" {
+    assert replicas >= 3
+}`
+
+	testCases := []struct {
+		values             map[string]any
+		expectedStatuses   []Status
+		expectedSeverities []Severity
+		succeed            bool
+	}{
+		{
+			values:             map[string]any{"disk": 90, "db": 1, "pool": 10, "env": "prod", "replicas": 3},
+			expectedStatuses:   []Status{StatusFail, StatusPass, StatusPass, StatusPass},
+			expectedSeverities: []Severity{SeverityWarn, SeverityRequire, SeverityAssert, SeverityAssert},
+			succeed:            true,
+		},
+		{
+			values:             map[string]any{"disk": 50, "db": 1, "pool": 5, "env": "prod", "replicas": 3},
+			expectedStatuses:   []Status{StatusPass, StatusPass, StatusFail, StatusPass},
+			expectedSeverities: []Severity{SeverityWarn, SeverityRequire, SeverityAssert, SeverityAssert},
+			succeed:            false,
+		},
+		{
+			values:             map[string]any{"disk": 50, "db": 0, "pool": 5, "env": "prod", "replicas": 3},
+			expectedStatuses:   []Status{StatusPass, StatusFail, StatusSkip, StatusSkip},
+			expectedSeverities: []Severity{SeverityWarn, SeverityRequire, SeverityAssert, SeverityAssert},
+			succeed:            false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(testCase.values))
+		results, success := evaluate(program)
+		require.Equal(t, testCase.succeed, success)
+
+		var statuses []Status
+		var severities []Severity
+		for _, result := range results {
+			statuses = append(statuses, result.Status)
+			severities = append(severities, result.Severity)
+		}
+		require.Equal(t, testCase.expectedStatuses, statuses)
+		require.Equal(t, testCase.expectedSeverities, severities)
+	}
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.NoError(t, program.SetValues(map[string]any{"disk": 90, "db": 0}))
+	results := program.Evaluate().Results
+	require.EqualError(t, results[0].Err, "error evaluating statement 1: assertion failed: (disk < 80)")
+	require.EqualError(t, results[1].Err, `error evaluating require "db-up": assertion failed: (db == 1)`)
+	require.Equal(t, `skipped statement 3: evaluation stopped after require "db-up" failed`, results[2].Reason)
+	require.Equal(t, `skipped statement 4: evaluation stopped after require "db-up" failed`, results[3].Reason)
+
+	partialResults, _, _ := program.PartialEvaluate()
+	require.Equal(t, []string{
+		"warn (disk < 80)",
+		`require "db-up": (db == 1)`,
+		"assert (pool >= 10)",
+		"when (env == \"prod\") {\n    assert (replicas >= 3)\n}",
+	}, partialResults)
+}
+
+func TestDependencies(t *testing.T) {
+	input := `assert "pool" after "db-up": pool_used < pool_max
+assert "db-up": db == 1
+assert "latency" after "pool", "net": latency < 100
+assert "net": net == 1
+assert other > 0`
+
+	testCases := []struct {
+		values           map[string]any
+		expectedStatuses []Status
+		expectedErrors   []string
+	}{
+		{
+			values:           map[string]any{"db": 1, "pool_used": 5, "pool_max": 10, "latency": 50, "net": 1, "other": 1},
+			expectedStatuses: []Status{StatusPass, StatusPass, StatusPass, StatusPass, StatusPass},
+		},
+		{
+			values:           map[string]any{"db": 0, "latency": 50, "net": 1, "other": 1},
+			expectedStatuses: []Status{StatusSkip, StatusFail, StatusSkip, StatusPass, StatusPass},
+			expectedErrors: []string{
+				`skipped assert "pool": prerequisite "db-up" failed`,
+				`error evaluating assert "db-up": assertion failed: (db == 1)`,
+				`skipped assert "latency": prerequisite "pool" was skipped`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors())
+
+		require.NoError(t, program.SetValues(testCase.values))
+		results := program.Evaluate().Results
+
+		var statuses []Status
+		for _, result := range results {
+			statuses = append(statuses, result.Status)
+		}
+		require.Equal(t, testCase.expectedStatuses, statuses)
+		require.Equal(t, testCase.expectedErrors, resultMessages(results))
+	}
+
+	// The prerequisite is evaluated first, so its failure stops the assert
+	// that comes before it in the source.
+	l := lexer.NewLexer(`assert "pool" after "db-up": pool > 0
+require "db-up": db == 1`)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.NoError(t, program.SetValues(map[string]any{"db": 0, "pool": 1}))
+	results := program.Evaluate().Results
+	require.Equal(t, `skipped assert "pool": evaluation stopped after require "db-up" failed`, results[0].Reason)
+
+	partialResults, _, _ := program.PartialEvaluate()
+	require.Equal(t, `assert "pool" after "db-up": (pool > 0)`, partialResults[0])
+
+	// A prerequisite that is not evaluated does not count as passed.
+	require.NoError(t, program.Select(Selection{Names: []string{"pool"}}))
+	results = program.Evaluate().Results
+	require.Len(t, results, 1)
+	require.Equal(t, StatusSkip, results[0].Status)
+	require.Equal(t, `skipped assert "pool": prerequisite "db-up" was not evaluated`, results[0].Reason)
+}
+
+func TestDependencyErrors(t *testing.T) {
+	testCases := []struct {
+		input         string
+		expectedError string
+	}{
+		{`assert after "db": x > 1`, `statement 1 depends on unknown assert "db"`},
+		{`assert "a" after "b": x assert "b" after "c": y assert "c" after "a": z`, "dependency cycle: a -> b -> c -> a"},
+		{`assert "a" after "a": x`, "dependency cycle: a -> a"},
+		{`assert "a" after "b" x`, "expected next token to be"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		p.ParseProgram()
+		require.NotEmpty(t, p.Errors(), testCase.input)
+		require.Contains(t, p.Errors()[0], testCase.expectedError)
+	}
+
+	// A cycle is reported once, also when other asserts depend on it.
+	p := NewParser(lexer.NewLexer(`assert "a" after "b": x assert "b" after "a": y assert "c" after "a": z`))
+	p.ParseProgram()
+	require.Equal(t, []string{"dependency cycle: a -> b -> a"}, p.Errors())
+}
+
+func TestWhereTables(t *testing.T) {
+	input := `assert "sum": a + b == c where
+    | a | b  | c |
+    | 1 | 2  | 3 |
+    | 4 | 5  | 8 |
+    | 2 | -2 | 0 |
+assert limit > 0`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.NoError(t, program.SetValues(map[string]any{"limit": 1}))
+	results, success := evaluate(program)
+	require.False(t, success)
+	require.Len(t, results, 4)
+
+	var statuses []Status
+	var cases []string
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+		cases = append(cases, result.Case)
+	}
+	require.Equal(t, []Status{StatusPass, StatusFail, StatusPass, StatusPass}, statuses)
+	require.Equal(t, []string{"row 1: a = 1, b = 2, c = 3", "row 2: a = 4, b = 5, c = 8", "row 3: a = 2, b = (-2), c = 0", ""}, cases)
+	require.Equal(t, []string{`error evaluating assert "sum" (row 2: a = 4, b = 5, c = 8): assertion failed: ((a + b) == c)`}, errorStrings(resultErrors(results)))
+
+	// The columns of the table do not leak into the value map.
+	_, ok := program.(*Program).values["a"]
+	require.False(t, ok)
+
+	partialResults, _, _ := program.PartialEvaluate()
+	require.Equal(t, `assert "sum": ((a + b) == c) where
+    | a | b | c |
+    | 1 | 2 | 3 |
+    | 4 | 5 | 8 |
+    | 2 | (-2) | 0 |`, partialResults[0])
+}
+
+func TestScenarios(t *testing.T) {
+	input := `scenario "calm" { x = 3; y = -6 }
+scenario "peak" {
+    x = 30
+    y = 1
+}
+assume y < 0
+assert x < 10
+assert x + y < 0`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.NoError(t, program.SetValues(map[string]any{"x": 1, "y": -5}))
+	report := program.EvaluateScenarios()
+	results, success := report.Results, report.Success()
+	require.False(t, success)
+
+	var cases []string
+	var statuses []Status
+	for _, result := range results {
+		cases = append(cases, result.Case)
+		statuses = append(statuses, result.Status)
+	}
+	require.Equal(t, []string{`scenario "calm"`, `scenario "calm"`, `scenario "peak"`, `scenario "peak"`}, cases)
+	require.Equal(t, []Status{StatusPass, StatusPass, StatusFail, StatusFail}, statuses)
+	require.EqualError(t, results[2].Err, `error evaluating statement 1 (scenario "peak"): assertion failed: (x < 10)`)
+	require.Equal(t, []string{`error evaluating assumption 1 (scenario "peak"): assumption broken: (y < 0)`}, errorStrings(report.BrokenAssumptions))
+
+	// The value map is restored after the scenarios.
+	results, success = evaluate(program)
+	require.True(t, success)
+	require.Equal(t, "", results[0].Case)
+}
+
+func TestScenarioErrors(t *testing.T) {
+	testCases := []struct {
+		input         string
+		expectedError string
+	}{
+		{`scenario "a" { x = 1 } scenario "a" { x = 2 }`, `scenario "a" is defined twice`},
+		{`scenario "a" { x = 1; x = 2 }`, `scenario "a" sets x twice`},
+		{`scenario "a" { x = y }`, `scenario "a": x must be set to a constant, got y`},
+		{`scenario "a" { x = 1`, `scenario block on line 1 is not closed`},
+		{`scenario "a" { 1 = x }`, `expected an assignment in scenario "a", got 1 instead`},
+		{"assert a == b where\n| a | b |\n| 1 |", "row 1 of the where table on line 1 has 1 cells, expected 2"},
+		{"assert a == b where\n| a | b |\n| 1 | x |", "row 1 of the where table on line 1: x is not a constant"},
+		{"assert a == b where\n| a | 2 |\n| 1 | 2 |", "where table on line 1: column 2 must be a name"},
+		{"assert a == b where\n| a | a |\n| 1 | 2 |", "where table on line 1 has the column a twice"},
+		{"assert a == b where\n| a | b |", "where table on line 1 has no rows"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.NewLexer(testCase.input)
+		p := NewParser(l)
+		p.ParseProgram()
+		require.NotEmpty(t, p.Errors(), testCase.input)
+		require.Contains(t, p.Errors()[0], testCase.expectedError)
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	input := `let limit = 10
+def double(v) = v * 2
+assert double(x) < limit
+assert forall limit in xs: limit > 0`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.NoError(t, program.SetValues(map[string]any{"x": 4, "xs": []any{1, 2}}))
+	results, success := evaluate(program)
+	require.True(t, success)
+	require.Len(t, results, 2)
+
+	require.NoError(t, program.SetValues(map[string]any{"x": 6, "xs": []any{1, 2}}))
+	results = program.Evaluate().Results
+	require.EqualError(t, results[0].Err, "error evaluating statement 1: assertion failed: (double(x) < 10)")
+
+	// The parameter of a def does not leak into the value map.
+	_, ok := program.(*Program).values["v"]
+	require.False(t, ok)
+
+	require.NoError(t, program.SetValues(map[string]any{}))
+	partialResults, _, _ := program.PartialEvaluate()
+	require.Equal(t, "assert ((x * 2) < 10)", partialResults[0])
+}
+
+func TestDefinitionScopes(t *testing.T) {
+	// The body of a def reads limit from the value map, not the variable of
+	// the quantifier around the call.
+	input := `def over(v) = v > limit
+assert forall limit in xs: over(limit)`
+
+	p := NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.NoError(t, program.SetValues(map[string]any{"limit": 0, "xs": []any{1, 2}}))
+	_, success := evaluate(program)
+	require.True(t, success)
+
+	require.NoError(t, program.SetValues(map[string]any{"limit": 5, "xs": []any{1, 2}}))
+	_, success = evaluate(program)
+	require.False(t, success)
+
+	// Inlining the def renames the variable of the quantifier, so that the
+	// residual still reads limit from the value map.
+	partialResults, errs, success := program.PartialEvaluate()
+	require.True(t, success)
+	require.Empty(t, errs)
+	require.Equal(t, []string{"assert (forall limit_1 in xs: (limit_1 > limit))"}, partialResults)
+	residual := NewParser(lexer.NewLexer(partialResults[0])).ParseProgram()
+	require.NoError(t, residual.SetValues(map[string]any{"limit": 5, "xs": []any{1, 2}}))
+	_, success = evaluate(residual)
+	require.False(t, success)
+	require.NoError(t, residual.SetValues(map[string]any{"limit": 0, "xs": []any{1, 2}}))
+	_, success = evaluate(residual)
+	require.True(t, success)
+	require.Equal(t, []string{"limit", "xs"}, program.FreeVariables())
+
+	// Every use of a let is a tree of its own.
+	p = NewParser(lexer.NewLexer("let bound = x + 1\nassert a < bound\nassert b < bound"))
+	program = p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	statements := program.AST().Statements
+	_, err := Rewrite(statements[0], func(node Node) Node {
+		if variable, ok := node.(*Variable); ok && variable.Value == "x" {
+			return &Variable{Token: variable.Token, Value: "y"}
+		}
+		return node
+	})
+	require.NoError(t, err)
+	require.Equal(t, "assert (a < (y + 1))", statements[0].String())
+	require.Equal(t, "assert (b < (x + 1))", statements[1].String())
+}
+
+// TestDefinitionResiduals re-parses the residuals of def calls and checks that
+// they evaluate like the program without its defs.
+func TestDefinitionResiduals(t *testing.T) {
+	testCases := []struct {
+		input    string
+		residual []string
+		values   map[string]any
+	}{
+		{
+			input:    "def within(x, lo, hi) = lo <= x <= hi\n assert within(v, 0, 10)",
+			residual: []string{"assert (0 <= v <= 10)"},
+			values:   map[string]any{"v": 12},
+		},
+		{
+			input:    "def double(v) = v * 2\n def quad(v) = double(double(v))\n assert quad(x + 1) == y",
+			residual: []string{"assert ((((x + 1) * 2) * 2) == y)"},
+			values:   map[string]any{"x": 1, "y": 8},
+		},
+		{
+			input:    "def positive(x) = forall x in x: x > 0\n assert positive(xs)",
+			residual: []string{"assert (forall x in xs: (x > 0))"},
+			values:   map[string]any{"xs": []any{1, -2}},
+		},
+		{
+			input:    "def over(v) = v > limit\n assert over(3)\n assert over(size)",
+			residual: []string{"assert (3 > limit)", "assert (size > limit)"},
+			values:   map[string]any{"limit": 2, "size": 1},
+		},
+	}
+
+	for _, testCase := range testCases {
+		p := NewParser(lexer.NewLexer(testCase.input))
+		program := p.ParseProgram()
+		require.Empty(t, p.Errors(), testCase.input)
+
+		residuals, errs, success := program.PartialEvaluate()
+		require.True(t, success, errs)
+		require.Equal(t, testCase.residual, residuals)
+
+		p = NewParser(lexer.NewLexer(strings.Join(residuals, "\n")))
+		reparsed := p.ParseProgram()
+		require.Empty(t, p.Errors(), residuals)
+
+		require.NoError(t, program.SetValues(testCase.values))
+		require.NoError(t, reparsed.SetValues(testCase.values))
+		expected, _ := evaluate(program)
+		actual, _ := evaluate(reparsed)
+		require.Equal(t, resultValues(expected), resultValues(actual), testCase.input)
+		require.Equal(t, len(resultErrors(expected)), len(resultErrors(actual)), testCase.input)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"rules/main.assert":          {Data: []byte("include \"common/base.assert\"\nimport \"common/limits.assert\" as limits\nassert x < limits.max\nassert limits.within(y, 0, limits.max)")},
+		"rules/common/base.assert":   {Data: []byte("assert x > 0")},
+		"rules/common/limits.assert": {Data: []byte("include \"values.assert\"\ndef within(v, lo, hi) = lo <= v <= hi")},
+		"rules/common/values.assert": {Data: []byte("let max = 100")},
+	}
+
+	p, err := NewFileParser(fsys, "rules/main.assert")
+	require.NoError(t, err)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.NoError(t, program.SetValues(map[string]any{"x": 5, "y": 50}))
+	results, success := evaluate(program)
+	require.True(t, success)
+	require.Len(t, results, 3)
+
+	require.NoError(t, program.SetValues(map[string]any{"x": 5, "y": 500}))
+	results = program.Evaluate().Results
+	require.EqualError(t, results[2].Err, "error evaluating statement 3: assertion failed: limits.within(y, 0, 100)")
+
+	require.NoError(t, program.SetValues(map[string]any{}))
+	partialResults, _, _ := program.PartialEvaluate()
+	require.Equal(t, []string{"assert (x > 0)", "assert (x < 100)", "assert (0 <= y <= 100)"}, partialResults)
+
+	// The residual reads without the imported files.
+	p = NewParser(lexer.NewLexer(strings.Join(partialResults, "\n")))
+	reparsed := p.ParseProgram()
+	require.Empty(t, p.Errors())
+	require.NoError(t, reparsed.SetValues(map[string]any{"x": 5, "y": 500}))
+	results = reparsed.Evaluate().Results
+	require.EqualError(t, results[2].Err, "error evaluating statement 3: assertion failed: (0 <= y <= 100): link 2 (y <= 100) failed with 500 <= 100")
+}
+
+func TestIncludedTolerance(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.assert":   {Data: []byte("include \"loose.assert\"\nassert x ~= 1")},
+		"loose.assert":  {Data: []byte("include \"nested.assert\"\nassert x ~= 1\nwhen y ~= 1 {\n  assert y > 0\n}\npragma tolerance 0.5")},
+		"nested.assert": {Data: []byte("assume x ~= 1")},
+	}
+
+	p, err := NewFileParser(fsys, "main.assert")
+	require.NoError(t, err)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	// The pragma of loose.assert holds for its own statements only, not for
+	// the file it includes or the file that includes it.
+	require.NoError(t, program.SetValues(map[string]any{"x": 1.3, "y": 1.2}))
+	report := program.Evaluate()
+	require.Equal(t, []Status{StatusPass, StatusPass, StatusFail}, []Status{report.Results[0].Status, report.Results[1].Status, report.Results[2].Status})
+	require.Len(t, report.BrokenAssumptions, 1)
+
+	require.NoError(t, program.SetValues(map[string]any{}))
+	partialResults, _, _ := program.PartialEvaluate()
+	require.Equal(t, []string{
+		"assume (x ~= 1)",
+		"assert approx(x, 1, 0.5, 0)",
+		"when approx(y, 1, 0.5, 0) {\n    assert (y > 0)\n}",
+		"assert (x ~= 1)",
+	}, partialResults)
+
+	// The asserts keep the tolerance of their file in the JSON form.
+	fsys["main.assert"] = &fstest.MapFile{Data: []byte("include \"only.assert\"\nassert x ~= 1")}
+	fsys["only.assert"] = &fstest.MapFile{Data: []byte("assert x ~= 1\npragma tolerance 0.5")}
+	p, err = NewFileParser(fsys, "main.assert")
+	require.NoError(t, err)
+	program = p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	data, err := json.Marshal(program)
+	require.NoError(t, err)
+	var decoded Program
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.NoError(t, decoded.SetValues(map[string]any{"x": 1.3}))
+	report = decoded.Evaluate()
+	require.Equal(t, []Status{StatusPass, StatusFail}, []Status{report.Results[0].Status, report.Results[1].Status})
+}
+
+func TestIncludeErrors(t *testing.T) {
+	testCases := []struct {
+		files         map[string]string
+		expectedError string
+	}{
+		{
+			files:         map[string]string{"a.assert": `include "b.assert"`, "b.assert": `include "a.assert"`},
+			expectedError: "b.assert:1:1: include cycle: a.assert -> b.assert -> a.assert",
+		},
+		{
+			files:         map[string]string{"a.assert": "assert x > 0\n  include \"nope.assert\""},
+			expectedError: `a.assert:2:3: cannot include "nope.assert": open nope.assert: file does not exist`,
+		},
+		{
+			files:         map[string]string{"a.assert": `include "lib/b.assert"`, "lib/b.assert": "assert x > 0\nassert (x > 1"},
+			expectedError: "lib/b.assert:2:14: expected next token to be",
+		},
+		{
+			files:         map[string]string{"a.assert": `import "b.assert" as b`, "b.assert": "let max = 1\nassert x > 0"},
+			expectedError: "b.assert:2:1: imported files can only hold let, def, include and import, not assert",
+		},
+		{
+			files:         map[string]string{"a.assert": "import \"b.assert\" as b\nassert x < b.min", "b.assert": "let max = 1"},
+			expectedError: "a.assert:2:13: b has no let or def named min",
+		},
+		{
+			files:         map[string]string{"a.assert": "import \"b.assert\" as b\nassert b.in_range", "b.assert": "def in_range(x) = x > 0"},
+			expectedError: "a.assert:2:8: b.in_range is a def and must be called with 1 arguments",
+		},
+		{
+			files:         map[string]string{"a.assert": "import \"b.assert\" as b\nassert b.in_range(1, 2)", "b.assert": "def in_range(x) = x > 0"},
+			expectedError: "a.assert:2:18: b.in_range expects 1 arguments, got 2",
+		},
+		{
+			files:         map[string]string{"a.assert": "let max = 1\ninclude \"b.assert\"", "b.assert": "let max = 2"},
+			expectedError: "b.assert:1:1: max is defined twice",
+		},
+		{
+			files:         map[string]string{"a.assert": `import "b.assert" limits`, "b.assert": ""},
+			expectedError: `a.assert:1:19: expected as after import "b.assert"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		fsys := fstest.MapFS{}
+		for name, source := range testCase.files {
+			fsys[name] = &fstest.MapFile{Data: []byte(source)}
+		}
+
+		p, err := NewFileParser(fsys, "a.assert")
+		require.NoError(t, err)
+		p.ParseProgram()
+		require.NotEmpty(t, p.Errors(), testCase.files)
+		require.Contains(t, p.Errors()[0], testCase.expectedError)
+	}
+
+	// Without a file system, include is an error.
+	l := lexer.NewLexer(`include "common.assert"`)
+	p := NewParser(l)
+	p.ParseProgram()
+	require.Equal(t, []string{`cannot include "common.assert" without a file system, use NewFileParser`}, p.Errors())
+
+	_, err := NewFileParser(fstest.MapFS{}, "missing.assert")
+	require.Error(t, err)
+}
+
+func TestReport(t *testing.T) {
+	input := `assert x > 0
+@smoke assert "ratio":
+    used / total < 0.9
+assert "latency" after "ratio": forall l in latencies: l < limit
+warn disk < 80
+assert mode + 1 > 0
+assert cpu < 90`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.NoError(t, program.SetValues(map[string]any{
+		"x": 1, "used": 95, "total": 100, "latencies": []any{1, 2}, "limit": 5, "disk": 90, "mode": "a",
+	}))
+	program.SetMissingPolicy(MissingUnknown)
+	report := program.Evaluate()
+	require.False(t, report.Success())
+	require.Equal(t, Summary{Total: 6, Passed: 1, Failed: 1, Errors: 1, Skipped: 1, Unknown: 1, Warnings: 1}, report.Summary)
+
+	results := report.Results
+	var numbers []int
+	var statuses []Status
+	for _, result := range results {
+		numbers = append(numbers, result.Number)
+		statuses = append(statuses, result.Status)
+		require.GreaterOrEqual(t, result.Duration, time.Duration(0))
+	}
+	require.Equal(t, []int{1, 2, 3, 4, 5, 6}, numbers)
+	require.Equal(t, []Status{StatusPass, StatusFail, StatusSkip, StatusFail, StatusError, StatusUnknown}, statuses)
+
+	require.Equal(t, "@smoke assert \"ratio\":\n    used / total < 0.9", results[1].Source)
+	require.Equal(t, Span{Start: Position{Line: 2, Column: 1}, End: Position{Line: 3, Column: 23}}, results[1].Span)
+	require.Equal(t, []string{"total", "used"}, results[1].Reads)
+	require.Equal(t, 1.0, results[1].Value)
+
+	require.Equal(t, "warn disk < 80", results[3].Source)
+	require.Equal(t, Span{Start: Position{Line: 5, Column: 1}, End: Position{Line: 5, Column: 15}}, results[3].Span)
+	require.Equal(t, "assert cpu < 90", results[5].Source)
+	require.Equal(t, []string{"cpu"}, results[5].Reads)
+	require.Len(t, report.Errors(), 4)
+	require.Nil(t, results[2].Err)
+	require.NotEmpty(t, results[2].Reason)
+
+	// Variables bound by a quantifier are not reads.
+	require.NoError(t, program.SetValues(map[string]any{"used": 1, "total": 100, "latencies": []any{1, 2}, "limit": 5}))
+	results = program.Evaluate().Results
+	require.Equal(t, []string{"latencies", "limit"}, results[2].Reads)
+}
+
+func TestOutput(t *testing.T) {
+	input := "assert x > 0\nassert y == 1"
+
+	// The library does not write to stdout.
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.NoError(t, program.SetValues(map[string]any{"x": 1}))
+	program.Evaluate()
+	program.PartialEvaluate()
+
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	written, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Empty(t, string(written))
+
+	var ast bytes.Buffer
+	l = lexer.NewLexer(input)
+	p = NewParser(l)
+	p.SetASTOutput(&ast)
+	program = p.ParseProgram()
+	require.Equal(t, `AST :-
+Program:
+    -> Statement:
+        AssertStatement:
+            InfixExpression:
+                Left:
+                    Variable: x
+                Operator: >
+                Right:
+                    NumberLiteral: 0.00
+    -> Statement:
+        AssertStatement:
+            InfixExpression:
+                Left:
+                    Variable: y
+                Operator: ==
+                Right:
+                    NumberLiteral: 1.00
+`, ast.String())
+
+	var traces bytes.Buffer
+	program.SetLogger(slog.New(slog.NewTextHandler(&traces, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	require.NoError(t, program.SetValues(map[string]any{"x": 1}))
+	program.Evaluate()
+	program.PartialEvaluate()
+
+	lines := strings.Split(strings.TrimSpace(traces.String()), "\n")
+	require.Len(t, lines, 4)
+	require.Contains(t, lines[0], `level=DEBUG msg="evaluated assert" number=1 source="assert x > 0" status=pass value=0`)
+	require.Contains(t, lines[0], "reads=[x]")
+	require.Contains(t, lines[1], `number=2 source="assert y == 1" status=error value=-1`)
+	require.Contains(t, lines[1], `error="error evaluating statement 2: unknown variable: y"`)
+	require.Contains(t, lines[2], `msg="partially evaluated statement" number=1 result="assert (x > 0)"`)
+
+	// Without a logger at debug level nothing is traced.
+	traces.Reset()
+	program.SetLogger(slog.New(slog.NewTextHandler(&traces, nil)))
+	program.Evaluate()
+	require.Empty(t, traces.String())
+}
+
+func TestExplain(t *testing.T) {
+	input := `assert (x + y) * 4 == z * 2
+assert "sizes":
+    len(xs) > 2
+assert x + missing > 0
+assert x < 2`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+	require.NoError(t, program.SetValues(map[string]any{"x": 1, "y": 2, "z": 5, "xs": []any{1}}))
+
+	// Explanations are only recorded when asked for.
+	results, _ := evaluate(program)
+	require.Nil(t, results[0].Explanation)
+
+	program.SetExplain(true)
+	results, _ = evaluate(program)
+	require.Equal(t, `assert (x + y) * 4 == z * 2
+        | | |  |   |  | |
+        1 3 2  12  |  5 10
+                   false`, results[0].Explanation.String())
+
+	require.Equal(t, `assert "sizes":
+    len(xs) > 2
+    |   |   |
+    1   [1] false`, results[1].Explanation.String())
+
+	values := results[1].Explanation.Values
+	require.Equal(t, ExplainedValue{Expression: "len(xs)", Value: "1", Type: "number", Line: 3, Column: 5}, values[1])
+
+	// Subexpressions that cannot be evaluated keep their error.
+	values = results[2].Explanation.Values
+	require.Len(t, values, 4)
+	require.Equal(t, "unknown variable: missing", values[1].Error)
+	require.Equal(t, "unknown variable: missing", values[3].Error)
+	require.Equal(t, "assert x + missing > 0\n       |\n       1", results[2].Explanation.String())
+
+	require.Nil(t, results[3].Explanation)
+
+	data, err := results[0].Explanation.JSON()
+	require.NoError(t, err)
+	var decoded Explanation
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, *results[0].Explanation, decoded)
+	require.Contains(t, string(data), `"expression": "(((x + y) * 4) == (z * 2))",
+      "value": "false",
+      "type": "boolean",
+      "line": 1,
+      "column": 20`)
+
+	// The values are the ones the evaluation saw; nothing is evaluated again.
+	calls := 0
+	program = NewParser(lexer.NewLexer("assert now() < 2024-01-01T00:00:00Z")).ParseProgram()
+	program.SetClock(func() time.Time {
+		calls++
+		return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(calls) * time.Hour)
+	})
+	program.SetExplain(true)
+	results, _ = evaluate(program)
+	require.Equal(t, 1, calls)
+	require.Equal(t, "2024-06-01T01:00:00Z", results[0].Explanation.Values[0].Value)
+}
+
+func TestFreeVariables(t *testing.T) {
+	input := `def within(v, lo, hi) = lo <= v <= hi
+assume limit > 0
+assert latency < limit
+when env == "prod" {
+    assert forall r in replicas: r.healthy == 1
+}
+assert a + b == c where
+    | a | b | c |
+    | 1 | 2 | 3 |
+assert within(cpu, 0, max)
+assert defined(memory)
+assert (disk ?? 0) < limit`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.Equal(t, []string{"cpu", "disk", "env", "latency", "limit", "max", "memory", "replicas"}, program.FreeVariables())
+	require.Equal(t, [][]string{
+		{"latency", "limit"},
+		{"env", "replicas"},
+		{},
+		{"cpu", "max"},
+		{"memory"},
+		{"disk", "limit"},
+	}, program.StatementVariables())
+
+	variables := FreeVariables(&InfixExpression{Operator: "+", Left: &Variable{Value: "x"}, Right: &NumberLiteral{Value: 1}})
+	require.Equal(t, []string{"x"}, variables)
+}
+
+func TestValidate(t *testing.T) {
+	input := `assert latency < limit
+assert latency * 2 < limt
+assert cpu < 90
+assert defined(memory)
+assert (disk ?? 0) < 90`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.NoError(t, program.SetValues(map[string]any{"latncy": 10, "limit": 20, "cpu": 5, "memory": 1, "debug": 1}))
+	validation := program.Validate()
+	require.False(t, validation.Valid())
+	require.Equal(t, []MissingVariable{
+		{Name: "latency", Statements: []int{1, 2}, Suggestions: []string{"latncy"}},
+		{Name: "limt", Statements: []int{2}, Suggestions: []string{"limit"}},
+	}, validation.Missing)
+	require.Equal(t, []string{"debug", "latncy"}, validation.Unused)
+
+	var messages []string
+	for _, err := range validation.Errors() {
+		messages = append(messages, err.Error())
+	}
+	require.Equal(t, []string{
+		"missing variable latency, read by statements 1, 2, did you mean latncy?",
+		"missing variable limt, read by statement 2, did you mean limit?",
+		"unused value debug",
+		"unused value latncy",
+	}, messages)
+
+	require.NoError(t, program.SetValues(map[string]any{"latency": 10, "limit": 20, "limt": 30, "cpu": 5}))
+	validation = program.Validate()
+	require.True(t, validation.Valid())
+	require.Empty(t, validation.Errors())
+}
+
+func TestWalk(t *testing.T) {
+	input := `var cpu: float in [0, 100]
+scenario "idle" { cpu = 1 }
+assume cpu >= 0
+when env == "prod" {
+    assert -cpu < 90
+}
+suite "lists" {
+    assert forall r in [1, 2][0..1]: r.up == 1
+}
+assert (if cpu > 1 then a else b) ?? len(xs) < 5
+assert 0 < cpu <= 100 where
+    | cpu |
+    | 50 |`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram().AST()
+	require.Empty(t, p.Errors())
+
+	counts := map[string]int{}
+	program.Walk(func(node Node) bool {
+		counts[fmt.Sprintf("%T", node)]++
+		return true
+	})
+	require.Equal(t, map[string]int{
+		"*parser.AssertStatement":       4,
+		"*parser.AssumeStatement":       1,
+		"*parser.CallExpression":        1,
+		"*parser.ChainedComparison":     1,
+		"*parser.ConditionalExpression": 1,
+		"*parser.IndexExpression":       1,
+		"*parser.InfixExpression":       7,
+		"*parser.ListLiteral":           1,
+		"*parser.MemberExpression":      1,
+		"*parser.NumberLiteral":         15,
+		"*parser.PrefixExpression":      1,
+		"*parser.QuantifierExpression":  1,
+		"*parser.RangeExpression":       1,
+		"*parser.ScenarioBlock":         1,
+		"*parser.StringLiteral":         1,
+		"*parser.SuiteBlock":            1,
+		"*parser.VarDeclaration":        1,
+		"*parser.Variable":              9,
+		"*parser.WhenBlock":             1,
+	}, counts)
+
+	// Returning false skips the children of a node.
+	var statements []string
+	program.Walk(func(node Node) bool {
+		if _, ok := node.(Statement); ok {
+			if _, ok := node.(Expression); !ok {
+				statements = append(statements, node.TokenLiteral())
+			}
+		}
+		_, block := node.(*WhenBlock)
+		return !block
+	})
+	require.Equal(t, []string{"when", "suite", "assert", "assert", "assert", "assume", "scenario", "var"}, statements)
+}
+
+func TestRewrite(t *testing.T) {
+	input := `assert x < limit
+assert debug == 1
+when env == "prod" {
+    assert x * 2 < limit
+    assert debug == 1
+}`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram().AST()
+	require.Empty(t, p.Errors())
+
+	err := program.Rewrite(func(node Node) Node {
+		switch n := node.(type) {
+		case *Variable:
+			if n.Value == "limit" {
+				return &NumberLiteral{Token: constants.Token{Lexeme: "10"}, Value: 10}
+			}
+		case *AssertStatement:
+			if FreeVariables(n)[0] == "debug" {
+				return nil
+			}
+		}
+		return node
+	})
+	require.NoError(t, err)
+
+	partial, errs, success := program.PartialEvaluate()
+	require.True(t, success, errs)
+	require.Equal(t, []string{"assert (x < 10)", "when (env == \"prod\") {\n    assert ((x * 2) < 10)\n}"}, partial)
+
+	require.NoError(t, program.SetValues(map[string]any{"x": 6, "env": "prod"}))
+	results, success := evaluate(program)
+	require.False(t, success)
+	require.Len(t, results, 2)
+	require.Equal(t, StatusPass, results[0].Status)
+	require.Equal(t, 2, results[1].Number)
+	require.Equal(t, StatusFail, results[1].Status)
+
+	// Rewrite works on single expressions too.
+	expression := &InfixExpression{Operator: "+", Left: &Variable{Value: "x"}, Right: &Variable{Value: "y"}}
+	rewritten, err := Rewrite(expression, func(node Node) Node {
+		if variable, ok := node.(*Variable); ok {
+			return &Variable{Value: strings.ToUpper(variable.Value)}
+		}
+		return node
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"X", "Y"}, FreeVariables(rewritten))
+
+	// Scenarios and declarations are rewritten and declared again.
+	p = NewParser(lexer.NewLexer("var x: int in [0, 100]\nscenario \"peak\" { x = 60 }\nassert x > 99"))
+	program = p.ParseProgram().AST()
+	require.Empty(t, p.Errors())
+	err = program.Rewrite(func(node Node) Node {
+		if number, ok := node.(*NumberLiteral); ok && (number.Value == 60 || number.Value == 100) {
+			value := map[float64]float64{60: 150, 100: 200}[number.Value]
+			return &NumberLiteral{Token: constants.Token{Lexeme: formatNumber(value)}, Value: value}
+		}
+		return node
+	})
+	require.NoError(t, err)
+	require.Equal(t, "var x: int in [0, 200]", program.Declarations["x"].String())
+	report := program.EvaluateScenarios()
+	require.Equal(t, StatusPass, report.Results[0].Status)
+
+	// Nodes that cannot take the place of the node they replace are errors.
+	for _, tt := range []struct {
+		replace  func(Node) Node
+		expected string
+	}{
+		{
+			func(node Node) Node {
+				if _, ok := node.(*Variable); ok {
+					return nil
+				}
+				return node
+			},
+			"cannot replace expression x with nil",
+		},
+		{
+			func(node Node) Node {
+				if _, ok := node.(*InfixExpression); ok {
+					return &AssumeStatement{Expression: &Variable{Value: "y"}}
+				}
+				return node
+			},
+			"cannot replace expression (x < 100) with statement assume y",
+		},
+		{
+			func(node Node) Node {
+				if as, ok := node.(*AssertStatement); ok {
+					return as.Expression
+				}
+				return node
+			},
+			"cannot replace statement assert (x < 100) with expression (x < 100)",
+		},
+	} {
+		p = NewParser(lexer.NewLexer("assert x < 100"))
+		program = p.ParseProgram().AST()
+		require.Empty(t, p.Errors())
+		require.EqualError(t, program.Rewrite(tt.replace), tt.expected)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	input := `pragma tolerance 0.5
+assert (x + y) * 4 == z * 2
+@smoke require "positive":
+    -x < 0
+warn after "positive": x ~= 1.2
+assert !(y > 10)`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	data, err := json.Marshal(program)
+	require.NoError(t, err)
+
+	var decoded Program
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, program.AST().Tolerance, decoded.Tolerance)
+
+	again, err := json.Marshal(&decoded)
+	require.NoError(t, err)
+	require.JSONEq(t, string(data), string(again))
+
+	for _, values := range []map[string]any{
+		{"x": 1, "y": 2, "z": 6},
+		{"x": 1, "y": 11, "z": 1},
+		{"x": -1, "y": 2},
+	} {
+		require.NoError(t, program.SetValues(values))
+		require.NoError(t, decoded.SetValues(values))
+		expected := program.Evaluate()
+		actual := decoded.Evaluate()
+		require.Equal(t, expected.Summary, actual.Summary)
+		for i := range expected.Results {
+			want, got := expected.Results[i], actual.Results[i]
+			require.Equal(t, []any{want.Number, want.Name, want.Source, want.Span, want.Severity, want.Value, want.Status},
+				[]any{got.Number, got.Name, got.Source, got.Span, got.Severity, got.Value, got.Status})
+			require.Equal(t, fmt.Sprint(want.Err), fmt.Sprint(got.Err))
+		}
+	}
+
+	var encoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &encoded))
+	require.Equal(t, float64(SchemaVersion), encoded["version"])
+	statement := encoded["statements"].([]any)[1].(map[string]any)
+	require.Equal(t, "require", statement["severity"])
+	require.Equal(t, "positive", statement["name"])
+	require.Equal(t, []any{"smoke"}, statement["tags"])
+	require.Equal(t, map[string]any{
+		"type":     "prefix",
+		"operator": "-",
+		"span":     map[string]any{"start": map[string]any{"line": 4.0, "column": 5.0}, "end": map[string]any{"line": 4.0, "column": 7.0}},
+		"position": map[string]any{"line": 4.0, "column": 5.0},
+		"right": map[string]any{
+			"type":     "variable",
+			"name":     "x",
+			"span":     map[string]any{"start": map[string]any{"line": 4.0, "column": 6.0}, "end": map[string]any{"line": 4.0, "column": 7.0}},
+			"position": map[string]any{"line": 4.0, "column": 6.0},
+		},
+	}, statement["expression"].(map[string]any)["left"])
+
+	expression, err := UnmarshalExpression([]byte(`{"type": "infix", "operator": "*", "left": {"type": "number", "value": 2}, "right": {"type": "variable", "name": "x"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "(2 * x)", expression.String())
+	data, err = MarshalExpression(expression)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"literal":"2"`)
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"version": 2, "statements": []}`, "unsupported schema version 2, expected 1"},
+		{`{"version": 1, "statements": [{"type": "unless"}]}`, `statement 1: unknown statement type "unless"`},
+		{`{"version": 1, "statements": [{"type": "when"}]}`, "statement 1: missing expression"},
+		{`{"version": 1, "statements": [{"type": "assert", "severity": "must"}]}`, `statement 1: unknown severity "must"`},
+		{`{"version": 1, "statements": [{"type": "assert", "severity": "assert"}]}`, "statement 1: missing expression"},
+		{`{"version": 1, "statements": [{"type": "assert", "severity": "assert", "expression": {"type": "infix", "operator": "%"}}]}`, `statement 1: unknown infix operator "%"`},
+		{`{"version": 1, "statements": [{"type": "assert", "severity": "assert", "expression": {"type": "call"}}]}`, "statement 1: call without a source"},
+		{`{"version": 1, "statements": [{"type": "assert", "severity": "assert", "expression": {"type": "lambda"}}]}`, `statement 1: unknown expression type "lambda"`},
+		{`{"version": 1, "statements": [{"type": "assert", "severity": "assert", "expression": {"type": "chain", "operators": ["<"], "operands": [{"type": "variable", "name": "x"}]}}]}`, "statement 1: chain of 1 operands with 1 operators"},
+		{`{"version": 1, "statements": [], "scenarios": [{"type": "scenario", "source": "assert x"}]}`, `scenario 1: "assert x" is not a scenario`},
+	}
+
+	for _, tt := range tests {
+		var program Program
+		require.EqualError(t, json.Unmarshal([]byte(tt.input), &program), tt.expected)
+	}
+}
+
+// TestJSONNodes round-trips a program with every kind of statement and
+// expression.
+func TestJSONNodes(t *testing.T) {
+	input := `var mode: string in {"a", "b"}
+var x: int in [-10, 10]
+var y: int
+var xs: list
+scenario "small" { x = 3; xs = [1, 2]; mode = "a" }
+assume x >= 0
+suite "ranges" {
+    @smoke assert 0 <= x < 10
+    assert len(xs) == 2
+    assert xs[0] in 0..5
+}
+when mode == "a" {
+    assert forall v in xs: v < x
+    assert (if x > 1 then "big" else "small") == "big"
+    assert 2s < 3s
+}
+assert x + y < 10 where
+    | y |
+    | 1 |
+    | 9 |`
+
+	p := NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram().AST()
+	require.Empty(t, p.Errors())
+
+	data, err := json.Marshal(program)
+	require.NoError(t, err)
+
+	var decoded Program
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	again, err := json.Marshal(&decoded)
+	require.NoError(t, err)
+	require.JSONEq(t, string(data), string(again))
+
+	expected, actual := program.EvaluateScenarios(), decoded.EvaluateScenarios()
+	require.Equal(t, expected.Summary, actual.Summary)
+	require.Len(t, actual.Results, 8)
+	for i := range expected.Results {
+		require.Equal(t, []any{expected.Results[i].Number, expected.Results[i].Status, expected.Results[i].Case},
+			[]any{actual.Results[i].Number, actual.Results[i].Status, actual.Results[i].Case})
+	}
+
+	var encoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &encoded))
+	suite := encoded["statements"].([]any)[0].(map[string]any)
+	require.Equal(t, "suite", suite["type"])
+	chain := suite["statements"].([]any)[0].(map[string]any)["expression"].(map[string]any)
+	require.Equal(t, "chain", chain["type"])
+	require.Equal(t, []any{"<=", "<"}, chain["operators"])
+	call := suite["statements"].([]any)[1].(map[string]any)["expression"].(map[string]any)["left"].(map[string]any)
+	require.Equal(t, map[string]any{"type": "call", "source": "len(xs)"}, map[string]any{"type": call["type"], "source": call["source"]})
+
+	// A program whose assumption is broken still reports it once decoded.
+	require.NoError(t, decoded.SetValues(map[string]any{"x": -1, "y": 1, "xs": []any{}, "mode": "b"}))
+	require.Len(t, decoded.Evaluate().BrokenAssumptions, 1)
+
+	// Calls of a def are inlined, as the defs are not encoded.
+	p = NewParser(lexer.NewLexer("def double(v) = v * 2\nassert forall v in xs: double(v) < 10"))
+	program = p.ParseProgram().AST()
+	require.Empty(t, p.Errors())
+	data, err = json.Marshal(program)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "assert (forall v in xs: ((v * 2) < 10))", decoded.Statements[0].String())
+}
+
+func TestGraph(t *testing.T) {
+	input := `assert "sum": (x + y) * 4 == z * 2
+assert forall r in rs: r > "a"`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	require.Empty(t, p.Errors())
+
+	require.Equal(t, `digraph AST {
+  node [shape=box];
+  n0 [label="program"];
+  n1 [label="assert \"sum\""];
+  n2 [label="=="];
+  n3 [label="*"];
+  n4 [label="+"];
+  n5 [label="x"];
+  n6 [label="y"];
+  n7 [label="4"];
+  n8 [label="*"];
+  n9 [label="z"];
+  n10 [label="2"];
+  n11 [label="assert"];
+  n12 [label="forall r"];
+  n13 [label="rs"];
+  n14 [label=">"];
+  n15 [label="r"];
+  n16 [label="\"a\""];
+  n0 -> n1;
+  n1 -> n2;
+  n2 -> n3;
+  n3 -> n4;
+  n4 -> n5;
+  n4 -> n6;
+  n3 -> n7;
+  n2 -> n8;
+  n8 -> n9;
+  n8 -> n10;
+  n0 -> n11;
+  n11 -> n12;
+  n12 -> n13;
+  n12 -> n14;
+  n14 -> n15;
+  n14 -> n16;
+}
+`, program.DOT(GraphOptions{}))
+
+	require.NoError(t, program.SetValues(map[string]any{"x": 1, "y": 2, "z": 5, "rs": []any{"b"}}))
+	require.Equal(t, `flowchart TD
+  n0["program"]
+  n1["assert #quot;sum#quot;"]
+  n2["==<br/>= false"]:::failed
+  n3["*<br/>= 12"]
+  n4["+<br/>= 3"]
+  n5["x<br/>= 1"]
+  n6["y<br/>= 2"]
+  n7["4"]
+  n8["*<br/>= 10"]
+  n9["z<br/>= 5"]
+  n10["2"]
+  n11["assert"]
+  n12["forall r<br/>= true"]
+  n13["rs<br/>= [#quot;b#quot;]"]
+  n14["#gt;"]
+  n15["r"]
+  n16["#quot;a#quot;"]
+  n0 --> n1
+  n1 --> n2
+  n2 --> n3
+  n3 --> n4
+  n4 --> n5
+  n4 --> n6
+  n3 --> n7
+  n2 --> n8
+  n8 --> n9
+  n8 --> n10
+  n0 --> n11
+  n11 --> n12
+  n12 --> n13
+  n12 --> n14
+  n14 --> n15
+  n14 --> n16
+  classDef failed stroke:#d00,color:#d00
+`, program.Mermaid(GraphOptions{Values: true}))
+
+	expression := &PrefixExpression{Operator: "-", Right: &Variable{Value: "missing"}}
+	require.Equal(t, `digraph AST {
+  node [shape=box];
+  n0 [label="-\n= error: unknown variable: missing", color=red];
+  n1 [label="missing\n= error: unknown variable: missing", color=red];
+  n0 -> n1;
+}
+`, DOT(expression, GraphOptions{Values: true}))
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"assert ((x * y) + 6)", "assert x * y + 6\n"},
+		{"assert  x>1\n\n\n\nassert y<2", "assert x > 1\n\nassert y < 2\n"},
+		// - binds looser than +, and * looser than /, but the right operand of
+		// either keeps its parentheses as it reads left to right.
+		{"assert a - (b + c) == (a - b) + c", "assert a - (b + c) == (a - b) + c\n"},
+		{"assert a - b + c == a - (b - c)", "assert a - (b + c) == a - (b - c)\n"},
+		{"assert a * (b / c) == a * b / c", "assert a * (b / c) == a * (b / c)\n"},
+		{"assert (a / b) * c == a / (b * c)", "assert a / b * c == a / (b * c)\n"},
+		{"assert (a < b) < c", "assert (a < b) < c\n"},
+		{"assert 0 <= x < (y < z)", "assert 0 <= x < (y < z)\n"},
+		{"assert -(-x) == !(a == b)", "assert --x == !(a == b)\n"},
+		{"assert (-x).y + f((a + b), [1, (2)]) > xs[(i)]", "assert (-x).y + f(a + b, [1, 2]) > xs[i]\n"},
+		{"assert (forall r in rs: r > 0) == (if a then b else c)", "assert (forall r in rs: r > 0) == (if a then b else c)\n"},
+		{"assert x in (0..(n + 1))", "assert x in 0..n + 1\n"},
+		{
+			"let limit = (2 * 3)\ndef ratio(a, b) = a / (b * 2)\nvar x: float in [(-1), 10]\nassume (x > 0)\npragma tolerance 0.01",
+			"let limit = 2 * 3\ndef ratio(a, b) = a / (b * 2)\nvar x: float in [-1, 10]\nassume x > 0\npragma tolerance 0.01\n",
+		},
+		{
+			`@slow assert "ratio" after "a":(x+1)>2 where
+  | x | y |
+  | 1 | 100 |
+  | 20 | (2) |`,
+			`@slow assert "ratio" after "a": x + 1 > 2 where
+    | x  | y   |
+    | 1  | 100 |
+    | 20 | 2   |
+`,
+		},
+		{
+			`suite "s" {
+  when x > 1 {
+  assert x > 2
+
+  scenario "no" { x = 1 }
+  }
+}`,
+			"",
+		},
+		{
+			`scenario "peak" {
+  x = 3
+  y = -6
+}
+suite "s" { @slow when x > 1 { assert x > 2
+
+warn y > 3 } }`,
+			`scenario "peak" { x = 3; y = -6 }
+suite "s" {
+    @slow when x > 1 {
+        assert x > 2
+
+        warn y > 3
+    }
+}
+`,
+		},
+		{
+			`assert "capacity": used_memory_bytes + reserved_memory_bytes < total_memory_bytes * 0.9`,
+			`assert "capacity":
+    used_memory_bytes + reserved_memory_bytes < total_memory_bytes * 0.9
+`,
+		},
+		{
+			`assert used_memory_bytes + reserved_memory_bytes + cached_memory_bytes + buffered_memory_bytes < total_memory_bytes * 0.9`,
+			`assert used_memory_bytes + reserved_memory_bytes + cached_memory_bytes
+    + buffered_memory_bytes
+    < total_memory_bytes * 0.9
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Format(tt.input)
+		if tt.expected == "" {
+			require.Error(t, err, tt.input)
+			continue
+		}
+		require.NoError(t, err, tt.input)
+		require.Equal(t, tt.expected, formatted)
+
+		again, err := Format(formatted)
+		require.NoError(t, err)
+		require.Equal(t, formatted, again, "formatting is not idempotent")
+
+		original := NewParser(lexer.NewLexer(tt.input)).ParseProgram().(*Program)
+		reformatted := NewParser(lexer.NewLexer(formatted)).ParseProgram().(*Program)
+		require.Equal(t, len(original.Statements), len(reformatted.Statements))
+		for i := range original.Statements {
+			require.Equal(t, original.Statements[i].String(), reformatted.Statements[i].String())
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"assert x > 1 )", "unexpected ) on line 1"},
+		{"assert x > 1\n2", "unexpected 2 on line 2"},
+		{"when x > 1 {\n    assert x > 1 ]\n}", "unexpected ] on line 2"},
+		{"assert x >", "no prefix parse function"},
+	}
+
+	for _, tt := range tests {
+		_, err := Format(tt.input)
+		require.ErrorContains(t, err, tt.expected)
+	}
+
+	// The parser skips these tokens when it does not format.
+	p := NewParser(lexer.NewLexer("assert x > 1 )"))
+	p.ParseProgram()
+	require.Empty(t, p.Errors())
 }
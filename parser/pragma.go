@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strconv"
+	"strings"
+)
+
+// PragmaStatement configures how the file it appears in is evaluated, e.g.
+// pragma tolerance 0.001 0.0001 sets the absolute and relative tolerance of
+// ~= and approx(). A tolerance that is not given is 0, as for approx(). The
+// pragmas of the main file are applied to the Program while parsing, those of
+// an included file to the statements of that file only. Pragmas are not
+// evaluated as statements.
+type PragmaStatement struct {
+	Token     constants.Token
+	Name      string
+	Arguments []float64
+}
+
+func (ps *PragmaStatement) TokenLiteral() string { return ps.Token.Lexeme }
+
+func (ps *PragmaStatement) Children() []Node { return nil }
+
+func (ps *PragmaStatement) Evaluate(env *Env) (float64, error) { return 0, nil }
+
+func (ps *PragmaStatement) PartialEvaluate(env *Env) (string, error) { return ps.String(), nil }
+
+func (ps *PragmaStatement) String() string {
+	args := make([]string, len(ps.Arguments))
+	for i, arg := range ps.Arguments {
+		args[i] = strconv.FormatFloat(arg, 'f', -1, 64)
+	}
+	return strings.TrimSpace(fmt.Sprintf("pragma %s %s", ps.Name, strings.Join(args, " ")))
+}
+
+// apply sets the pragma on the program, or for an included file, on the
+// parser of the file.
+func (ps *PragmaStatement) apply(p *Parser, program *Program) error {
+	switch ps.Name {
+	case "tolerance":
+		if len(ps.Arguments) < 1 || len(ps.Arguments) > 2 {
+			return fmt.Errorf("pragma tolerance expects an absolute and an optional relative tolerance")
+		}
+
+		t := Tolerance{Absolute: ps.Arguments[0]}
+		if len(ps.Arguments) == 2 {
+			t.Relative = ps.Arguments[1]
+		}
+		if t.Absolute < 0 || t.Relative < 0 {
+			return fmt.Errorf("pragma tolerance must not be negative")
+		}
+
+		if p.included {
+			p.tolerance = &t
+		} else {
+			program.Tolerance = &t
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown pragma: %s", ps.Name)
+	}
+}
+
+// setTolerance gives the tolerance of a pragma to a statement of an included
+// file and to the statements nested in it.
+func setTolerance(stmt Statement, t *Tolerance) {
+	Walk(stmt, func(node Node) bool {
+		switch s := node.(type) {
+		case *AssertStatement:
+			s.tolerance = t
+		case *AssumeStatement:
+			s.tolerance = t
+		case *WhenBlock:
+			s.tolerance = t
+		case Expression:
+			return false
+		}
+		return true
+	})
+}
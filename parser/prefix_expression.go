@@ -13,42 +13,66 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Lexeme }
 
+func (pe *PrefixExpression) Children() []Node { return []Node{pe.Right} }
+
+func (pe *PrefixExpression) setChildren(children []Node) { pe.Right = children[0].(Expression) }
+
+func (pe *PrefixExpression) Evaluate(env *Env) (float64, error) { return evaluateNumber(pe, env) }
+
+func (pe *PrefixExpression) EvaluateValue(env *Env) (Value, error) {
+	right, err := env.evaluate(pe.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluatePrefix(pe.Operator, right)
+}
+
 // todo: verify if this is correct
-func (pe *PrefixExpression) Evaluate() (float64, error) {
-	right, err := pe.Right.Evaluate()
+func evaluatePrefix(operator string, rightValue Value) (Value, error) {
+	if quantity, ok := rightValue.(QuantityValue); ok && operator == "-" {
+		return QuantityValue{Amount: -quantity.Amount, Unit: quantity.Unit}, nil
+	}
+	if b, ok := rightValue.(BoolValue); ok && operator == "!" {
+		return truth(!bool(b)), nil
+	}
+
+	right, err := toNumber(rightValue)
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("%s: %s", operator, err)
 	}
 
-	switch pe.Operator {
+	switch operator {
 	case "!":
 		if right == 0 {
-			return 1, nil
+			return NumberValue(1), nil
 		} else {
-			return 0, nil
+			return NumberValue(0), nil
 		}
+	case "-":
+		return NumberValue(-right), nil
 	default:
-		return 0, fmt.Errorf("unknown operator: %s", pe.Operator)
+		return nil, fmt.Errorf("unknown operator: %s", operator)
 	}
 }
 
-func (pe *PrefixExpression) PartialEvaluate() (string, error) {
-	right, err := pe.Right.PartialEvaluate()
+func (pe *PrefixExpression) PartialEvaluate(env *Env) (string, error) {
+	right, err := pe.Right.PartialEvaluate(env)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = IsConstant(right)
-	if err != nil {
+	rightValue, ok := constantValue(right)
+	if !ok {
 		return fmt.Sprintf("(%s %s)", pe.Operator, right), nil
 	}
 
-	evaluatedValue, err := pe.Evaluate()
+	evaluatedValue, err := evaluatePrefix(pe.Operator, rightValue)
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%.2f", evaluatedValue), nil
+	return evaluatedValue.String(), nil
 }
 
 func (pe *PrefixExpression) String() string {
@@ -1,67 +1,225 @@
 package parser
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"strings"
+)
 
-type PrintVisitorStruct struct{}
+// PrintVisitorStruct writes the AST to out.
+type PrintVisitorStruct struct {
+	out io.Writer
+}
+
+func NewPrintVisitor(out io.Writer) PrintVisitor {
+	return &PrintVisitorStruct{out: out}
+}
 
-func NewPrintVisitor() PrintVisitor {
-	return &PrintVisitorStruct{}
+func (pv *PrintVisitorStruct) printIndent(indent int) {
+	for i := 0; i < indent; i++ {
+		fmt.Fprint(pv.out, "    ")
+	}
 }
 
 func (pv *PrintVisitorStruct) VisitProgram(p *Program, indent int) {
-	fmt.Println("Program:")
+	fmt.Fprintln(pv.out, "Program:")
 	for _, stmt := range p.Statements {
-		printIndent(indent + 1)
-		fmt.Println("-> Statement:")
-		if expr, ok := stmt.(Expression); ok {
-			pv.VisitExpression(expr, indent+2)
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "-> Statement:")
+		pv.VisitStatement(stmt, indent+2)
+	}
+}
+
+func (pv *PrintVisitorStruct) VisitStatement(s Statement, indent int) {
+	switch stmt := s.(type) {
+	case *AssertStatement:
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "AssertStatement:")
+		if stmt.Name != "" {
+			pv.printIndent(indent + 1)
+			fmt.Fprintf(pv.out, "Name: %s\n", stmt.Name)
+		}
+		if len(stmt.Tags) > 0 {
+			pv.printIndent(indent + 1)
+			fmt.Fprintf(pv.out, "Tags: %s\n", strings.Join(stmt.Tags, ", "))
 		}
+		pv.VisitExpression(stmt.Expression, indent+1)
+		if stmt.Where != nil {
+			pv.printIndent(indent + 1)
+			fmt.Fprintf(pv.out, "Where: %s\n", strings.Join(stmt.Where.Columns, ", "))
+			for i := range stmt.Where.Rows {
+				pv.printIndent(indent + 2)
+				fmt.Fprintln(pv.out, stmt.Where.describeRow(i))
+			}
+		}
+
+	case *WhenBlock:
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "WhenBlock:")
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Guard:")
+		pv.VisitExpression(stmt.Guard, indent+2)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Statements:")
+		for _, nested := range stmt.Statements {
+			pv.VisitStatement(nested, indent+2)
+		}
+
+	case *SuiteBlock:
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "SuiteBlock: %s\n", stmt.Name)
+
+		for _, nested := range stmt.Statements {
+			pv.VisitStatement(nested, indent+1)
+		}
+
+	default:
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "Unknown statement type")
 	}
 }
 
 func (pv *PrintVisitorStruct) VisitExpression(e Expression, indent int) {
 	switch expr := e.(type) {
 	case *InfixExpression:
-		printIndent(indent)
-		fmt.Println("InfixExpression:")
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "InfixExpression:")
 
-		printIndent(indent + 1)
-		fmt.Println("Left:")
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Left:")
 		pv.VisitExpression(expr.Left, indent+2)
 
-		printIndent(indent + 1)
-		fmt.Printf("Operator: %s\n", expr.Operator)
+		pv.printIndent(indent + 1)
+		fmt.Fprintf(pv.out, "Operator: %s\n", expr.Operator)
 
-		printIndent(indent + 1)
-		fmt.Println("Right:")
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Right:")
 		pv.VisitExpression(expr.Right, indent+2)
 
+	case *ChainedComparison:
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "ChainedComparison:")
+
+		for i, operand := range expr.Operands {
+			if i > 0 {
+				pv.printIndent(indent + 1)
+				fmt.Fprintf(pv.out, "Operator: %s\n", expr.Operators[i-1])
+			}
+			pv.VisitExpression(operand, indent+1)
+		}
+
 	case *PrefixExpression:
-		printIndent(indent)
-		fmt.Println("PrefixExpression:")
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "PrefixExpression:")
 
-		printIndent(indent + 1)
-		fmt.Printf("Operator: %s\n", expr.Operator)
+		pv.printIndent(indent + 1)
+		fmt.Fprintf(pv.out, "Operator: %s\n", expr.Operator)
 
-		printIndent(indent + 1)
-		fmt.Println("Right:")
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Right:")
 		pv.VisitExpression(expr.Right, indent+2)
 
 	case *NumberLiteral:
-		printIndent(indent)
-		fmt.Printf("NumberLiteral: %.2f\n", expr.Value)
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "NumberLiteral: %.2f\n", expr.Value)
 
 	case *Variable:
-		printIndent(indent)
-		fmt.Printf("Variable: %s\n", expr.Value)
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "Variable: %s\n", expr.Value)
 
-	case *AssertStatement:
-		printIndent(indent)
-		fmt.Println("AssertStatement:")
-		pv.VisitExpression(expr.Expression, indent+1)
+	case *QuantityLiteral:
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "QuantityLiteral: %.2f%s\n", expr.Value, expr.Unit)
+
+	case *TimeLiteral:
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "TimeLiteral: %s\n", expr.Token.Lexeme)
+
+	case *StringLiteral:
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "StringLiteral: %q\n", expr.Value)
+
+	case *ListLiteral:
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "ListLiteral:")
+		for _, element := range expr.Elements {
+			pv.VisitExpression(element, indent+1)
+		}
+
+	case *IndexExpression:
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "IndexExpression:")
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Left:")
+		pv.VisitExpression(expr.Left, indent+2)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Index:")
+		pv.VisitExpression(expr.Index, indent+2)
+
+	case *MemberExpression:
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "MemberExpression: %s\n", expr.Property)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Object:")
+		pv.VisitExpression(expr.Object, indent+2)
+
+	case *RangeExpression:
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "RangeExpression:")
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Start:")
+		pv.VisitExpression(expr.Start, indent+2)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "End:")
+		pv.VisitExpression(expr.End, indent+2)
+
+	case *QuantifierExpression:
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "QuantifierExpression: %s %s\n", expr.Quantifier, expr.Variable)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Domain:")
+		pv.VisitExpression(expr.Domain, indent+2)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Body:")
+		pv.VisitExpression(expr.Body, indent+2)
+
+	case *ConditionalExpression:
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "ConditionalExpression:")
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Condition:")
+		pv.VisitExpression(expr.Condition, indent+2)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Then:")
+		pv.VisitExpression(expr.Consequence, indent+2)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Else:")
+		pv.VisitExpression(expr.Alternative, indent+2)
+
+	case *CallExpression:
+		pv.printIndent(indent)
+		fmt.Fprintf(pv.out, "CallExpression: %s\n", expr.Function)
+
+		pv.printIndent(indent + 1)
+		fmt.Fprintln(pv.out, "Arguments:")
+		for _, argument := range expr.Arguments {
+			pv.VisitExpression(argument, indent+2)
+		}
 
 	default:
-		printIndent(indent)
-		fmt.Println("Unknown expression type")
+		pv.printIndent(indent)
+		fmt.Fprintln(pv.out, "Unknown expression type")
 	}
 }
@@ -1,58 +1,303 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
-)
-
-var (
-	ValueMap map[string]float64
+	"log/slog"
+	"strings"
+	"time"
 )
 
 type Program struct {
-	Statements []Statement
+	Statements    []Statement
+	MissingPolicy MissingPolicy
+
+	// Tolerance is used by ~= and approx(). When nil, DefaultTolerance is used.
+	Tolerance *Tolerance
+
+	// Clock is read by now(). When nil, the system clock is used.
+	Clock func() time.Time
+
+	// Units annotates variables of the value map with their unit, e.g.
+	// latency: ms.
+	Units map[string]string
+
+	// Declarations holds the declared types and domains of variables, e.g.
+	// var cpu: float in [0, 100]. A program that declares variables must
+	// declare every variable it reads.
+	Declarations map[string]*VarDeclaration
+
+	// Assumptions are the assume statements of the program. They simplify
+	// partial evaluation and are checked, but not asserted, by Evaluate.
+	Assumptions []*AssumeStatement
+
+	// Scenarios are the inline fixtures of the program, evaluated by
+	// EvaluateScenarios.
+	Scenarios []*ScenarioBlock
+
+	// Logger receives a debug trace per evaluated assert and partially
+	// evaluated statement. When nil, nothing is logged.
+	Logger *slog.Logger
+
+	// Explain records the value of every subexpression of an assert that
+	// fails or has an error in the Explanation of its result.
+	Explain bool
+
+	values   map[string]Value
+	selected map[*AssertStatement]bool
 }
 
 func (p *Program) SetValueMap(vm map[string]float64) {
-	ValueMap = vm
+	p.values = make(map[string]Value, len(vm))
+	for name, value := range vm {
+		p.values[name] = NumberValue(value)
+	}
+}
+
+// SetValues sets a value map that may also hold strings and lists, for
+// example one decoded from JSON.
+func (p *Program) SetValues(vm map[string]any) error {
+	values := make(map[string]Value, len(vm))
+	for name, value := range vm {
+		converted, err := ToValue(value)
+		if err != nil {
+			return fmt.Errorf("variable %s: %s", name, err)
+		}
+		values[name] = converted
+	}
+
+	p.values = values
+	return nil
+}
+
+func (p *Program) SetMissingPolicy(policy MissingPolicy) {
+	p.MissingPolicy = policy
+}
+
+// SetTolerance sets the tolerance of ~= and approx() of the program,
+// overriding the tolerance pragma of the main file. Included files with a
+// tolerance pragma of their own keep it for their statements.
+func (p *Program) SetTolerance(absolute, relative float64) {
+	p.Tolerance = &Tolerance{Absolute: absolute, Relative: relative}
 }
 
-func (p *Program) Evaluate() ([]float64, []error, bool) {
-	var results []float64
+// SetUnits annotates variables of the value map with units, so that a plain
+// number like latency: 250 is read as 250ms.
+func (p *Program) SetUnits(annotations map[string]string) error {
+	for name, unitName := range annotations {
+		if _, ok := units[unitName]; !ok {
+			return fmt.Errorf("variable %s: %s", name, unknownUnitError(unitName))
+		}
+	}
+
+	p.Units = annotations
+	return nil
+}
+
+// CheckUnits checks that every statement combines compatible units, e.g. it
+// rejects latency + memory when latency is in ms and memory in MiB. It
+// returns one error per statement that fails the check.
+func (p *Program) CheckUnits() []error {
 	var errs []error
-	success := true
+	for i, stmt := range p.Statements {
+		if err := checkUnits(stmt, p.Units, p.values); err != nil {
+			errs = append(errs, fmt.Errorf("error checking statement %d: %w", i+1, err))
+		}
+	}
+	return errs
+}
 
+// Check runs the type checker over every statement and the value map. It
+// reports operators applied to values of the wrong type, undeclared
+// variables, and values that break the declared type or domain of their
+// variable.
+func (p *Program) Check() []error {
+	var errs []error
 	for i, stmt := range p.Statements {
-		fmt.Printf("\nEvaluating statement %d\n", i + 1)
+		if err := checkTypes(stmt, p.Declarations, nil); err != nil {
+			errs = append(errs, fmt.Errorf("error checking statement %d: %w", i+1, err))
+		}
+	}
+	for i, assumption := range p.Assumptions {
+		if err := checkTypes(&AssertStatement{Expression: assumption.Expression}, p.Declarations, nil); err != nil {
+			errs = append(errs, fmt.Errorf("error checking assumption %d: %w", i+1, err))
+		}
+	}
 
-		result, err := stmt.Evaluate()
-		fmt.Printf("Result: %f\n\n", result)
-		if err != nil {
-			success = false
-			errs = append(errs, fmt.Errorf("error evaluating statement %d: %s", i, err))
+	values, err := withUnits(p.values, p.Units)
+	if err != nil {
+		return append(errs, err)
+	}
+	for _, name := range declaredNames(p.Declarations) {
+		if value, ok := values[name]; ok {
+			if err := p.Declarations[name].check(value); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// SetClock sets the clock read by now(), e.g. a fixed time in tests.
+func (p *Program) SetClock(c func() time.Time) {
+	p.Clock = c
+}
+
+func (p *Program) SetLogger(logger *slog.Logger) {
+	p.Logger = logger
+}
+
+func (p *Program) SetExplain(explain bool) {
+	p.Explain = explain
+}
+
+// Evaluate evaluates every selected assert and returns a report with one
+// result per assert, in source order. Prerequisites are evaluated before the
+// asserts that depend on them.
+func (p *Program) Evaluate() Report {
+	results, broken := p.evaluate(p.values, "")
+	report := newReport(results)
+	report.BrokenAssumptions = broken
+	return report
+}
+
+// env returns the environment the program is evaluated in: its value map,
+// read in the units of the program, and its settings.
+func (p *Program) env(values map[string]Value) (*Env, error) {
+	annotated, err := withUnits(values, p.Units)
+	if err != nil {
+		return newEnv(p, values), err
+	}
+	return newEnv(p, annotated), nil
+}
+
+// evaluate evaluates the program against values and returns the results and
+// the assumptions the values broke; scenario names the scenario that provided
+// them, if any.
+func (p *Program) evaluate(values map[string]Value, scenario string) ([]Result, []error) {
+	env, unitsErr := p.env(values)
+
+	var broken []error
+	for i, assumption := range p.Assumptions {
+		err := unitsErr
+		if err == nil {
+			err = assumption.check(env)
+		}
+		if err == nil {
+			continue
 		}
+		if scenario != "" {
+			broken = append(broken, fmt.Errorf("error evaluating assumption %d (scenario %q): %w", i+1, scenario, err))
+		} else {
+			broken = append(broken, fmt.Errorf("error evaluating assumption %d: %w", i+1, err))
+		}
+	}
 
-		results = append(results, result)
+	return newEvaluation(p, env, unitsErr, scenario).run(), broken
+}
+
+// EvaluateScenarios evaluates the program once per scenario, with the values
+// of the scenario as the value map, and returns a report with the results of
+// every scenario. The value map of the program is left as it is.
+func (p *Program) EvaluateScenarios() Report {
+	var results []Result
+	var broken []error
+	for _, scenario := range p.Scenarios {
+		scenarioResults, scenarioBroken := p.evaluate(scenario.values, scenario.Name)
+		results = append(results, scenarioResults...)
+		broken = append(broken, scenarioBroken...)
 	}
 
-	return results, errs, success
+	report := newReport(results)
+	report.BrokenAssumptions = broken
+	return report
 }
 
+// evaluateStatement checks the units of a statement before evaluating it and,
+// when the program declares variables, its types and the values it reads.
+func (p *Program) evaluateStatement(stmt Statement, env *Env) (float64, error) {
+	if err := checkUnits(stmt, p.Units, env.values); err != nil {
+		return -1, err
+	}
+	if len(p.Declarations) > 0 {
+		if err := checkTypes(stmt, p.Declarations, env.values); err != nil {
+			return -1, err
+		}
+	}
+	return stmt.Evaluate(env)
+}
+
+// failureStatus returns the status of an assert that did not pass: failed
+// when it does not hold, and otherwise an error, or what the missing policy
+// says when it read a missing value.
+func (p *Program) failureStatus(err error) Status {
+	var failure *AssertionError
+	if errors.As(err, &failure) {
+		return StatusFail
+	}
+	if !isMissing(err) {
+		return StatusError
+	}
+
+	switch p.MissingPolicy {
+	case MissingSkip:
+		return StatusSkip
+	case MissingUnknown:
+		return StatusUnknown
+	default:
+		return StatusError
+	}
+}
+
+// tracePartial logs the partial evaluation of a statement at debug level.
+func (p *Program) tracePartial(number int, statements []string, err error) {
+	if p.Logger == nil {
+		return
+	}
+
+	args := []any{"number", number, "result", strings.Join(statements, "\n")}
+	if err != nil {
+		args = append(args, "error", err.Error())
+	}
+	p.Logger.Debug("partially evaluated statement", args...)
+}
+
+// PartialEvaluate simplifies the selected asserts as far as the program allows
+// without values. The asserts are simplified under the assumptions, so the
+// assumptions come first in the results: a program parsed from the results
+// still checks them.
 func (p *Program) PartialEvaluate() ([]string, []error, bool) {
 	var results []string
 	var errs []error
 	success := true
 
-	for i, stmt := range p.Statements {
-		fmt.Printf("\nEvaluating statement %d\n", i + 1)
+	for i, assumption := range p.Assumptions {
+		partial, err := assumption.PartialEvaluate(&Env{program: p})
+		if err != nil {
+			success = false
+			errs = append(errs, fmt.Errorf("error evaluating assumption %d: %s", i+1, err))
+			continue
+		}
+		results = append(results, partial)
+	}
 
-		result, err := stmt.PartialEvaluate()
-		fmt.Printf("Result: %s\n\n", result)
+	assumptions, err := newFacts(p.Assumptions)
+	if err != nil {
+		success = false
+		errs = append(errs, fmt.Errorf("error evaluating assumptions: %s", err))
+	}
+	env := &Env{program: p, assumed: assumptions}
+
+	for i, stmt := range p.Statements {
+		statements, err := partialStatements([]Statement{stmt}, env, p.isSelected)
+		p.tracePartial(i+1, statements, err)
 		if err != nil {
 			success = false
-			errs = append(errs, fmt.Errorf("error evaluating statement %d: %s", i, err))
+			errs = append(errs, fmt.Errorf("error evaluating statement %d: %s", i+1, err))
+			statements = []string{""}
 		}
 
-		results = append(results, result)
+		results = append(results, statements...)
 	}
 
 	return results, errs, success
@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+)
+
+// QuantifierExpression is for expressions like forall s in shards: s < 5 or
+// exists i in 0..n: xs[i] == 0. The bound variable is only visible in the body.
+type QuantifierExpression struct {
+	Token      constants.Token
+	Quantifier string
+	Variable   string
+	Domain     Expression
+	Body       Expression
+}
+
+func (qe *QuantifierExpression) TokenLiteral() string { return qe.Token.Lexeme }
+
+func (qe *QuantifierExpression) Children() []Node { return []Node{qe.Domain, qe.Body} }
+
+func (qe *QuantifierExpression) setChildren(children []Node) {
+	qe.Domain = children[0].(Expression)
+	qe.Body = children[1].(Expression)
+}
+
+func (qe *QuantifierExpression) Evaluate(env *Env) (float64, error) { return evaluateNumber(qe, env) }
+
+func (qe *QuantifierExpression) EvaluateValue(env *Env) (Value, error) {
+	domain, err := qe.domain(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body is evaluated once per element, so its values are not
+	// explained.
+	body := env.unobserved()
+	for i := 0; i < domain.size; i++ {
+		element := domain.element(i)
+		value, err := qe.Body.EvaluateValue(body.bind(qe.Variable, element))
+		if err != nil {
+			return nil, fmt.Errorf("%s %s = %s (%s): %w", qe.Quantifier, qe.Variable, element.String(), domain.label(i), err)
+		}
+
+		holds, err := isTrue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", qe.Quantifier, err)
+		}
+
+		if qe.Quantifier == "forall" && !holds {
+			env.recordFailure(qe, fmt.Sprintf("violated by %s = %s (%s)", qe.Variable, element.String(), domain.label(i)))
+			return truth(false), nil
+		}
+		if qe.Quantifier == "exists" && holds {
+			return truth(true), nil
+		}
+	}
+
+	if qe.Quantifier == "exists" {
+		env.recordFailure(qe, fmt.Sprintf("no %s in %d elements satisfied the body", qe.Variable, domain.size))
+		return truth(false), nil
+	}
+	return truth(true), nil
+}
+
+// quantifierDomain holds the elements a quantifier goes through and a label
+// for each, the index for lists and ranges and the key for objects.
+type quantifierDomain struct {
+	size    int
+	element func(i int) Value
+	label   func(i int) string
+}
+
+func indexLabel(i int) string { return fmt.Sprintf("index %d", i) }
+
+// domain evaluates the domain of the quantifier. A range is gone through
+// without building the list of its elements.
+func (qe *QuantifierExpression) domain(env *Env) (quantifierDomain, error) {
+	if r, ok := qe.Domain.(*RangeExpression); ok {
+		start, end, err := r.bounds(env)
+		if err != nil {
+			return quantifierDomain{}, err
+		}
+		return quantifierDomain{
+			size:    max(end-start, 0),
+			element: func(i int) Value { return NumberValue(start + i) },
+			label:   indexLabel,
+		}, nil
+	}
+
+	value, err := env.evaluate(qe.Domain)
+	if err != nil {
+		return quantifierDomain{}, err
+	}
+
+	switch d := value.(type) {
+	case ListValue:
+		return quantifierDomain{
+			size:    len(d),
+			element: func(i int) Value { return d[i] },
+			label:   indexLabel,
+		}, nil
+	case ObjectValue:
+		keys := d.Keys()
+		return quantifierDomain{
+			size:    len(keys),
+			element: func(i int) Value { return d[keys[i]] },
+			label:   func(i int) string { return fmt.Sprintf("key %q", keys[i]) },
+		}, nil
+	default:
+		return quantifierDomain{}, fmt.Errorf("%s: expected list or object, got %s", qe.Quantifier, value.Type())
+	}
+}
+
+func (qe *QuantifierExpression) PartialEvaluate(env *Env) (string, error) {
+	domain, err := qe.Domain.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	variable := qe.residualVariable()
+	body, err := qe.Body.PartialEvaluate(env.bindResidual(qe.Variable, variable))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("(%s %s in %s: %s)", qe.Quantifier, variable, domain, body), nil
+}
+
+// residualVariable returns the name of the variable in the residual. When a
+// def called in the body reads a variable of the same name from the value
+// map, the inlined body would be captured by the quantifier, so the variable
+// is renamed to the first of v_1, v_2, ... that nothing in the body uses.
+func (qe *QuantifierExpression) residualVariable() string {
+	vc := newVariableCollector()
+	vc.bound[qe.Variable]++
+	vc.collect(qe.Body, false)
+	if _, captured := vc.required[qe.Variable]; !captured {
+		return qe.Variable
+	}
+
+	used := map[string]bool{}
+	collectNames(qe.Body, used, map[*Definition]bool{})
+	for i := 1; ; i++ {
+		if name := fmt.Sprintf("%s_%d", qe.Variable, i); !used[name] {
+			return name
+		}
+	}
+}
+
+// collectNames adds the variables an expression and the defs it calls read or
+// bind to used.
+func collectNames(e Expression, used map[string]bool, calling map[*Definition]bool) {
+	Walk(e, func(node Node) bool {
+		switch n := node.(type) {
+		case *Variable:
+			used[n.Value] = true
+		case *QuantifierExpression:
+			used[n.Variable] = true
+		case *CallExpression:
+			if n.definition != nil && !calling[n.definition] {
+				calling[n.definition] = true
+				for _, parameter := range n.definition.Parameters {
+					used[parameter] = true
+				}
+				collectNames(n.definition.Body, used, calling)
+			}
+		}
+		return true
+	})
+}
+
+func (qe *QuantifierExpression) String() string {
+	return fmt.Sprintf("(%s %s in %s: %s)", qe.Quantifier, qe.Variable, qe.Domain.String(), qe.Body.String())
+}
@@ -0,0 +1,26 @@
+package parser
+
+import "parser/constants"
+
+// QuantityLiteral is for numbers with a unit like 200ms or 1.5GiB.
+type QuantityLiteral struct {
+	Token constants.Token
+	Value float64
+	Unit  string
+}
+
+func (ql *QuantityLiteral) TokenLiteral() string { return ql.Token.Lexeme }
+
+func (ql *QuantityLiteral) Children() []Node { return nil }
+
+func (ql *QuantityLiteral) Evaluate(env *Env) (float64, error) { return evaluateNumber(ql, env) }
+
+func (ql *QuantityLiteral) EvaluateValue(env *Env) (Value, error) {
+	return QuantityValue{Amount: ql.Value, Unit: ql.Unit}, nil
+}
+
+func (ql *QuantityLiteral) PartialEvaluate(env *Env) (string, error) {
+	return formatNumber(ql.Value) + ql.Unit, nil
+}
+
+func (ql *QuantityLiteral) String() string { return ql.Token.Lexeme }
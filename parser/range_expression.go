@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"parser/constants"
+)
+
+// RangeExpression is for integer ranges like 0..n, which include the start
+// and exclude the end.
+//
+// Quantifiers and in go through a range without building the list of its
+// elements. Anywhere else the range becomes a list, which may have at most
+// maxRangeLength elements.
+type RangeExpression struct {
+	Token constants.Token
+	Start Expression
+	End   Expression
+}
+
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Lexeme }
+
+func (re *RangeExpression) Children() []Node { return []Node{re.Start, re.End} }
+
+func (re *RangeExpression) setChildren(children []Node) {
+	re.Start = children[0].(Expression)
+	re.End = children[1].(Expression)
+}
+
+func (re *RangeExpression) Evaluate(env *Env) (float64, error) { return evaluateNumber(re, env) }
+
+const maxRangeLength = 1_000_000
+
+func (re *RangeExpression) EvaluateValue(env *Env) (Value, error) {
+	start, end, err := re.bounds(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if end-start > maxRangeLength {
+		return nil, fmt.Errorf("range %d..%d has %d elements, more than the %d a list can have; only quantifiers and in take longer ranges", start, end, end-start, maxRangeLength)
+	}
+
+	list := ListValue{}
+	for i := start; i < end; i++ {
+		list = append(list, NumberValue(i))
+	}
+	return list, nil
+}
+
+// bounds evaluates the start and the end of the range.
+func (re *RangeExpression) bounds(env *Env) (int, int, error) {
+	startValue, err := env.evaluate(re.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	start, err := toInteger(startValue)
+	if err != nil {
+		return 0, 0, fmt.Errorf("range start: %s", err)
+	}
+
+	endValue, err := env.evaluate(re.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := toInteger(endValue)
+	if err != nil {
+		return 0, 0, fmt.Errorf("range end: %s", err)
+	}
+	return start, end, nil
+}
+
+// rangeContains reports whether a value is an element of the range start..end.
+func rangeContains(value Value, start, end int) bool {
+	n, ok := value.(NumberValue)
+	return ok && float64(n) == math.Trunc(float64(n)) && float64(n) >= float64(start) && float64(n) < float64(end)
+}
+
+func (re *RangeExpression) PartialEvaluate(env *Env) (string, error) {
+	start, err := re.Start.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	end, err := re.End.PartialEvaluate(env)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("(%s..%s)", start, end), nil
+}
+
+func (re *RangeExpression) String() string {
+	return fmt.Sprintf("(%s..%s)", re.Start.String(), re.End.String())
+}
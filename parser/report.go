@@ -0,0 +1,68 @@
+package parser
+
+// Report is the evaluation of a program: one result per evaluated assert, or
+// per row of its where table, in source order, and the number of results of
+// each status. BrokenAssumptions are the assumptions the values broke; they
+// are reported separately and do not fail the program.
+type Report struct {
+	Results           []Result
+	Summary           Summary
+	BrokenAssumptions []error
+}
+
+// Summary counts the results of a report by status. Warnings counts the
+// results of warn statements that failed or had an error; they are not
+// counted in Failed and Errors.
+type Summary struct {
+	Total    int
+	Passed   int
+	Failed   int
+	Errors   int
+	Skipped  int
+	Unknown  int
+	Warnings int
+}
+
+func newReport(results []Result) Report {
+	report := Report{Results: results}
+	for _, result := range results {
+		report.Summary.add(result)
+	}
+	return report
+}
+
+func (s *Summary) add(result Result) {
+	s.Total++
+	switch {
+	case result.Severity == SeverityWarn && (result.Status == StatusFail || result.Status == StatusError):
+		s.Warnings++
+	case result.Status == StatusPass:
+		s.Passed++
+	case result.Status == StatusFail:
+		s.Failed++
+	case result.Status == StatusError:
+		s.Errors++
+	case result.Status == StatusSkip:
+		s.Skipped++
+	case result.Status == StatusUnknown:
+		s.Unknown++
+	}
+}
+
+// Success reports whether no assert or require failed or had an error;
+// warnings, unknown and skipped asserts do not fail the program.
+func (r Report) Success() bool {
+	return r.Summary.Failed == 0 && r.Summary.Errors == 0
+}
+
+// Errors returns the errors of the results, in order. Skipped asserts have a
+// reason instead and are left out.
+func (r Report) Errors() []error {
+	var errs []error
+	for _, result := range r.Results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return errs
+}
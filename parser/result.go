@@ -0,0 +1,99 @@
+package parser
+
+import "time"
+
+// Status is the outcome of evaluating a single statement. An assert that was
+// evaluated and does not hold fails; one that could not be evaluated, e.g.
+// because of a type mismatch, has an error.
+type Status int
+
+const (
+	StatusPass Status = iota
+	StatusFail
+	StatusUnknown
+	StatusSkip
+	StatusError
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPass:
+		return "pass"
+	case StatusFail:
+		return "fail"
+	case StatusUnknown:
+		return "unknown"
+	case StatusSkip:
+		return "skip"
+	case StatusError:
+		return "error"
+	default:
+		return "invalid"
+	}
+}
+
+// Severity is how a failed statement affects the program.
+type Severity int
+
+const (
+	// SeverityAssert fails the program, this is the default.
+	SeverityAssert Severity = iota
+	// SeverityRequire fails the program and stops the evaluation of the
+	// statements after it.
+	SeverityRequire
+	// SeverityWarn is reported but does not fail the program.
+	SeverityWarn
+)
+
+// String returns the keyword of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityAssert:
+		return "assert"
+	case SeverityRequire:
+		return "require"
+	case SeverityWarn:
+		return "warn"
+	default:
+		return "invalid"
+	}
+}
+
+// Result is the evaluation of a single statement. Number is the one-based
+// position of the assert in the program, as used in messages. Name and Suite
+// are set for named asserts and asserts in a suite, and Case for the
+// evaluation of a scenario or a row of a where table, e.g. scenario "peak",
+// row 1: x = 3. Err is set for asserts that fail or have an error, and
+// Reason says why a skipped assert was skipped, e.g. skipped assert "pool":
+// prerequisite "db-up" failed; skips are not errors. Reads lists the variables
+// the evaluation read, in sorted order. Explanation is set for asserts that
+// fail or have an error when the program explains them.
+type Result struct {
+	Number      int
+	Name        string
+	Suite       string
+	Case        string
+	Source      string
+	Span        Span
+	Severity    Severity
+	Value       float64
+	Status      Status
+	Err         error
+	Reason      string
+	Duration    time.Duration
+	Reads       []string
+	Explanation *Explanation
+}
+
+// MissingPolicy decides what happens to an assert that reads a variable or
+// field that is not in the value map.
+type MissingPolicy int
+
+const (
+	// MissingFail gives the assert an error, this is the default.
+	MissingFail MissingPolicy = iota
+	// MissingSkip reports the assert as skipped.
+	MissingSkip
+	// MissingUnknown reports the assert as unknown.
+	MissingUnknown
+)
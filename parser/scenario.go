@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// Assignment sets a variable of a scenario, as in x = 3.
+type Assignment struct {
+	Token constants.Token
+	Name  string
+	Value Expression
+}
+
+// ScenarioBlock is an inline fixture like scenario "peak" { x = 3; y = -6 }.
+// EvaluateScenarios evaluates the program once per scenario, with the values
+// of the scenario instead of the value map. Like assumptions, scenarios are
+// collected into the Program while parsing and are not evaluated as
+// statements.
+type ScenarioBlock struct {
+	Token       constants.Token
+	Name        string
+	Assignments []Assignment
+
+	values map[string]Value
+}
+
+func (sb *ScenarioBlock) TokenLiteral() string { return sb.Token.Lexeme }
+
+// Children returns the values of the assignments. The values a scenario sets
+// are taken when it is declared, while parsing.
+func (sb *ScenarioBlock) Children() []Node {
+	children := make([]Node, len(sb.Assignments))
+	for i, assignment := range sb.Assignments {
+		children[i] = assignment.Value
+	}
+	return children
+}
+
+func (sb *ScenarioBlock) setChildren(children []Node) {
+	for i := range sb.Assignments {
+		sb.Assignments[i].Value = children[i].(Expression)
+	}
+}
+
+func (sb *ScenarioBlock) Evaluate(env *Env) (float64, error) { return 0, nil }
+
+func (sb *ScenarioBlock) PartialEvaluate(env *Env) (string, error) { return sb.String(), nil }
+
+func (sb *ScenarioBlock) String() string {
+	assignments := make([]string, len(sb.Assignments))
+	for i, assignment := range sb.Assignments {
+		assignments[i] = fmt.Sprintf("%s = %s", assignment.Name, assignment.Value.String())
+	}
+	return fmt.Sprintf("scenario %q { %s }", sb.Name, strings.Join(assignments, "; "))
+}
+
+// declare evaluates the assignments and adds the scenario to the program.
+func (sb *ScenarioBlock) declare(program *Program) error {
+	for _, scenario := range program.Scenarios {
+		if scenario.Name == sb.Name {
+			return fmt.Errorf("scenario %q is defined twice", sb.Name)
+		}
+	}
+
+	sb.values = make(map[string]Value, len(sb.Assignments))
+	for _, assignment := range sb.Assignments {
+		if _, ok := sb.values[assignment.Name]; ok {
+			return fmt.Errorf("scenario %q sets %s twice", sb.Name, assignment.Name)
+		}
+		if !isConstantExpression(assignment.Value) {
+			return fmt.Errorf("scenario %q: %s must be set to a constant, got %s", sb.Name, assignment.Name, assignment.Value.String())
+		}
+		value, err := assignment.Value.EvaluateValue(nil)
+		if err != nil {
+			return fmt.Errorf("scenario %q: %s: %s", sb.Name, assignment.Name, err)
+		}
+		sb.values[assignment.Name] = value
+	}
+
+	program.Scenarios = append(program.Scenarios, sb)
+	return nil
+}
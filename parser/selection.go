@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"parser/lexer"
+	"strings"
+)
+
+// Selection chooses the asserts that Evaluate and PartialEvaluate run. An
+// assert is selected when it matches every criterion that is set: one of
+// Names, one of Suites, and the tag expression Tags, like
+// smoke and not slow. The zero Selection selects every assert.
+type Selection struct {
+	Names  []string
+	Suites []string
+	Tags   string
+}
+
+func selectAll(*AssertStatement) bool { return true }
+
+// forEachAssert calls fn with every assert in statements and the tags of the
+// assert and of the blocks around it.
+func forEachAssert(statements []Statement, tags []string, fn func(*AssertStatement, []string)) {
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *AssertStatement:
+			fn(s, append(append([]string{}, tags...), s.Tags...))
+		case *WhenBlock:
+			forEachAssert(s.Statements, append(append([]string{}, tags...), s.Tags...), fn)
+		case *SuiteBlock:
+			forEachAssert(s.Statements, append(append([]string{}, tags...), s.Tags...), fn)
+		}
+	}
+}
+
+// Select restricts Evaluate and PartialEvaluate to the asserts chosen by the
+// selection. It returns an error for names and suites the program does not
+// have and for malformed tag expressions.
+func (p *Program) Select(selection Selection) error {
+	matchTags := func(map[string]bool) bool { return true }
+	if strings.TrimSpace(selection.Tags) != "" {
+		matcher, err := parseTagExpression(selection.Tags)
+		if err != nil {
+			return err
+		}
+		matchTags = matcher
+	}
+
+	names := map[string]bool{}
+	suites := map[string]bool{}
+	forEachAssert(p.Statements, nil, func(as *AssertStatement, _ []string) {
+		names[as.Name] = true
+		suites[as.Suite] = true
+	})
+
+	for _, name := range selection.Names {
+		if name == "" || !names[name] {
+			return fmt.Errorf("unknown assert %q", name)
+		}
+	}
+	for _, suite := range selection.Suites {
+		if suite == "" || !suites[suite] {
+			return fmt.Errorf("unknown suite %q", suite)
+		}
+	}
+
+	selected := map[*AssertStatement]bool{}
+	forEachAssert(p.Statements, nil, func(as *AssertStatement, tags []string) {
+		tagSet := make(map[string]bool, len(tags))
+		for _, tag := range tags {
+			tagSet[tag] = true
+		}
+
+		selected[as] = (len(selection.Names) == 0 || contains(selection.Names, as.Name)) &&
+			(len(selection.Suites) == 0 || contains(selection.Suites, as.Suite)) &&
+			matchTags(tagSet)
+	})
+
+	p.selected = selected
+	return nil
+}
+
+// isSelected reports whether an assert is selected. Every assert is selected
+// until Select is called.
+func (p *Program) isSelected(as *AssertStatement) bool {
+	return p.selected == nil || p.selected[as]
+}
+
+func contains(list []string, s string) bool {
+	for _, element := range list {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
+
+// tagParser parses tag expressions made of tag names, not, and, or and
+// parentheses, in increasing order of binding.
+type tagParser struct {
+	tokens []constants.Token
+	pos    int
+}
+
+func parseTagExpression(input string) (func(map[string]bool) bool, error) {
+	l := lexer.NewLexer(input)
+	tp := &tagParser{}
+	for {
+		tok := l.NewToken()
+		tp.tokens = append(tp.tokens, tok)
+		if tok.Type == constants.TOKEN_EOF {
+			break
+		}
+	}
+
+	matcher, err := tp.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("tag expression %q: %s", input, err)
+	}
+	if tok := tp.peek(); tok.Type != constants.TOKEN_EOF {
+		return nil, fmt.Errorf("tag expression %q: unexpected %s", input, tok.Lexeme)
+	}
+	return matcher, nil
+}
+
+func (tp *tagParser) peek() constants.Token { return tp.tokens[tp.pos] }
+
+func (tp *tagParser) next() constants.Token {
+	tok := tp.tokens[tp.pos]
+	if tok.Type != constants.TOKEN_EOF {
+		tp.pos++
+	}
+	return tok
+}
+
+func (tp *tagParser) parseOr() (func(map[string]bool) bool, error) {
+	left, err := tp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for tp.peek().Lexeme == "or" {
+		tp.next()
+		right, err := tp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(tags map[string]bool) bool { return l(tags) || right(tags) }
+	}
+	return left, nil
+}
+
+func (tp *tagParser) parseAnd() (func(map[string]bool) bool, error) {
+	left, err := tp.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for tp.peek().Lexeme == "and" {
+		tp.next()
+		right, err := tp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(tags map[string]bool) bool { return l(tags) && right(tags) }
+	}
+	return left, nil
+}
+
+func (tp *tagParser) parseNot() (func(map[string]bool) bool, error) {
+	tok := tp.next()
+	switch {
+	case tok.Lexeme == "not" || tok.Type == constants.TOKEN_NOT:
+		operand, err := tp.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(tags map[string]bool) bool { return !operand(tags) }, nil
+
+	case tok.Type == constants.TOKEN_LEFT_PAREN:
+		inner, err := tp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := tp.next(); closing.Type != constants.TOKEN_RIGHT_PAREN {
+			return nil, fmt.Errorf("expected ), got %q", closing.Lexeme)
+		}
+		return inner, nil
+
+	case tok.Type == constants.TOKEN_TAG || (tok.Type == constants.TOKEN_VARIABLE && tok.Lexeme != "and" && tok.Lexeme != "or"):
+		return func(tags map[string]bool) bool { return tags[tok.Lexeme] }, nil
+
+	case tok.Type == constants.TOKEN_EOF:
+		return nil, fmt.Errorf("expected a tag, got the end of the expression")
+
+	default:
+		return nil, fmt.Errorf("expected a tag, got %q", tok.Lexeme)
+	}
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"parser/constants"
+	"strings"
+)
+
+// Position is a place in the source of a program. Lines and columns start at
+// 1; File is empty for a program parsed from a string.
+type Position struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// Span is the part of the source a statement was parsed from. End is the
+// position just after its last character.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// sourceOf returns the text from the start token up to the current token, the
+// last one of a statement, and its span.
+func (p *Parser) sourceOf(start constants.Token) (string, Span) {
+	input := p.l.Input()
+	from, to := p.offset(start), p.offset(p.peekToken)
+	if p.peekToken.Type == constants.TOKEN_EOF {
+		to = len(input)
+	}
+	if from > to || to > len(input) {
+		return "", Span{}
+	}
+
+	source := strings.TrimSpace(input[from:to])
+	end := Position{File: start.File, Line: start.Line + strings.Count(source, "\n"), Column: start.Column + len(source)}
+	if i := strings.LastIndex(source, "\n"); i >= 0 {
+		end.Column = len(source) - i
+	}
+
+	return source, Span{Start: Position{File: start.File, Line: start.Line, Column: start.Column}, End: end}
+}
+
+// offset returns the byte offset of a token in the input of the parser.
+func (p *Parser) offset(tok constants.Token) int {
+	if p.lineStarts == nil {
+		p.lineStarts = []int{0}
+		for i, ch := range p.l.Input() {
+			if ch == '\n' {
+				p.lineStarts = append(p.lineStarts, i+1)
+			}
+		}
+	}
+	if tok.Line < 1 || tok.Line > len(p.lineStarts) {
+		return len(p.l.Input())
+	}
+	return p.lineStarts[tok.Line-1] + tok.Column - 1
+}
+
+// spanOf returns the span of an expression from the positions of its tokens.
+// The parentheses around a grouped expression are not part of its span.
+func spanOf(e Expression) Span {
+	switch expr := e.(type) {
+	case *InfixExpression:
+		return Span{Start: spanOf(expr.Left).Start, End: spanOf(expr.Right).End}
+	case *PrefixExpression:
+		return Span{Start: positionOf(expr.Token), End: spanOf(expr.Right).End}
+	case *ChainedComparison:
+		return Span{Start: spanOf(expr.Operands[0]).Start, End: spanOf(expr.Operands[len(expr.Operands)-1]).End}
+	case *Variable:
+		return tokenSpan(expr.Token)
+	case *NumberLiteral:
+		return tokenSpan(expr.Token)
+	default:
+		return Span{}
+	}
+}
+
+// tokenSpan returns the span of a token of a single line.
+func tokenSpan(tok constants.Token) Span {
+	start := positionOf(tok)
+	end := start
+	end.Column += len(tok.Lexeme)
+	return Span{Start: start, End: end}
+}
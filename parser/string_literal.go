@@ -0,0 +1,25 @@
+package parser
+
+import (
+	"parser/constants"
+	"strconv"
+)
+
+type StringLiteral struct {
+	Token constants.Token
+	Value string
+}
+
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Lexeme }
+
+func (sl *StringLiteral) Children() []Node { return nil }
+
+func (sl *StringLiteral) Evaluate(env *Env) (float64, error) { return evaluateNumber(sl, env) }
+
+func (sl *StringLiteral) EvaluateValue(env *Env) (Value, error) { return StringValue(sl.Value), nil }
+
+func (sl *StringLiteral) PartialEvaluate(env *Env) (string, error) {
+	return strconv.Quote(sl.Value), nil
+}
+
+func (sl *StringLiteral) String() string { return strconv.Quote(sl.Value) }
@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// SuiteBlock is for blocks like suite "database" { assert pool >= 10 }. A
+// suite groups asserts so that they can be selected together; it does not
+// change how they are evaluated.
+type SuiteBlock struct {
+	Token      constants.Token
+	Name       string
+	Tags       []string
+	Statements []Statement
+}
+
+func (sb *SuiteBlock) TokenLiteral() string { return sb.Token.Lexeme }
+
+func (sb *SuiteBlock) Children() []Node { return toNodes(sb.Statements) }
+
+func (sb *SuiteBlock) setChildren(children []Node) { sb.Statements = toStatements(children) }
+
+// Evaluate returns the result of the first nested statement that fails.
+func (sb *SuiteBlock) Evaluate(env *Env) (float64, error) {
+	for _, stmt := range sb.Statements {
+		if value, err := stmt.Evaluate(env); err != nil {
+			return value, err
+		}
+	}
+	return 0, nil
+}
+
+func (sb *SuiteBlock) PartialEvaluate(env *Env) (string, error) {
+	statements, err := partialStatements([]Statement{sb}, env, selectAll)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(statements, "\n"), nil
+}
+
+func (sb *SuiteBlock) header() string {
+	return fmt.Sprintf("%ssuite %q", formatTags(sb.Tags), sb.Name)
+}
+
+func (sb *SuiteBlock) String() string {
+	statements := make([]string, len(sb.Statements))
+	for i, stmt := range sb.Statements {
+		statements[i] = stmt.String()
+	}
+	return formatBlock(sb.header(), statements)
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeValue is a point in time, from a timestamp literal like
+// 2024-01-01T00:00:00Z, from now() or from the value map. Durations are time
+// quantities like 30d, so expires_at - now() > 30d compares two durations.
+type TimeValue struct {
+	Time time.Time
+}
+
+func (t TimeValue) Type() string { return "time" }
+
+func (t TimeValue) String() string { return t.Time.Format(time.RFC3339Nano) }
+
+// timeLayouts are the ISO-8601 forms accepted for timestamps.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02"}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse %q as an ISO-8601 timestamp", s)
+}
+
+// durationOf converts a time quantity into a time.Duration.
+func durationOf(v Value) (time.Duration, bool) {
+	quantity, ok := v.(QuantityValue)
+	if !ok || quantity.dimension() != "time" {
+		return 0, false
+	}
+	return time.Duration(quantity.in("s") * float64(time.Second)), true
+}
+
+// evaluateTimeInfix applies an operator where at least one side is a time.
+// A time minus a time is a duration, a time plus or minus a duration is a
+// time, and two times can be compared.
+func evaluateTimeInfix(operator string, leftValue, rightValue Value) (Value, error) {
+	left, leftIsTime := leftValue.(TimeValue)
+	right, rightIsTime := rightValue.(TimeValue)
+
+	if leftIsTime && rightIsTime {
+		switch operator {
+		case "-":
+			return QuantityValue{Amount: left.Time.Sub(right.Time).Seconds(), Unit: "s"}, nil
+		case "<":
+			return truth(left.Time.Before(right.Time)), nil
+		case "<=":
+			return truth(!left.Time.After(right.Time)), nil
+		case ">":
+			return truth(left.Time.After(right.Time)), nil
+		case ">=":
+			return truth(!left.Time.Before(right.Time)), nil
+		default:
+			return nil, fmt.Errorf("%s: cannot combine two times", operator)
+		}
+	}
+
+	if leftIsTime {
+		if duration, ok := durationOf(rightValue); ok {
+			switch operator {
+			case "+":
+				return TimeValue{Time: left.Time.Add(duration)}, nil
+			case "-":
+				return TimeValue{Time: left.Time.Add(-duration)}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: cannot combine time and %s", operator, rightValue.Type())
+	}
+
+	if duration, ok := durationOf(leftValue); ok && operator == "+" {
+		return TimeValue{Time: right.Time.Add(duration)}, nil
+	}
+	return nil, fmt.Errorf("%s: cannot combine %s and time", operator, leftValue.Type())
+}
+
+// nowOf implements now(), which reads the clock of the program.
+func nowOf(env *Env, args []Value) (Value, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("expected no arguments, got %d", len(args))
+	}
+	return TimeValue{Time: env.now()}, nil
+}
+
+// timeOf implements time(s), which parses a timestamp string such as one
+// from a JSON snapshot.
+func timeOf(env *Env, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	s, ok := args[0].(StringValue)
+	if !ok {
+		return nil, fmt.Errorf("expected string, got %s", args[0].Type())
+	}
+
+	t, err := parseTime(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return TimeValue{Time: t}, nil
+}
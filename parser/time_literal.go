@@ -0,0 +1,26 @@
+package parser
+
+import (
+	"parser/constants"
+	"time"
+)
+
+// TimeLiteral is for ISO-8601 timestamps like 2024-01-01T00:00:00Z.
+type TimeLiteral struct {
+	Token constants.Token
+	Value time.Time
+}
+
+func (tl *TimeLiteral) TokenLiteral() string { return tl.Token.Lexeme }
+
+func (tl *TimeLiteral) Children() []Node { return nil }
+
+func (tl *TimeLiteral) Evaluate(env *Env) (float64, error) { return evaluateNumber(tl, env) }
+
+func (tl *TimeLiteral) EvaluateValue(env *Env) (Value, error) { return TimeValue{Time: tl.Value}, nil }
+
+func (tl *TimeLiteral) PartialEvaluate(env *Env) (string, error) {
+	return TimeValue{Time: tl.Value}.String(), nil
+}
+
+func (tl *TimeLiteral) String() string { return tl.Token.Lexeme }
@@ -0,0 +1,281 @@
+package parser
+
+import "fmt"
+
+// typeChecker infers the types of expressions without evaluating them, using
+// the declared types of variables, so that asserts like mode > 5 are rejected
+// before evaluation. The type of an expression is "number", "string", "time",
+// "boolean", "list" or "object", or "" when the checker cannot tell.
+type typeChecker struct {
+	declarations map[string]*VarDeclaration
+	values       map[string]Value
+	bound        map[string]int
+}
+
+func (tc *typeChecker) typeOf(e Expression) (string, error) {
+	switch expr := e.(type) {
+	case *NumberLiteral, *QuantityLiteral:
+		return "number", nil
+
+	case *StringLiteral:
+		return "string", nil
+
+	case *TimeLiteral:
+		return "time", nil
+
+	case *Variable:
+		return tc.variableType(expr.Value)
+
+	case *PrefixExpression:
+		right, err := tc.typeOf(expr.Right)
+		if err != nil {
+			return "", err
+		}
+		if right == "boolean" && expr.Operator == "!" {
+			return "number", nil
+		}
+		if right != "" && right != "number" {
+			return "", fmt.Errorf("type mismatch in %s: %s expects a number, got %s", expr.String(), expr.Operator, right)
+		}
+		return "number", nil
+
+	case *InfixExpression:
+		left, err := tc.typeOf(expr.Left)
+		if err != nil {
+			return "", err
+		}
+		right, err := tc.typeOf(expr.Right)
+		if err != nil {
+			return "", err
+		}
+		if list, ok := expr.Right.(*ListLiteral); ok && expr.Operator == "in" && left != "" {
+			for _, element := range list.Elements {
+				if elementType, _ := tc.typeOf(element); elementType != "" && elementType != left {
+					return "", typeMismatch(expr, "in", left, elementType)
+				}
+			}
+		}
+		return combineTypes(expr, expr.Operator, left, right)
+
+	case *ChainedComparison:
+		types := make([]string, len(expr.Operands))
+		for i, operand := range expr.Operands {
+			operandType, err := tc.typeOf(operand)
+			if err != nil {
+				return "", err
+			}
+			types[i] = operandType
+		}
+		for i, operator := range expr.Operators {
+			if _, err := combineTypes(expr, operator, types[i], types[i+1]); err != nil {
+				return "", err
+			}
+		}
+		return "number", nil
+
+	case *ConditionalExpression:
+		condition, err := tc.typeOf(expr.Condition)
+		if err != nil {
+			return "", err
+		}
+		if condition != "" && condition != "number" && condition != "boolean" {
+			return "", fmt.Errorf("type mismatch in %s: condition must be a number or a boolean, got %s", expr.String(), condition)
+		}
+		consequence, err := tc.typeOf(expr.Consequence)
+		if err != nil {
+			return "", err
+		}
+		alternative, err := tc.typeOf(expr.Alternative)
+		if err != nil {
+			return "", err
+		}
+		if consequence != "" && alternative != "" && consequence != alternative {
+			return "", typeMismatch(expr, "branches", consequence, alternative)
+		}
+		if consequence != "" {
+			return consequence, nil
+		}
+		return alternative, nil
+
+	case *CallExpression:
+		if err := tc.checkAll(expr.Arguments...); err != nil {
+			return "", err
+		}
+		if expr.definition != nil {
+			return "", nil
+		}
+		switch expr.Function {
+		case "now", "time":
+			return "time", nil
+		case "sum", "avg", "min", "max", "count", "len", "percentile", "defined", "approx":
+			return "number", nil
+		default:
+			return "", nil
+		}
+
+	case *QuantifierExpression:
+		domain, err := tc.typeOf(expr.Domain)
+		if err != nil {
+			return "", err
+		}
+		if domain != "" && domain != "list" && domain != "object" {
+			return "", fmt.Errorf("type mismatch in %s: %s expects a list or an object, got %s", expr.String(), expr.Quantifier, domain)
+		}
+		tc.bound[expr.Variable]++
+		defer func() { tc.bound[expr.Variable]-- }()
+		if _, err := tc.typeOf(expr.Body); err != nil {
+			return "", err
+		}
+		return "number", nil
+
+	case *ListLiteral:
+		return "list", tc.checkAll(expr.Elements...)
+
+	case *RangeExpression:
+		return "list", tc.checkAll(expr.Start, expr.End)
+
+	case *IndexExpression:
+		return "", tc.checkAll(expr.Left, expr.Index)
+
+	case *MemberExpression:
+		return "", tc.checkAll(expr.Object)
+
+	default:
+		return "", nil
+	}
+}
+
+func (tc *typeChecker) checkAll(exprs ...Expression) error {
+	for _, e := range exprs {
+		if _, err := tc.typeOf(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variableType returns the declared type of a variable and, when the checker
+// has values, checks the value of the variable against its declaration.
+func (tc *typeChecker) variableType(name string) (string, error) {
+	if tc.bound[name] > 0 {
+		return "", nil
+	}
+
+	declaration, ok := tc.declarations[name]
+	if !ok {
+		if len(tc.declarations) > 0 {
+			return "", fmt.Errorf("undeclared variable %s", name)
+		}
+		return "", nil
+	}
+
+	if value, ok := tc.values[name]; ok {
+		if err := declaration.check(value); err != nil {
+			return "", err
+		}
+	}
+	return declaredTypes[declaration.Type], nil
+}
+
+// combineTypes returns the type of left operator right, where "" is a type
+// the checker cannot tell. A time minus a time is a number of seconds and a
+// time plus or minus a number is a time.
+func combineTypes(e Expression, operator string, left, right string) (string, error) {
+	switch operator {
+	case "+", "-", "*", "/":
+		for _, operand := range []string{left, right} {
+			if operand == "string" || operand == "boolean" || operand == "list" || operand == "object" {
+				return "", typeMismatch(e, operator, left, right)
+			}
+		}
+		switch {
+		case left == "" || right == "":
+			return "", nil
+		case left == "time" && right == "time" && operator == "-":
+			return "number", nil
+		case left == "time" && right == "number" && (operator == "+" || operator == "-"):
+			return "time", nil
+		case left == "number" && right == "time" && operator == "+":
+			return "time", nil
+		case left == "time" || right == "time":
+			return "", typeMismatch(e, operator, left, right)
+		}
+		return "number", nil
+	case "<", "<=", ">", ">=", "==", "!=":
+		if left != "" && right != "" && left != right {
+			return "", typeMismatch(e, operator, left, right)
+		}
+		if operator != "==" && operator != "!=" && (left == "boolean" || left == "list" || left == "object") {
+			return "", typeMismatch(e, operator, left, right)
+		}
+		return "number", nil
+	case "~=":
+		if (left != "" && left != "number") || (right != "" && right != "number") {
+			return "", typeMismatch(e, operator, left, right)
+		}
+		return "number", nil
+	case "in":
+		if right != "" && right != "list" && right != "object" {
+			return "", fmt.Errorf("type mismatch in %s: in expects a list or an object, got %s", e.String(), right)
+		}
+		return "number", nil
+	case "??":
+		if left != "" && right != "" && left != right {
+			return "", typeMismatch(e, operator, left, right)
+		}
+		if left != "" {
+			return left, nil
+		}
+		return right, nil
+	default:
+		return "", nil
+	}
+}
+
+func typeMismatch(e Expression, operator string, left, right string) error {
+	return fmt.Errorf("type mismatch in %s: %s cannot combine %s and %s", e.String(), operator, describeType(left), describeType(right))
+}
+
+// describeType names a type for error messages; "" is a value of unknown type.
+func describeType(typ string) string {
+	if typ == "" {
+		return "an unknown type"
+	}
+	return typ
+}
+
+// checkTypes checks the types of a single statement. With values, it also
+// checks the values of the declared variables the statement reads.
+func checkTypes(stmt Statement, declarations map[string]*VarDeclaration, values map[string]Value) error {
+	checker := &typeChecker{declarations: declarations, values: values, bound: map[string]int{}}
+
+	switch s := stmt.(type) {
+	case *AssertStatement:
+		if s.Where != nil {
+			for _, column := range s.Where.Columns {
+				checker.bound[column]++
+			}
+		}
+		_, err := checker.typeOf(s.Expression)
+		return err
+	case *WhenBlock:
+		if _, err := checker.typeOf(s.Guard); err != nil {
+			return err
+		}
+		for _, nested := range s.Statements {
+			if err := checkTypes(nested, declarations, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *SuiteBlock:
+		for _, nested := range s.Statements {
+			if err := checkTypes(nested, declarations, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+}
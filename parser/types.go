@@ -1,13 +1,19 @@
 package parser
 
-import "parser/constants"
+import (
+	"io"
+	"log/slog"
+	"parser/constants"
+	"time"
+)
 
 // AST Node Interface
 type (
 	Node interface {
 		TokenLiteral() string
-		Evaluate() (float64, error)
-		PartialEvaluate() (string, error)
+		Evaluate(env *Env) (float64, error)
+		PartialEvaluate(env *Env) (string, error)
+		Children() []Node
 	}
 
 	Statement interface {
@@ -18,6 +24,7 @@ type (
 	Expression interface {
 		Node
 		String() string
+		EvaluateValue(env *Env) (Value, error)
 	}
 )
 
@@ -25,18 +32,46 @@ type (
 type Parserer interface {
 	nextToken()
 	Errors() []string
+	SetASTOutput(io.Writer)
 	printAST(any)
 	ParseProgram() ProgramEvaluator
+	numberAsserts(*Program)
 	parseStatement() Statement
 	parseAssertStatement() *AssertStatement
+	parseAssumeStatement() *AssumeStatement
+	parseTaggedStatement() Statement
+	parseWhenBlock() Statement
+	parseSuiteBlock() Statement
+	parseScenarioBlock() Statement
+	parseDefinition() Statement
+	parseIncludeStatement() Statement
+	parseStatements(*Program)
+	parseLayout() []Statement
+	include(*IncludeStatement, *Program)
+	parseWhereTable() *WhereTable
+	parseBlockStatements(token constants.Token) ([]Statement, bool)
+	parsePragmaStatement() Statement
+	parseVarDeclaration() Statement
 	parseExpression(int) Expression
 	prefixParseFns(tokenType constants.TokenType) func() Expression
 	infixParseFns(tokenType constants.TokenType) func(Expression) Expression
 	parseVariable() Expression
 	parseNumberLiteral() Expression
+	parseQuantityLiteral() Expression
+	parseTimeLiteral() Expression
 	parsePrefixExpression() Expression
 	parseInfixExpression(left Expression) Expression
+	parseComparison(left Expression) Expression
 	parseGroupedExpression() Expression
+	parseStringLiteral() Expression
+	parseListLiteral() Expression
+	parseIndexExpression(left Expression) Expression
+	parseMemberExpression(left Expression) Expression
+	parseCallExpression(left Expression) Expression
+	parseRangeExpression(left Expression) Expression
+	parseQuantifierExpression() Expression
+	parseConditionalExpression() Expression
+	parseExpressionList(end constants.TokenType) []Expression
 	noPrefixParseFnError(t constants.TokenType)
 	expectPeek(t constants.TokenType) bool
 	peekTokenIs(t constants.TokenType) bool
@@ -48,12 +83,30 @@ type Parserer interface {
 // Program Evaluator Interface
 type ProgramEvaluator interface {
 	SetValueMap(map[string]float64)
-	Evaluate() ([]float64, []error, bool)
+	SetValues(map[string]any) error
+	SetMissingPolicy(MissingPolicy)
+	SetTolerance(absolute, relative float64)
+	SetUnits(map[string]string) error
+	SetClock(func() time.Time)
+	SetLogger(*slog.Logger)
+	SetExplain(bool)
+	CheckUnits() []error
+	AST() *Program
+	DOT(GraphOptions) string
+	Mermaid(GraphOptions) string
+	Check() []error
+	FreeVariables() []string
+	StatementVariables() [][]string
+	Validate() Validation
+	Select(Selection) error
+	Evaluate() Report
+	EvaluateScenarios() Report
 	PartialEvaluate() ([]string, []error, bool)
 }
 
 // AST PrintVisitor Interface
 type PrintVisitor interface {
 	VisitProgram(*Program, int)
+	VisitStatement(Statement, int)
 	VisitExpression(Expression, int)
 }
@@ -0,0 +1,254 @@
+package parser
+
+import "fmt"
+
+// unitChecker infers the dimension of expressions without evaluating them, so
+// that asserts like latency + memory are rejected before evaluation.
+type unitChecker struct {
+	annotations map[string]string
+	values      map[string]Value
+	bound       map[string]int
+}
+
+// dimension returns the dimension of an expression, "" for plain numbers.
+// known is false when the dimension depends on something the checker cannot
+// see, such as a missing variable or the element of a list.
+func (uc *unitChecker) dimension(e Expression) (dimension string, known bool, err error) {
+	switch expr := e.(type) {
+	case *NumberLiteral:
+		return "", true, nil
+
+	case *QuantityLiteral:
+		return units[expr.Unit].Dimension, true, nil
+
+	case *TimeLiteral:
+		return "instant", true, nil
+
+	case *Variable:
+		return uc.variableDimension(expr.Value)
+
+	case *PrefixExpression:
+		dimension, known, err := uc.dimension(expr.Right)
+		if err != nil || expr.Operator == "-" {
+			return dimension, known, err
+		}
+		return "", true, nil
+
+	case *InfixExpression:
+		left, leftKnown, err := uc.dimension(expr.Left)
+		if err != nil {
+			return "", false, err
+		}
+		right, rightKnown, err := uc.dimension(expr.Right)
+		if err != nil {
+			return "", false, err
+		}
+		if !leftKnown || !rightKnown {
+			return "", false, nil
+		}
+		return combineDimensions(expr, expr.Operator, left, right)
+
+	case *ChainedComparison:
+		dimensions := make([]string, len(expr.Operands))
+		knowns := make([]bool, len(expr.Operands))
+		for i, operand := range expr.Operands {
+			dimension, known, err := uc.dimension(operand)
+			if err != nil {
+				return "", false, err
+			}
+			dimensions[i], knowns[i] = dimension, known
+		}
+		for i, operator := range expr.Operators {
+			if knowns[i] && knowns[i+1] {
+				if _, _, err := combineDimensions(expr, operator, dimensions[i], dimensions[i+1]); err != nil {
+					return "", false, err
+				}
+			}
+		}
+		return "", true, nil
+
+	case *ConditionalExpression:
+		if _, _, err := uc.dimension(expr.Condition); err != nil {
+			return "", false, err
+		}
+		consequence, consequenceKnown, err := uc.dimension(expr.Consequence)
+		if err != nil {
+			return "", false, err
+		}
+		alternative, alternativeKnown, err := uc.dimension(expr.Alternative)
+		if err != nil {
+			return "", false, err
+		}
+		if !consequenceKnown || !alternativeKnown {
+			return "", false, nil
+		}
+		if consequence != alternative {
+			return "", false, unitMismatch(expr, "branches", consequence, alternative)
+		}
+		return consequence, true, nil
+
+	case *CallExpression:
+		dimensions := make([]string, len(expr.Arguments))
+		knowns := make([]bool, len(expr.Arguments))
+		for i, argument := range expr.Arguments {
+			dimension, known, err := uc.dimension(argument)
+			if err != nil {
+				return "", false, err
+			}
+			dimensions[i], knowns[i] = dimension, known
+		}
+		if expr.definition != nil {
+			return "", false, nil
+		}
+		switch expr.Function {
+		case "approx":
+			if len(expr.Arguments) >= 2 && knowns[0] && knowns[1] {
+				return combineDimensions(expr, "~=", dimensions[0], dimensions[1])
+			}
+		case "now", "time":
+			return "instant", true, nil
+		}
+		return "", false, nil
+
+	case *QuantifierExpression:
+		if _, _, err := uc.dimension(expr.Domain); err != nil {
+			return "", false, err
+		}
+		uc.bound[expr.Variable]++
+		defer func() { uc.bound[expr.Variable]-- }()
+		if _, _, err := uc.dimension(expr.Body); err != nil {
+			return "", false, err
+		}
+		return "", true, nil
+
+	case *ListLiteral:
+		return "", false, uc.checkAll(expr.Elements...)
+
+	case *IndexExpression:
+		return "", false, uc.checkAll(expr.Left, expr.Index)
+
+	case *MemberExpression:
+		return "", false, uc.checkAll(expr.Object)
+
+	case *RangeExpression:
+		return "", false, uc.checkAll(expr.Start, expr.End)
+
+	default:
+		return "", false, nil
+	}
+}
+
+func (uc *unitChecker) checkAll(exprs ...Expression) error {
+	for _, e := range exprs {
+		if _, _, err := uc.dimension(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (uc *unitChecker) variableDimension(name string) (string, bool, error) {
+	if uc.bound[name] > 0 {
+		return "", false, nil
+	}
+
+	if unitName, ok := uc.annotations[name]; ok {
+		return units[unitName].Dimension, true, nil
+	}
+
+	switch value := uc.values[name].(type) {
+	case NumberValue:
+		return "", true, nil
+	case QuantityValue:
+		return value.dimension(), true, nil
+	case TimeValue:
+		return "instant", true, nil
+	default:
+		return "", false, nil
+	}
+}
+
+// combineDimensions returns the dimension of left operator right. Points in
+// time have the dimension instant: an instant minus an instant is a time and
+// an instant plus or minus a time is an instant.
+func combineDimensions(e Expression, operator string, left, right string) (string, bool, error) {
+	switch {
+	case operator == "-" && left == "instant" && right == "instant":
+		return "time", true, nil
+	case (operator == "+" || operator == "-") && left == "instant" && right == "time":
+		return "instant", true, nil
+	case operator == "+" && left == "time" && right == "instant":
+		return "instant", true, nil
+	case (operator == "*" || operator == "/" || operator == "+") && (left == "instant" && right == "instant"),
+		(operator == "*" || operator == "/") && (left == "instant" || right == "instant"):
+		return "", false, unitMismatch(e, operator, left, right)
+	}
+
+	switch operator {
+	case "+", "-", "??":
+		if left != right {
+			return "", false, unitMismatch(e, operator, left, right)
+		}
+		return left, true, nil
+	case "<", "<=", ">", ">=", "==", "!=", "~=":
+		if left != right {
+			return "", false, unitMismatch(e, operator, left, right)
+		}
+		return "", true, nil
+	case "*":
+		if left != "" && right != "" {
+			return "", false, unitMismatch(e, operator, left, right)
+		}
+		if left != "" {
+			return left, true, nil
+		}
+		return right, true, nil
+	case "in":
+		return "", true, nil
+	case "/":
+		if left == right {
+			return "", true, nil
+		}
+		if right == "" {
+			return left, true, nil
+		}
+		return "", false, unitMismatch(e, operator, left, right)
+	default:
+		return "", false, nil
+	}
+}
+
+func unitMismatch(e Expression, operator string, left, right string) error {
+	return fmt.Errorf("unit mismatch in %s: %s cannot combine %s and %s", e.String(), operator, describeDimension(left), describeDimension(right))
+}
+
+// checkUnits checks the dimensions of a single statement, reading the
+// dimensions of unannotated variables from values.
+func checkUnits(stmt Statement, annotations map[string]string, values map[string]Value) error {
+	checker := &unitChecker{annotations: annotations, values: values, bound: map[string]int{}}
+
+	switch s := stmt.(type) {
+	case *AssertStatement:
+		_, _, err := checker.dimension(s.Expression)
+		return err
+	case *WhenBlock:
+		if _, _, err := checker.dimension(s.Guard); err != nil {
+			return err
+		}
+		for _, nested := range s.Statements {
+			if err := checkUnits(nested, annotations, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *SuiteBlock:
+		for _, nested := range s.Statements {
+			if err := checkUnits(nested, annotations, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+}
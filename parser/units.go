@@ -0,0 +1,188 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unit is a unit of measure. Factor converts an amount in the unit into the
+// base unit of its dimension, e.g. seconds for time and bytes for data.
+type unit struct {
+	Dimension string
+	Factor    float64
+}
+
+var units = map[string]unit{
+	"ns":  {Dimension: "time", Factor: 1e-9},
+	"us":  {Dimension: "time", Factor: 1e-6},
+	"ms":  {Dimension: "time", Factor: 1e-3},
+	"s":   {Dimension: "time", Factor: 1},
+	"min": {Dimension: "time", Factor: 60},
+	"h":   {Dimension: "time", Factor: 3600},
+	"d":   {Dimension: "time", Factor: 86400},
+
+	"B":   {Dimension: "data", Factor: 1},
+	"KB":  {Dimension: "data", Factor: 1e3},
+	"MB":  {Dimension: "data", Factor: 1e6},
+	"GB":  {Dimension: "data", Factor: 1e9},
+	"TB":  {Dimension: "data", Factor: 1e12},
+	"KiB": {Dimension: "data", Factor: 1 << 10},
+	"MiB": {Dimension: "data", Factor: 1 << 20},
+	"GiB": {Dimension: "data", Factor: 1 << 30},
+	"TiB": {Dimension: "data", Factor: 1 << 40},
+}
+
+// QuantityValue is a number with a unit, like 200ms or 1.5GiB.
+type QuantityValue struct {
+	Amount float64
+	Unit   string
+}
+
+// NewQuantity returns a quantity for use in a value map.
+func NewQuantity(amount float64, unitName string) (Value, error) {
+	if _, ok := units[unitName]; !ok {
+		return nil, unknownUnitError(unitName)
+	}
+	return QuantityValue{Amount: amount, Unit: unitName}, nil
+}
+
+func (q QuantityValue) Type() string { return "quantity" }
+
+func (q QuantityValue) String() string { return formatNumber(q.Amount) + q.Unit }
+
+func (q QuantityValue) dimension() string { return units[q.Unit].Dimension }
+
+// in converts the quantity into another unit of the same dimension.
+func (q QuantityValue) in(unitName string) float64 {
+	return q.Amount * units[q.Unit].Factor / units[unitName].Factor
+}
+
+func unknownUnitError(unitName string) error {
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown unit %q (known units: %s)", unitName, strings.Join(names, ", "))
+}
+
+// describeDimension names a dimension for error messages; "" is a plain number.
+func describeDimension(dimension string) string {
+	if dimension == "" {
+		return "a plain number"
+	}
+	return dimension
+}
+
+// evaluateQuantityInfix applies an operator where at least one side is a
+// quantity. Quantities of the same dimension are converted into the unit of
+// the left side.
+func evaluateQuantityInfix(env *Env, operator string, leftValue, rightValue Value) (Value, error) {
+	left, leftIsQuantity := leftValue.(QuantityValue)
+	right, rightIsQuantity := rightValue.(QuantityValue)
+
+	if leftIsQuantity && rightIsQuantity {
+		if left.dimension() != right.dimension() {
+			return nil, fmt.Errorf("%s: cannot combine %s (%s) and %s (%s)", operator, left.dimension(), left.Unit, right.dimension(), right.Unit)
+		}
+
+		r := right.in(left.Unit)
+		switch operator {
+		case "+":
+			return QuantityValue{Amount: left.Amount + r, Unit: left.Unit}, nil
+		case "-":
+			return QuantityValue{Amount: left.Amount - r, Unit: left.Unit}, nil
+		case "/":
+			if r == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return NumberValue(left.Amount / r), nil
+		case "*":
+			return nil, fmt.Errorf("*: cannot multiply %s by %s", left.dimension(), right.dimension())
+		default:
+			return evaluateInfix(env, operator, NumberValue(left.Amount), NumberValue(r))
+		}
+	}
+
+	switch {
+	case leftIsQuantity && operator == "*":
+		number, err := toNumber(rightValue)
+		if err != nil {
+			return nil, fmt.Errorf("*: %s", err)
+		}
+		return QuantityValue{Amount: left.Amount * number, Unit: left.Unit}, nil
+	case leftIsQuantity && operator == "/":
+		number, err := toNumber(rightValue)
+		if err != nil {
+			return nil, fmt.Errorf("/: %s", err)
+		}
+		if number == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return QuantityValue{Amount: left.Amount / number, Unit: left.Unit}, nil
+	case rightIsQuantity && operator == "*":
+		number, err := toNumber(leftValue)
+		if err != nil {
+			return nil, fmt.Errorf("*: %s", err)
+		}
+		return QuantityValue{Amount: number * right.Amount, Unit: right.Unit}, nil
+	}
+
+	leftDimension, rightDimension := "", ""
+	if leftIsQuantity {
+		leftDimension = left.dimension()
+	}
+	if rightIsQuantity {
+		rightDimension = right.dimension()
+	}
+	return nil, fmt.Errorf("%s: cannot combine %s and %s", operator, describeDimension(leftDimension), describeDimension(rightDimension))
+}
+
+// withUnits returns a copy of the value map where the numbers of annotated
+// variables, and lists of them, are quantities in the annotated unit.
+func withUnits(values map[string]Value, annotations map[string]string) (map[string]Value, error) {
+	if len(annotations) == 0 {
+		return values, nil
+	}
+
+	annotated := make(map[string]Value, len(values))
+	for name, value := range values {
+		unitName, ok := annotations[name]
+		if !ok {
+			annotated[name] = value
+			continue
+		}
+
+		converted, err := attachUnit(value, unitName)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %s", name, err)
+		}
+		annotated[name] = converted
+	}
+	return annotated, nil
+}
+
+func attachUnit(value Value, unitName string) (Value, error) {
+	switch v := value.(type) {
+	case NumberValue:
+		return QuantityValue{Amount: float64(v), Unit: unitName}, nil
+	case QuantityValue:
+		if v.dimension() != units[unitName].Dimension {
+			return nil, fmt.Errorf("value %s is not in %s", v.String(), unitName)
+		}
+		return v, nil
+	case ListValue:
+		list := make(ListValue, len(v))
+		for i, element := range v {
+			converted, err := attachUnit(element, unitName)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("cannot attach unit %s to %s", unitName, value.Type())
+	}
+}
@@ -1,7 +1,8 @@
 package parser
 
 import (
-	"fmt"
+	"parser/constants"
+	"parser/lexer"
 	"strconv"
 )
 
@@ -14,8 +15,45 @@ func IsConstant(token string) (float64, error) {
 	return floatValue, nil
 }
 
-func printIndent(indent int) {
-	for i := 0; i < indent; i++ {
-		fmt.Print("    ")
+// constantValue reports whether a partially evaluated expression is a
+// constant, such as 6.00, "eu" or [1.00, 2.00], and returns its value.
+func constantValue(partial string) (Value, bool) {
+	if floatValue, err := IsConstant(partial); err == nil {
+		return NumberValue(floatValue), true
+	}
+
+	p := &Parser{l: lexer.NewLexer(partial), errors: []string{}, modules: newModules(nil)}
+	p.nextToken()
+	p.nextToken()
+
+	expr := p.parseExpression(LOWEST)
+	if expr == nil || len(p.errors) != 0 || !p.peekTokenIs(constants.TOKEN_EOF) || !isConstantExpression(expr) {
+		return nil, false
+	}
+
+	value, err := expr.EvaluateValue(nil)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// isConstantExpression reports whether an expression can be evaluated
+// without a value map.
+func isConstantExpression(e Expression) bool {
+	switch expr := e.(type) {
+	case *NumberLiteral, *QuantityLiteral, *TimeLiteral, *StringLiteral:
+		return true
+	case *ListLiteral:
+		for _, element := range expr.Elements {
+			if !isConstantExpression(element) {
+				return false
+			}
+		}
+		return true
+	case *PrefixExpression:
+		return isConstantExpression(expr.Right)
+	default:
+		return false
 	}
 }
@@ -0,0 +1,259 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value is the result of evaluating an expression. Numbers remain the common
+// case; strings and lists come from literals and from the value map, objects
+// and booleans only from the value map.
+type Value interface {
+	Type() string
+	String() string
+}
+
+type NumberValue float64
+
+func (n NumberValue) Type() string { return "number" }
+
+func (n NumberValue) String() string { return formatNumber(float64(n)) }
+
+// formatNumber prints a number with as many digits as it takes to read the
+// same number back, so that folded residuals mean what the program means.
+// Unlike %g it never uses an exponent, which the lexer does not read.
+func formatNumber(n float64) string { return strconv.FormatFloat(n, 'f', -1, 64) }
+
+type StringValue string
+
+func (s StringValue) Type() string { return "string" }
+
+func (s StringValue) String() string { return strconv.Quote(string(s)) }
+
+// BoolValue is a boolean from the value map, such as a JSON true. It holds as
+// a condition when it is true; comparisons still produce numbers in the assert
+// convention.
+type BoolValue bool
+
+func (b BoolValue) Type() string { return "boolean" }
+
+func (b BoolValue) String() string { return strconv.FormatBool(bool(b)) }
+
+type ListValue []Value
+
+func (l ListValue) Type() string { return "list" }
+
+func (l ListValue) String() string {
+	elements := make([]string, len(l))
+	for i, element := range l {
+		elements[i] = element.String()
+	}
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
+
+type ObjectValue map[string]Value
+
+func (o ObjectValue) Type() string { return "object" }
+
+func (o ObjectValue) String() string {
+	fields := make([]string, 0, len(o))
+	for _, key := range o.Keys() {
+		fields = append(fields, fmt.Sprintf("%s: %s", strconv.Quote(key), o[key].String()))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(fields, ", "))
+}
+
+// Keys returns the keys of the object in sorted order, so that iteration over
+// an object is deterministic.
+func (o ObjectValue) Keys() []string {
+	keys := make([]string, 0, len(o))
+	for key := range o {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ToValue converts a Go value, as found in decoded JSON, into a Value.
+func ToValue(v any) (Value, error) {
+	switch value := v.(type) {
+	case Value:
+		return value, nil
+	case float64:
+		return NumberValue(value), nil
+	case float32:
+		return NumberValue(value), nil
+	case int:
+		return NumberValue(value), nil
+	case int64:
+		return NumberValue(value), nil
+	case string:
+		return StringValue(value), nil
+	case bool:
+		return BoolValue(value), nil
+	case time.Time:
+		return TimeValue{Time: value}, nil
+	case time.Duration:
+		return QuantityValue{Amount: value.Seconds(), Unit: "s"}, nil
+	case []float64:
+		list := make(ListValue, len(value))
+		for i, element := range value {
+			list[i] = NumberValue(element)
+		}
+		return list, nil
+	case []string:
+		list := make(ListValue, len(value))
+		for i, element := range value {
+			list[i] = StringValue(element)
+		}
+		return list, nil
+	case []any:
+		list := make(ListValue, len(value))
+		for i, element := range value {
+			converted, err := ToValue(element)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	case map[string]any:
+		object := make(ObjectValue, len(value))
+		for key, element := range value {
+			if element == nil {
+				continue
+			}
+			converted, err := ToValue(element)
+			if err != nil {
+				return nil, err
+			}
+			object[key] = converted
+		}
+		return object, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type: %T", v)
+	}
+}
+
+// MissingValueError is returned when an expression reads a variable or an
+// object field that is not in the value map.
+type MissingValueError struct {
+	Name    string
+	Message string
+}
+
+func (e *MissingValueError) Error() string { return e.Message }
+
+// isMissing reports whether err was caused by a missing variable or field.
+func isMissing(err error) bool {
+	var missing *MissingValueError
+	return errors.As(err, &missing)
+}
+
+// truth converts a boolean into the assert convention where 0 means true.
+func truth(b bool) Value {
+	if b {
+		return NumberValue(0)
+	}
+	return NumberValue(1)
+}
+
+// isTrue reports whether a condition holds, following the assert convention
+// where 0 is true and any other number is false. A boolean holds when it is
+// true.
+func isTrue(v Value) (bool, error) {
+	if b, ok := v.(BoolValue); ok {
+		return bool(b), nil
+	}
+
+	number, err := toNumber(v)
+	if err != nil {
+		return false, fmt.Errorf("condition: %s", err)
+	}
+	return number == 0, nil
+}
+
+func toNumber(v Value) (float64, error) {
+	number, ok := v.(NumberValue)
+	if !ok {
+		return 0, fmt.Errorf("expected number, got %s", v.Type())
+	}
+	return float64(number), nil
+}
+
+func toInteger(v Value) (int, error) {
+	number, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	if number != math.Trunc(number) {
+		return 0, fmt.Errorf("expected an integer, got %v", number)
+	}
+	return int(number), nil
+}
+
+func toList(v Value) (ListValue, error) {
+	list, ok := v.(ListValue)
+	if !ok {
+		return nil, fmt.Errorf("expected list, got %s", v.Type())
+	}
+	return list, nil
+}
+
+func valuesEqual(a, b Value) bool {
+	switch left := a.(type) {
+	case ListValue:
+		right, ok := b.(ListValue)
+		if !ok || len(left) != len(right) {
+			return false
+		}
+		for i := range left {
+			if !valuesEqual(left[i], right[i]) {
+				return false
+			}
+		}
+		return true
+	case ObjectValue:
+		right, ok := b.(ObjectValue)
+		if !ok || len(left) != len(right) {
+			return false
+		}
+		for key, value := range left {
+			other, ok := right[key]
+			if !ok || !valuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case QuantityValue:
+		right, ok := b.(QuantityValue)
+		if !ok || left.dimension() != right.dimension() {
+			return false
+		}
+		return left.Amount == right.in(left.Unit)
+	case TimeValue:
+		right, ok := b.(TimeValue)
+		return ok && left.Time.Equal(right.Time)
+	default:
+		return a == b
+	}
+}
+
+// evaluateNumber evaluates an expression that must produce a number. A
+// boolean is converted into the assert convention, so assert enabled holds
+// when enabled is true.
+func evaluateNumber(e Expression, env *Env) (float64, error) {
+	value, err := env.evaluate(e)
+	if err != nil {
+		return -1, err
+	}
+	if b, ok := value.(BoolValue); ok {
+		value = truth(bool(b))
+	}
+	return toNumber(value)
+}
@@ -0,0 +1,237 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"sort"
+	"strings"
+)
+
+// declaredTypes maps the types a variable can be declared with to the types
+// used by the type checker. A duration is a quantity with a unit of time.
+var declaredTypes = map[string]string{
+	"boolean":  "boolean",
+	"duration": "number",
+	"float":    "number",
+	"int":      "number",
+	"list":     "list",
+	"object":   "object",
+	"string":   "string",
+	"time":     "time",
+}
+
+// VarDeclaration declares the type of a variable of the value map and
+// optionally its domain, e.g. var cpu: float in [0, 100] or
+// var mode: string in {"a", "b"}. Like pragmas, declarations are applied to
+// the Program while parsing and are not evaluated as statements.
+type VarDeclaration struct {
+	Token    constants.Token
+	Name     string
+	Type     string
+	Interval []Expression
+	Members  []Expression
+
+	low, high Value
+	members   []Value
+}
+
+func (vd *VarDeclaration) TokenLiteral() string { return vd.Token.Lexeme }
+
+// Children returns the bounds of the interval followed by the members of the
+// domain. Like the values of scenarios, they are taken when the variable is
+// declared, while parsing.
+func (vd *VarDeclaration) Children() []Node {
+	return append(toNodes(vd.Interval), toNodes(vd.Members)...)
+}
+
+func (vd *VarDeclaration) setChildren(children []Node) {
+	vd.Interval = toExpressions(children[:len(vd.Interval)])
+	vd.Members = toExpressions(children[len(vd.Interval):])
+}
+
+func (vd *VarDeclaration) Evaluate(env *Env) (float64, error) { return 0, nil }
+
+func (vd *VarDeclaration) PartialEvaluate(env *Env) (string, error) { return vd.String(), nil }
+
+func (vd *VarDeclaration) String() string {
+	switch {
+	case vd.Interval != nil:
+		return fmt.Sprintf("var %s: %s in [%s]", vd.Name, vd.Type, joinExpressions(vd.Interval))
+	case vd.Members != nil:
+		return fmt.Sprintf("var %s: %s in {%s}", vd.Name, vd.Type, joinExpressions(vd.Members))
+	default:
+		return fmt.Sprintf("var %s: %s", vd.Name, vd.Type)
+	}
+}
+
+func joinExpressions(exprs []Expression) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = e.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// declare evaluates the domain and adds the declaration to the program.
+func (vd *VarDeclaration) declare(program *Program) error {
+	if _, ok := declaredTypes[vd.Type]; !ok {
+		return fmt.Errorf("unknown type %q for variable %s (known types: %s)", vd.Type, vd.Name, strings.Join(knownTypes(), ", "))
+	}
+	if _, ok := program.Declarations[vd.Name]; ok {
+		return fmt.Errorf("variable %s is declared twice", vd.Name)
+	}
+
+	bounds, err := vd.domainValues(vd.Interval)
+	if err != nil {
+		return err
+	}
+	if bounds != nil {
+		vd.low, vd.high = bounds[0], bounds[1]
+		above, err := evaluateInfix(nil, ">", vd.low, vd.high)
+		if err != nil {
+			return fmt.Errorf("domain of %s: %s", vd.Name, err)
+		}
+		if holds, _ := isTrue(above); holds {
+			return fmt.Errorf("domain of %s: %s is greater than %s", vd.Name, vd.low.String(), vd.high.String())
+		}
+	}
+
+	vd.members, err = vd.domainValues(vd.Members)
+	if err != nil {
+		return err
+	}
+
+	if program.Declarations == nil {
+		program.Declarations = map[string]*VarDeclaration{}
+	}
+	program.Declarations[vd.Name] = vd
+	return nil
+}
+
+// domainValues evaluates the bounds or members of the domain, which must be
+// constants of the declared type.
+func (vd *VarDeclaration) domainValues(exprs []Expression) ([]Value, error) {
+	if exprs == nil {
+		return nil, nil
+	}
+
+	values := make([]Value, len(exprs))
+	for i, e := range exprs {
+		if !isConstantExpression(e) {
+			return nil, fmt.Errorf("domain of %s must be constant, got %s", vd.Name, e.String())
+		}
+		value, err := e.EvaluateValue(nil)
+		if err != nil {
+			return nil, fmt.Errorf("domain of %s: %s", vd.Name, err)
+		}
+		if err := vd.checkType(value); err != nil {
+			return nil, fmt.Errorf("domain of %s: %s", vd.Name, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// check reports whether a value of the value map has the declared type and
+// lies in the declared domain.
+func (vd *VarDeclaration) check(value Value) error {
+	if err := vd.checkType(value); err != nil {
+		return fmt.Errorf("variable %s: %s", vd.Name, err)
+	}
+
+	if vd.low != nil {
+		for _, bound := range [][2]Value{{vd.low, value}, {value, vd.high}} {
+			below, err := evaluateInfix(nil, "<=", bound[0], bound[1])
+			if err != nil {
+				return fmt.Errorf("variable %s: %s", vd.Name, err)
+			}
+			if holds, _ := isTrue(below); !holds {
+				return fmt.Errorf("variable %s: %s is not in [%s, %s]", vd.Name, value.String(), vd.low.String(), vd.high.String())
+			}
+		}
+	}
+
+	if vd.members != nil {
+		for _, member := range vd.members {
+			if valuesEqual(value, member) {
+				return nil
+			}
+		}
+		members := make([]string, len(vd.members))
+		for i, member := range vd.members {
+			members[i] = member.String()
+		}
+		return fmt.Errorf("variable %s: %s is not one of {%s}", vd.Name, value.String(), strings.Join(members, ", "))
+	}
+
+	return nil
+}
+
+func (vd *VarDeclaration) checkType(value Value) error {
+	switch vd.Type {
+	case "float":
+		switch value.(type) {
+		case NumberValue, QuantityValue:
+			return nil
+		}
+	case "int":
+		switch v := value.(type) {
+		case NumberValue:
+			if _, err := toInteger(v); err != nil {
+				return err
+			}
+			return nil
+		case QuantityValue:
+			if _, err := toInteger(NumberValue(v.Amount)); err != nil {
+				return err
+			}
+			return nil
+		}
+	case "string":
+		if _, ok := value.(StringValue); ok {
+			return nil
+		}
+	case "time":
+		if _, ok := value.(TimeValue); ok {
+			return nil
+		}
+	case "duration":
+		if q, ok := value.(QuantityValue); ok {
+			if q.dimension() == "time" {
+				return nil
+			}
+			return fmt.Errorf("expected duration, got %s (%s)", q.dimension(), q.Unit)
+		}
+	case "boolean":
+		if _, ok := value.(BoolValue); ok {
+			return nil
+		}
+	case "list":
+		if _, ok := value.(ListValue); ok {
+			return nil
+		}
+	case "object":
+		if _, ok := value.(ObjectValue); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected %s, got %s", vd.Type, value.Type())
+}
+
+func knownTypes() []string {
+	types := make([]string, 0, len(declaredTypes))
+	for typ := range declaredTypes {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func declaredNames(declarations map[string]*VarDeclaration) []string {
+	names := make([]string, 0, len(declarations))
+	for name := range declarations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
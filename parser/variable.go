@@ -12,16 +12,23 @@ type Variable struct {
 
 func (v *Variable) TokenLiteral() string { return v.Token.Lexeme }
 
-func (v *Variable) Evaluate() (float64, error) {
-	value, ok := ValueMap[v.Value]
+func (v *Variable) Children() []Node { return nil }
+
+func (v *Variable) Evaluate(env *Env) (float64, error) { return evaluateNumber(v, env) }
+
+func (v *Variable) EvaluateValue(env *Env) (Value, error) {
+	value, ok := env.lookup(v.Value)
 	if ok {
 		return value, nil
 	} else {
-		return 0, fmt.Errorf("unknown variable: %s", v.Value)
+		return nil, &MissingValueError{Name: v.Value, Message: fmt.Sprintf("unknown variable: %s", v.Value)}
 	}
 }
 
-func (v *Variable) PartialEvaluate() (string, error) {
+func (v *Variable) PartialEvaluate(env *Env) (string, error) {
+	if residual, ok := env.residual(v.Value); ok {
+		return residual, nil
+	}
 	return v.Value, nil
 }
 
@@ -0,0 +1,260 @@
+package parser
+
+import "fmt"
+
+// Walk calls fn for node and, when fn returns true, walks the children of the
+// node in source order. Every node lists its children, so Walk reaches every
+// statement and expression of a tree.
+func Walk(node Node, fn func(Node) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+	for _, child := range node.Children() {
+		Walk(child, fn)
+	}
+}
+
+// Rewrite rewrites the children of node, replaces them in node and returns
+// fn of node, so fn sees children that are already rewritten. The tree is
+// changed in place. fn returns the node itself to keep it and must return an
+// expression for an expression; it may return nil for a statement in a block
+// to remove it. Anything else is an error, and the tree is left partly
+// rewritten.
+func Rewrite(node Node, fn func(Node) Node) (Node, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	children := node.Children()
+	if len(children) > 0 {
+		p, ok := node.(parent)
+		if !ok {
+			return nil, fmt.Errorf("cannot rewrite the children of %T", node)
+		}
+		for i, child := range children {
+			rewritten, err := Rewrite(child, fn)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkReplacement(child, rewritten); err != nil {
+				return nil, err
+			}
+			children[i] = rewritten
+		}
+		p.setChildren(children)
+	}
+	return fn(node), nil
+}
+
+// parent is implemented by the nodes of this package that have children, so
+// that Rewrite and cloneExpression can replace them.
+type parent interface {
+	Node
+	setChildren([]Node)
+}
+
+// checkReplacement reports an error when a rewritten node cannot take the
+// place of the node it replaces: an expression must be replaced by an
+// expression, a statement by a statement or by nil.
+func checkReplacement(node, rewritten Node) error {
+	_, isExpression := rewritten.(Expression)
+	switch n := node.(type) {
+	case Expression:
+		if !isExpression {
+			return fmt.Errorf("cannot replace expression %s with %s", n.String(), describeNode(rewritten))
+		}
+	case Statement:
+		if _, ok := rewritten.(Statement); isExpression || (!ok && rewritten != nil) {
+			return fmt.Errorf("cannot replace statement %s with %s", n.String(), describeNode(rewritten))
+		}
+	}
+	return nil
+}
+
+func describeNode(node Node) string {
+	switch n := node.(type) {
+	case nil:
+		return "nil"
+	case Expression:
+		return "expression " + n.String()
+	case Statement:
+		return "statement " + n.String()
+	default:
+		return fmt.Sprintf("%T", node)
+	}
+}
+
+// cloneExpression returns a deep copy of an expression. Calls of a def keep
+// pointing at the same def.
+func cloneExpression(e Expression) Expression {
+	var copied Expression
+	switch expr := e.(type) {
+	case *PrefixExpression:
+		copied = shallowCopy(expr)
+	case *InfixExpression:
+		copied = shallowCopy(expr)
+	case *ChainedComparison:
+		copied = shallowCopy(expr)
+	case *ConditionalExpression:
+		copied = shallowCopy(expr)
+	case *CallExpression:
+		copied = shallowCopy(expr)
+	case *QuantifierExpression:
+		copied = shallowCopy(expr)
+	case *ListLiteral:
+		copied = shallowCopy(expr)
+	case *IndexExpression:
+		copied = shallowCopy(expr)
+	case *MemberExpression:
+		copied = shallowCopy(expr)
+	case *RangeExpression:
+		copied = shallowCopy(expr)
+	case *Variable:
+		copied = shallowCopy(expr)
+	case *NumberLiteral:
+		copied = shallowCopy(expr)
+	case *QuantityLiteral:
+		copied = shallowCopy(expr)
+	case *StringLiteral:
+		copied = shallowCopy(expr)
+	case *TimeLiteral:
+		copied = shallowCopy(expr)
+	default:
+		panic(fmt.Sprintf("cannot copy %T", e))
+	}
+
+	children := copied.Children()
+	if len(children) > 0 {
+		for i, child := range children {
+			children[i] = cloneExpression(child.(Expression))
+		}
+		copied.(parent).setChildren(children)
+	}
+	return copied
+}
+
+func shallowCopy[T any](node *T) *T {
+	copied := *node
+	return &copied
+}
+
+// AST returns the program, for callers that hold it as a ProgramEvaluator.
+func (p *Program) AST() *Program {
+	return p
+}
+
+// Walk walks the statements of the program, then its assumptions, scenarios
+// and variable declarations.
+func (p *Program) Walk(fn func(Node) bool) {
+	for _, stmt := range p.Statements {
+		Walk(stmt, fn)
+	}
+	for _, assumption := range p.Assumptions {
+		Walk(assumption, fn)
+	}
+	for _, scenario := range p.Scenarios {
+		Walk(scenario, fn)
+	}
+	for _, name := range declaredNames(p.Declarations) {
+		Walk(p.Declarations[name], fn)
+	}
+}
+
+// Rewrite rewrites the nodes Walk walks: the statements of the program, then
+// its assumptions, scenarios and variable declarations. Statements that fn
+// replaces by nil are removed, and so are assumptions, scenarios and
+// declarations that it replaces by nil or by a node of another type.
+// Scenarios and declarations are declared again, so that their values are
+// taken from the rewritten expressions, and the asserts are numbered again.
+// On an error the program is left partly rewritten.
+func (p *Program) Rewrite(fn func(Node) Node) error {
+	var statements []Statement
+	for _, stmt := range p.Statements {
+		rewritten, err := Rewrite(stmt, fn)
+		if err == nil {
+			err = checkReplacement(stmt, rewritten)
+		}
+		if err != nil {
+			return err
+		}
+		if rewritten != nil {
+			statements = append(statements, rewritten.(Statement))
+		}
+	}
+	p.Statements = statements
+
+	var assumptions []*AssumeStatement
+	for _, assumption := range p.Assumptions {
+		rewritten, err := Rewrite(assumption, fn)
+		if err != nil {
+			return err
+		}
+		if assumption, ok := rewritten.(*AssumeStatement); ok {
+			assumptions = append(assumptions, assumption)
+		}
+	}
+	p.Assumptions = assumptions
+
+	scenarios := p.Scenarios
+	p.Scenarios = nil
+	for _, scenario := range scenarios {
+		rewritten, err := Rewrite(scenario, fn)
+		if err != nil {
+			return err
+		}
+		if scenario, ok := rewritten.(*ScenarioBlock); ok {
+			if err := scenario.declare(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	declarations := p.Declarations
+	p.Declarations = nil
+	for _, name := range declaredNames(declarations) {
+		rewritten, err := Rewrite(declarations[name], fn)
+		if err != nil {
+			return err
+		}
+		if declaration, ok := rewritten.(*VarDeclaration); ok {
+			if err := declaration.declare(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	index := 0
+	forEachAssert(p.Statements, nil, func(as *AssertStatement, _ []string) {
+		as.index = index
+		index++
+	})
+	return nil
+}
+
+func toNodes[T Node](items []T) []Node {
+	nodes := make([]Node, len(items))
+	for i, item := range items {
+		nodes[i] = item
+	}
+	return nodes
+}
+
+func toExpressions(nodes []Node) []Expression {
+	var expressions []Expression
+	for _, node := range nodes {
+		expressions = append(expressions, node.(Expression))
+	}
+	return expressions
+}
+
+// toStatements converts the children of a block back to statements, leaving
+// out the ones a rewrite removed.
+func toStatements(nodes []Node) []Statement {
+	var statements []Statement
+	for _, node := range nodes {
+		if node != nil {
+			statements = append(statements, node.(Statement))
+		}
+	}
+	return statements
+}
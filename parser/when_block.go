@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// WhenBlock is for blocks like when env == "prod" { assert replicas >= 3 }.
+// The asserts of the block are only evaluated when the guard holds, and are
+// reported as skipped otherwise.
+type WhenBlock struct {
+	Token      constants.Token
+	Guard      Expression
+	Tags       []string
+	Statements []Statement
+
+	// tolerance is set by a tolerance pragma of the included file the block
+	// is in.
+	tolerance *Tolerance
+}
+
+func (wb *WhenBlock) TokenLiteral() string { return wb.Token.Lexeme }
+
+func (wb *WhenBlock) Children() []Node {
+	return append([]Node{wb.Guard}, toNodes(wb.Statements)...)
+}
+
+func (wb *WhenBlock) setChildren(children []Node) {
+	wb.Guard = children[0].(Expression)
+	wb.Statements = toStatements(children[1:])
+}
+
+// Evaluate returns the result of the first nested statement that fails, or 0
+// when the guard does not hold.
+func (wb *WhenBlock) Evaluate(env *Env) (float64, error) {
+	holds, err := wb.guardHolds(env)
+	if err != nil || !holds {
+		return 0, err
+	}
+
+	for _, stmt := range wb.Statements {
+		if value, err := stmt.Evaluate(env); err != nil {
+			return value, err
+		}
+	}
+	return 0, nil
+}
+
+func (wb *WhenBlock) guardHolds(env *Env) (bool, error) {
+	value, err := wb.Guard.EvaluateValue(env.withTolerance(wb.tolerance))
+	if err != nil {
+		return false, err
+	}
+	return isTrue(value)
+}
+
+func (wb *WhenBlock) PartialEvaluate(env *Env) (string, error) {
+	statements, err := partialStatements([]Statement{wb}, env, selectAll)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(statements, "\n"), nil
+}
+
+// partialStatements returns the statements that replace the block after
+// partial evaluation: none when the guard folds to false, the nested
+// statements with the tags of the block when it folds to true, and the block
+// itself otherwise. Blocks
+// without selected asserts are dropped.
+func (wb *WhenBlock) partialStatements(env *Env, selected func(*AssertStatement) bool) ([]string, error) {
+	statements, err := partialStatements(wb.Statements, env, selected)
+	if err != nil || len(statements) == 0 {
+		return statements, err
+	}
+
+	guard, err := wb.Guard.PartialEvaluate(env.withTolerance(wb.tolerance))
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := constantValue(guard)
+	if !ok {
+		return []string{formatBlock(formatTags(wb.Tags)+"when "+guard, statements)}, nil
+	}
+
+	holds, err := isTrue(value)
+	if err != nil {
+		return nil, fmt.Errorf("guard: %s", err)
+	}
+	if !holds {
+		return []string{}, nil
+	}
+
+	// The inlined statements keep the tags of the block, so that selecting
+	// the partial results by tag still finds them.
+	for i, stmt := range statements {
+		statements[i] = formatTags(wb.Tags) + stmt
+	}
+	return statements, nil
+}
+
+// partialStatements partially evaluates the selected asserts of statements,
+// and the blocks that hold them.
+func partialStatements(statements []Statement, env *Env, selected func(*AssertStatement) bool) ([]string, error) {
+	partials := []string{}
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *WhenBlock:
+			nested, err := s.partialStatements(env, selected)
+			if err != nil {
+				return nil, err
+			}
+			partials = append(partials, nested...)
+
+		case *SuiteBlock:
+			nested, err := partialStatements(s.Statements, env, selected)
+			if err != nil {
+				return nil, err
+			}
+			if len(nested) > 0 {
+				partials = append(partials, formatBlock(s.header(), nested))
+			}
+
+		case *AssertStatement:
+			if !selected(s) {
+				continue
+			}
+			partial, err := s.PartialEvaluate(env)
+			if err != nil {
+				return nil, err
+			}
+			partials = append(partials, partial)
+		}
+	}
+	return partials, nil
+}
+
+func (wb *WhenBlock) String() string {
+	statements := make([]string, len(wb.Statements))
+	for i, stmt := range wb.Statements {
+		statements[i] = stmt.String()
+	}
+	return formatBlock(formatTags(wb.Tags)+"when "+wb.Guard.String(), statements)
+}
+
+// formatBlock formats a block like when guard { ... } from its header and
+// statements.
+func formatBlock(header string, statements []string) string {
+	var out strings.Builder
+	out.WriteString(header + " {\n")
+	for _, stmt := range statements {
+		for _, line := range strings.Split(stmt, "\n") {
+			out.WriteString("    " + line + "\n")
+		}
+	}
+	out.WriteString("}")
+	return out.String()
+}
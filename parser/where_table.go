@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"fmt"
+	"parser/constants"
+	"strings"
+)
+
+// WhereTable is a Spock style table of values attached to an assert:
+//
+//	assert a + b == c where
+//	    | a | b | c |
+//	    | 1 | 2 | 3 |
+//
+// The assert is evaluated once per row, with the columns of the row as
+// variables, and each row gets its own result.
+type WhereTable struct {
+	Token   constants.Token
+	Columns []string
+	Rows    [][]Expression
+}
+
+func (wt *WhereTable) String() string {
+	var out strings.Builder
+	out.WriteString("where")
+
+	out.WriteString("\n    | " + strings.Join(wt.Columns, " | ") + " |")
+
+	for _, row := range wt.Rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = cell.String()
+		}
+		out.WriteString("\n    | " + strings.Join(cells, " | ") + " |")
+	}
+	return out.String()
+}
+
+// check reports rows that do not match the header and cells that are not
+// constants.
+func (wt *WhereTable) check() error {
+	seen := map[string]bool{}
+	for _, column := range wt.Columns {
+		if seen[column] {
+			return fmt.Errorf("where table on line %d has the column %s twice", wt.Token.Line, column)
+		}
+		seen[column] = true
+	}
+
+	if len(wt.Rows) == 0 {
+		return fmt.Errorf("where table on line %d has no rows", wt.Token.Line)
+	}
+	for i, row := range wt.Rows {
+		if len(row) != len(wt.Columns) {
+			return fmt.Errorf("row %d of the where table on line %d has %d cells, expected %d", i+1, wt.Token.Line, len(row), len(wt.Columns))
+		}
+		for _, cell := range row {
+			if !isConstantExpression(cell) {
+				return fmt.Errorf("row %d of the where table on line %d: %s is not a constant", i+1, wt.Token.Line, cell.String())
+			}
+		}
+	}
+	return nil
+}
+
+// rowValues returns the values of a row by column.
+func (wt *WhereTable) rowValues(i int) (map[string]Value, error) {
+	values := make(map[string]Value, len(wt.Columns))
+	for j, column := range wt.Columns {
+		value, err := wt.Rows[i][j].EvaluateValue(nil)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", column, err)
+		}
+		values[column] = value
+	}
+	return values, nil
+}
+
+// describeRow describes a row for results and messages, e.g.
+// row 2: a = 4, b = 5, c = 9.
+func (wt *WhereTable) describeRow(i int) string {
+	cells := make([]string, len(wt.Columns))
+	for j, column := range wt.Columns {
+		cells[j] = fmt.Sprintf("%s = %s", column, wt.Rows[i][j].String())
+	}
+	return fmt.Sprintf("row %d: %s", i+1, strings.Join(cells, ", "))
+}